@@ -1,8 +1,12 @@
 module github.com/picatz/openai-chat-graph
 
-go 1.19
+go 1.23
 
 require (
+	github.com/google/uuid v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/picatz/openai v0.0.0-20230326170916-6563ee8868c8
 	golang.org/x/text v0.8.0
+	google.golang.org/protobuf v1.36.9
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PseudonymFormat is the format of the pseudonyms generated by Pseudonyms,
+// formatted with the (1-based) order each proper noun is first found in.
+var PseudonymFormat = "Person %d"
+
+// Anonymize replaces each whole-word occurrence of each name (key) in the given
+// map with its pseudonym (value) in the content of every message in the graph,
+// and returns the total number of replacements, such as to share a transcript
+// without the real names or handles of the people in it.
+//
+// Unlike Redact, each name is consistently replaced by the same pseudonym, so
+// the conversation stays coherent. Names are matched case sensitively, and all
+// at once, so a pseudonym is never replaced again, even if it's also a name,
+// and longer names are preferred over shorter ones they start with (e.g.
+// "Jon Snow" over "Jon").
+//
+// Chat messages don't have an author name, so only their content is changed.
+func (graph *Chat) Anonymize(names map[string]string) int {
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		if name != "" {
+			keys = append(keys, name)
+		}
+	}
+
+	if len(keys) == 0 {
+		return 0
+	}
+
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), cmp.Compare(a, b))
+	})
+
+	patterns := make([]string, len(keys))
+	for i, key := range keys {
+		patterns[i] = regexp.QuoteMeta(key)
+	}
+
+	re := regexp.MustCompile(strings.Join(patterns, "|"))
+
+	var replaced int
+
+	for _, msg := range graph.nodes() {
+		var (
+			b    strings.Builder
+			last int
+			n    int
+		)
+
+		for i := 0; i < len(msg.Content); {
+			loc := re.FindStringIndex(msg.Content[i:])
+			if loc == nil {
+				break
+			}
+
+			start := i + loc[0]
+
+			// The regexp prefers the longest name, which might not be a whole
+			// word where a shorter one is (e.g. "Jon" in "Jon Snowden"), so
+			// every name is tried at the match.
+			name := wholeWordAt(msg.Content, start, keys)
+			if name == "" {
+				_, size := utf8.DecodeRuneInString(msg.Content[start:])
+				i = start + size
+				continue
+			}
+
+			b.WriteString(msg.Content[last:start])
+			b.WriteString(names[name])
+			last = start + len(name)
+			i = last
+			n++
+		}
+
+		if n > 0 {
+			b.WriteString(msg.Content[last:])
+			msg.Content = b.String()
+			replaced += n
+		}
+	}
+
+	return replaced
+}
+
+// wholeWordAt returns the first of the given names, sorted longest first, found
+// as a whole word at the given index of the text, like the WholeWord search
+// option, or an empty string if there isn't one.
+func wholeWordAt(text string, i int, names []string) string {
+	if before, _ := utf8.DecodeLastRuneInString(text[:i]); isWordRune(before) {
+		return ""
+	}
+
+	for _, name := range names {
+		if !strings.HasPrefix(text[i:], name) {
+			continue
+		}
+
+		if after, _ := utf8.DecodeRuneInString(text[i+len(name):]); !isWordRune(after) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// Pseudonyms returns a pseudonym, formatted with the PseudonymFormat, for each
+// proper noun found in the content of the messages in the graph, numbered in
+// the order they're first found, in the same order as Visit, to be used with
+// Anonymize.
+//
+// Proper nouns are detected without a model, with a simple heuristic: words
+// starting with an uppercase letter that don't start a sentence, other than
+// common English stopwords (e.g. "I"). So, names are missed when they only
+// start sentences, and other capitalized words (e.g. "Monday") are included.
+// Review, and edit, the pseudonyms before using them.
+func (graph *Chat) Pseudonyms() map[string]string {
+	pseudonyms := map[string]string{}
+
+	for _, msg := range graph.nodes() {
+		for _, noun := range properNouns(msg.Content) {
+			if _, ok := pseudonyms[noun]; !ok {
+				pseudonyms[noun] = fmt.Sprintf(PseudonymFormat, len(pseudonyms)+1)
+			}
+		}
+	}
+
+	return pseudonyms
+}
+
+// properNouns returns the capitalized words in the given text that don't start
+// a sentence, and aren't stopwords, in order.
+func properNouns(text string) []string {
+	var (
+		nouns []string
+
+		// Whether the next word starts a sentence.
+		sentenceStart = true
+	)
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if !isWordRune(r) {
+			switch r {
+			case '.', '!', '?', '\n':
+				sentenceStart = true
+			}
+
+			i += size
+			continue
+		}
+
+		end := i + strings.IndexFunc(text[i:]+" ", func(r rune) bool {
+			return !isWordRune(r)
+		})
+
+		word := text[i:end]
+
+		if !sentenceStart && unicode.IsUpper(r) && utf8.RuneCountInString(word) > 1 && !stopwords[strings.ToLower(word)] {
+			nouns = append(nouns, word)
+		}
+
+		sentenceStart = false
+		i = end
+	}
+
+	return nouns
+}
@@ -0,0 +1,69 @@
+package graph_test
+
+import "testing"
+
+func TestChatAnonymize(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	chat.GetMessageByID("a").Content = "Is Jon Snow the son of Rhaegar? Ask Jon, or Arya."
+	chat.GetMessageByID("b").Content = "Jon's father was Rhaegar, not Jonah."
+
+	n := chat.Anonymize(map[string]string{
+		"Jon Snow": "Person 1",
+		"Jon":      "Person 1",
+		"Rhaegar":  "Person 2",
+		"Arya":     "Jon",
+	})
+
+	if n != 6 {
+		t.Fatalf("expected 6 replacements, got %d", n)
+	}
+
+	want := map[string]string{
+		"a": "Is Person 1 the son of Person 2? Ask Person 1, or Jon.",
+		"b": "Person 1's father was Person 2, not Jonah.",
+		"c": "message c",
+	}
+
+	for id, content := range want {
+		if got := chat.GetMessageByID(id).Content; got != content {
+			t.Fatalf("expected message %q content %q, got %q", id, content, got)
+		}
+	}
+
+	// A shorter name is still replaced where a longer one it starts with
+	// matches, but not as a whole word.
+	chat = newTestThread("a")
+	chat.GetMessageByID("a").Content = "Jon Snowden and Jon"
+
+	if n := chat.Anonymize(map[string]string{"Jon Snow": "P1", "Jon": "P2"}); n != 2 {
+		t.Fatalf("expected 2 replacements, got %d", n)
+	}
+
+	if got := chat.GetMessageByID("a").Content; got != "P2 Snowden and P2" {
+		t.Fatalf("expected content %q, got %q", "P2 Snowden and P2", got)
+	}
+
+	if n := chat.Anonymize(nil); n != 0 {
+		t.Fatalf("expected no replacements, got %d", n)
+	}
+}
+
+func TestChatPseudonyms(t *testing.T) {
+	chat := newTestThread("a", "b")
+	chat.GetMessageByID("a").Content = "Should I ask Arya about Jon? Arya knows."
+	chat.GetMessageByID("b").Content = "Yes, ask Arya.\nSansa might know too."
+
+	pseudonyms := chat.Pseudonyms()
+
+	if len(pseudonyms) != 2 || pseudonyms["Arya"] != "Person 1" || pseudonyms["Jon"] != "Person 2" {
+		t.Fatalf("unexpected pseudonyms %v", pseudonyms)
+	}
+
+	if n := chat.Anonymize(pseudonyms); n != 4 {
+		t.Fatalf("expected 4 replacements, got %d", n)
+	}
+
+	if got := chat.GetMessageByID("a").Content; got != "Should I ask Person 1 about Person 2? Person 1 knows." {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
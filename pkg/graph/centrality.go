@@ -0,0 +1,234 @@
+package graph
+
+import "math"
+
+// pageRankTolerance is the total change of the scores below which PageRank
+// stops iterating, since the scores have converged.
+const pageRankTolerance = 1e-9
+
+// PageRank returns the PageRank of every message in the graph, by ID, over the
+// links to "out" messages, which scores the messages that many others lead to,
+// directly or indirectly, such as a pivotal message that many branches flow
+// through. The scores sum to 1.
+//
+// The scores are computed with the power method, starting from equal scores,
+// and repeatedly redistributing each message's score to its "out" messages,
+// with the given damping factor (the probability of following a link, instead
+// of jumping to a random message, typically 0.85). A message without any "out"
+// messages distributes its score to every message.
+//
+// # Convergence
+//
+// With a damping factor below 1, the scores converge geometrically, at the rate
+// of the damping factor, so the iterations stop early once the total change of
+// the scores is below 1e-9, or after the given number of iterations, whichever
+// is first. A damping factor outside of [0, 1) is replaced by 0.85, and fewer
+// than one iteration by 100.
+func (graph *Chat) PageRank(iterations int, damping float64) map[string]float64 {
+	if iterations < 1 {
+		iterations = 100
+	}
+
+	if damping < 0 || damping >= 1 {
+		damping = 0.85
+	}
+
+	nodes := graph.nodes()
+
+	n := len(nodes)
+	if n == 0 {
+		return map[string]float64{}
+	}
+
+	index := make(map[*Message]int, n)
+	for i, msg := range nodes {
+		index[msg] = i
+	}
+
+	scores := make([]float64, n)
+	for i := range scores {
+		scores[i] = 1 / float64(n)
+	}
+
+	next := make([]float64, n)
+
+	for iter := 0; iter < iterations; iter++ {
+		// The score of messages without any "out" messages is spread evenly.
+		var dangling float64
+		for i, msg := range nodes {
+			if len(msg.Out) == 0 {
+				dangling += scores[i]
+			}
+		}
+
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		for i := range next {
+			next[i] = base
+		}
+
+		for i, msg := range nodes {
+			if len(msg.Out) == 0 {
+				continue
+			}
+
+			share := damping * scores[i] / float64(len(msg.Out))
+			for _, out := range msg.Out {
+				if j, ok := index[out]; ok {
+					next[j] += share
+				}
+			}
+		}
+
+		var change float64
+		for i := range scores {
+			change += math.Abs(next[i] - scores[i])
+		}
+
+		scores, next = next, scores
+
+		if change < pageRankTolerance {
+			break
+		}
+	}
+
+	ranks := make(map[string]float64, n)
+	for i, msg := range nodes {
+		ranks[msg.ID] += scores[i]
+	}
+
+	return ranks
+}
+
+// DegreeCentrality returns the degree centrality of every message in the graph,
+// by ID, which is the fraction of the other messages that each message is
+// linked to, by either its "in" or "out" messages (ignoring the direction of
+// the links), from 0 for an isolated message, to 1 for a message linked to
+// every other message.
+func (graph *Chat) DegreeCentrality() map[string]float64 {
+	nodes, neighbors := graph.undirected()
+
+	centrality := make(map[string]float64, len(nodes))
+
+	for i, msg := range nodes {
+		var degree float64
+		if len(nodes) > 1 {
+			degree = float64(len(neighbors[i])) / float64(len(nodes)-1)
+		}
+
+		centrality[msg.ID] += degree
+	}
+
+	return centrality
+}
+
+// BetweennessCentrality returns the betweenness centrality of every message in
+// the graph, by ID, which is the fraction of the shortest paths between every
+// other pair of messages that pass through each message (ignoring the direction
+// of the links), using Brandes' algorithm. A message that bridges two parts of
+// a conversation scores high, while a leaf message scores 0.
+//
+// The scores are normalized to [0, 1] by the number of pairs of other messages.
+func (graph *Chat) BetweennessCentrality() map[string]float64 {
+	nodes, neighbors := graph.undirected()
+
+	n := len(nodes)
+	scores := make([]float64, n)
+
+	var (
+		stack = make([]int, 0, n)
+		queue = make([]int, 0, n)
+		preds = make([][]int, n)
+		paths = make([]float64, n)
+		dist  = make([]int, n)
+		delta = make([]float64, n)
+	)
+
+	for s := range nodes {
+		stack, queue = stack[:0], queue[:0]
+		for i := range nodes {
+			preds[i] = preds[i][:0]
+			paths[i], dist[i], delta[i] = 0, -1, 0
+		}
+
+		paths[s], dist[s] = 1, 0
+		queue = append(queue, s)
+
+		// Count the shortest paths from the source with a breadth-first-search.
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+
+			for _, w := range neighbors[v] {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+
+				if dist[w] == dist[v]+1 {
+					paths[w] += paths[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+
+		// Accumulate the dependencies of the source, farthest messages first.
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				delta[v] += paths[v] / paths[w] * (1 + delta[w])
+			}
+
+			if w != s {
+				scores[w] += delta[w]
+			}
+		}
+	}
+
+	centrality := make(map[string]float64, n)
+
+	for i, msg := range nodes {
+		// Each pair is counted from both ends, so the number of ordered
+		// pairs of other messages normalizes the scores.
+		var score float64
+		if n > 2 {
+			score = scores[i] / float64((n-1)*(n-2))
+		}
+
+		centrality[msg.ID] += score
+	}
+
+	return centrality
+}
+
+// undirected returns every message in the graph, in the same order as Visit,
+// and the indexes of the distinct messages each one is linked to, by either its
+// "in" or "out" messages, excluding itself.
+func (graph *Chat) undirected() (Messages, [][]int) {
+	nodes := graph.nodes()
+
+	index := make(map[*Message]int, len(nodes))
+	for i, msg := range nodes {
+		index[msg] = i
+	}
+
+	neighbors := make([][]int, len(nodes))
+
+	for i, msg := range nodes {
+		seen := map[int]bool{i: true}
+
+		for _, links := range []Messages{msg.In, msg.Out} {
+			for _, other := range links {
+				j, ok := index[other]
+				if !ok || seen[j] {
+					continue
+				}
+
+				seen[j] = true
+				neighbors[i] = append(neighbors[i], j)
+			}
+		}
+	}
+
+	return nodes, neighbors
+}
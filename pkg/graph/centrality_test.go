@@ -0,0 +1,95 @@
+package graph_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatPageRank(t *testing.T) {
+	// b, c, and d all lead to e, which leads back to a.
+	chat := newTestThread("a", "b", "e")
+	a, e := chat.GetMessageByID("a"), chat.GetMessageByID("e")
+	for _, id := range []string{"c", "d"} {
+		msg := &graph.Message{ID: id}
+		a.AddOutIn(msg)
+		msg.AddOutIn(e)
+	}
+	e.AddOutIn(a)
+
+	ranks := chat.PageRank(100, 0.85)
+
+	if len(ranks) != 5 {
+		t.Fatalf("expected 5 scores, got %d", len(ranks))
+	}
+
+	var total float64
+	for _, rank := range ranks {
+		total += rank
+	}
+
+	if math.Abs(total-1) > 1e-6 {
+		t.Fatalf("expected scores to sum to 1, got %v", total)
+	}
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if ranks["e"] <= ranks[id] {
+			t.Fatalf("expected e to have the highest score, got %v", ranks)
+		}
+	}
+
+	if math.Abs(ranks["b"]-ranks["c"]) > 1e-9 {
+		t.Fatalf("expected b and c to have the same score, got %v", ranks)
+	}
+
+	if ranks := (&graph.Chat{}).PageRank(0, 0); len(ranks) != 0 {
+		t.Fatalf("expected no scores, got %v", ranks)
+	}
+}
+
+func TestChatDegreeCentrality(t *testing.T) {
+	// A star, with "a" linked to every other message.
+	chat := newTestThread("a", "b")
+	a := chat.GetMessageByID("a")
+	for _, id := range []string{"c", "d", "e"} {
+		a.AddOutIn(&graph.Message{ID: id})
+	}
+
+	centrality := chat.DegreeCentrality()
+
+	if len(centrality) != 5 {
+		t.Fatalf("expected 5 scores, got %d", len(centrality))
+	}
+
+	if centrality["a"] != 1 || centrality["b"] != 0.25 || centrality["e"] != 0.25 {
+		t.Fatalf("unexpected centrality %v", centrality)
+	}
+}
+
+func TestChatBetweennessCentrality(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	centrality := chat.BetweennessCentrality()
+
+	// In a line of 4 messages, "b" is between 2 of the 3 pairs of other messages.
+	want := map[string]float64{"a": 0, "b": 2.0 / 3, "c": 2.0 / 3, "d": 0}
+
+	for id, score := range want {
+		if math.Abs(centrality[id]-score) > 1e-9 {
+			t.Fatalf("expected %q to score %v, got %v", id, score, centrality)
+		}
+	}
+
+	// A shortcut from "a" to "d" makes a ring, where every message is
+	// between the same number of pairs.
+	chat.GetMessageByID("a").AddOutIn(chat.GetMessageByID("d"))
+
+	centrality = chat.BetweennessCentrality()
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if math.Abs(centrality[id]-1.0/6) > 1e-9 {
+			t.Fatalf("expected %q to score %v, got %v", id, 1.0/6, centrality)
+		}
+	}
+}
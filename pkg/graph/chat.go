@@ -3,71 +3,70 @@ package graph
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/picatz/openai"
-	"golang.org/x/text/language"
-	"golang.org/x/text/search"
 )
 
 // Chat is a "chat graph" that contains a connected set of messages.
 type Chat struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Messages `json:"messages"`
+	ID       string `json:"id" yaml:"id"`
+	Name     string `json:"name" yaml:"name"`
+	Messages `json:"messages" yaml:"messages"`
+
+	// onAdd are the functions called by AddMessage, registered with OnAddMessage.
+	onAdd []func(*Message)
 }
 
 // Visit visits the chat graph in a depth-first-search manner
 // and calls the given function for each message. This function is
 // useful as a foundation for other graph traversal algorithms.
+//
+// The function can return ErrStopVisit to stop the traversal early
+// without an error, or ErrSkipChildren to skip the "out" messages
+// of the current message, like VisitMessages.
 func (c *Chat) Visit(ctx context.Context, fn func(*Message) error) error {
-	seenMsgs := NewMessageSet()
-
-	for _, message := range c.Messages {
-		if seenMsgs.Has(message) {
-			continue
-		}
-
-		if err := VisitMessages(ctx, message, seenMsgs, fn); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return c.Messages.Visit(ctx, fn)
 }
 
+var (
+	// ErrStopVisit can be returned by the function given to Visit (and every other
+	// traversal method, such as VisitMessages, VisitDepth, or VisitParallel) to stop
+	// the traversal early, such as once the first matching message is found. It's
+	// not returned by the traversal, which returns nil instead, like filepath.SkipAll.
+	ErrStopVisit = errors.New("stop visit")
+
+	// ErrSkipChildren can be returned by the function given to Visit (and every
+	// other traversal method) to skip the "out" messages of the current message,
+	// while continuing the rest of the traversal, like filepath.SkipDir.
+	// A skipped message can still be visited if it's reached another way.
+	ErrSkipChildren = errors.New("skip children")
+)
+
 // VisitMessages visits messages in a depth-first-search manner
 // and calls the given function for each message. This function is
 // useful as a foundation for other graph traversal algorithms.
+//
+// The traversal uses an explicit stack instead of recursion, so
+// arbitrarily deep graphs can be visited.
+//
+// The function can return ErrStopVisit to stop the traversal early,
+// in which case nil is returned, or ErrSkipChildren to skip the "out"
+// messages of the current message.
 func VisitMessages(ctx context.Context, message *Message, mset MessageSet, fn func(*Message) error) error {
-	// If we've already seen this message, return.
-	if mset.Has(message) {
+	err := walk(ctx, message, 0, -1, mset, walkOptions{}, func(message *Message, _ int) error {
+		return fn(message)
+	})
+	if errors.Is(err, ErrStopVisit) {
 		return nil
 	}
-
-	// Mark the message as seen.
-	mset.Add(message)
-
-	// Call the function on the current message.
-	if err := fn(message); err != nil {
-		return err
-	}
-
-	// Visit the "out" messages to "drill down" not "up", if any.
-	for _, next := range message.Out {
-		// If we've already seen this message, skip.
-		if mset.Has(next) {
-			continue
-		}
-
-		if err := VisitMessages(ctx, next, mset, fn); err != nil {
-			return err
-		}
-	}
-
-	// Done.
-	return nil
+	return err
 }
 
 // Message is a single chat message that is connected to other messages.
@@ -107,24 +106,142 @@ type Message struct {
 	// Example, if this message is a question, the response message could
 	// be in the "out" collection.
 	Out Messages `json:"out,omitempty"`
+
+	// Embedding is the cached embedding of the message's content, if any,
+	// as returned by the OpenAI embeddings API, used by SemanticSearch.
+	//
+	// It's populated by Embed, and included in the message's JSON when present.
+	Embedding []float32 `json:"embedding,omitempty"`
+
+	// CreatedAt is when the message was created, if known (non-zero).
+	//
+	// It's included in the message's JSON when known.
+	CreatedAt time.Time `json:"created_at,omitempty"`
+
+	// Metadata is arbitrary, application-specific, data about the message
+	// (e.g. the author's user ID, or the model used to generate it).
+	//
+	// Values must be JSON-serializable, since they're included in the message's
+	// JSON when present. Like encoding/json, numbers are float64 when unmarshalled.
+	Metadata map[string]any `json:"metadata,omitempty"`
+
+	// Tags are labels for the message (e.g. "important", or "needs-review"),
+	// without duplicates, added with AddTag.
+	//
+	// They're included in the message's JSON when present.
+	Tags []string `json:"tags,omitempty"`
+
+	// OutWeights are the weights of the links to the "out" messages, by their
+	// IDs (e.g. the relevance, or cost, of following a link), used by
+	// WeightedShortestPath. A link without a weight has the DefaultEdgeWeight.
+	//
+	// They're added with AddOutWeighted, and included in the message's JSON
+	// when present.
+	OutWeights map[string]float64 `json:"out_weights,omitempty"`
+
+	// OutLabels are the labels of the links to the "out" messages, by their
+	// IDs, describing how the messages are related (e.g. "reply", "correction",
+	// or "citation"). A link without a label is unlabeled.
+	//
+	// They're added with AddOutLabeled, and included in the message's JSON
+	// when present.
+	OutLabels map[string]string `json:"out_labels,omitempty"`
+}
+
+// NewMessage returns a new message with the given role and content,
+// and a new unique ID.
+func NewMessage(role, content string) *Message {
+	return &Message{
+		ID: newID(),
+		ChatMessage: openai.ChatMessage{
+			Role:    role,
+			Content: content,
+		},
+	}
+}
+
+// newID returns a new unique message ID.
+func newID() string {
+	return uuid.NewString()
+}
+
+// messageJSON is the JSON representation of a Message, used by MarshalJSON
+// and UnmarshalJSON, which only includes the IDs of the "in" and "out" messages.
+type messageJSON struct {
+	ID      string     `json:"id"`
+	Role    string     `json:"role"`
+	Content string     `json:"content"`
+	In      messageIDs `json:"in"`
+	Out     messageIDs `json:"out"`
+
+	Embedding []float32      `json:"embedding,omitempty"`
+	CreatedAt *time.Time     `json:"created_at,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+
+	OutWeights map[string]float64 `json:"out_weights,omitempty"`
+	OutLabels  map[string]string  `json:"out_labels,omitempty"`
+}
+
+// messageIDs is a list of message IDs, which can be unmarshalled from JSON
+// strings, or numbers, as written by earlier versions of this package.
+type messageIDs []string
+
+// UnmarshalJSON implements the json.Unmarshaler interface for messageIDs.
+func (ids *messageIDs) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*ids = make(messageIDs, 0, len(raw))
+
+	for _, r := range raw {
+		var id string
+		if err := json.Unmarshal(r, &id); err != nil {
+			var num json.Number
+			if err := json.Unmarshal(r, &num); err != nil {
+				return fmt.Errorf("invalid message ID %s: %w", r, err)
+			}
+			id = num.String()
+		}
+		*ids = append(*ids, id)
+	}
+
+	return nil
 }
 
 // MarshalJSON implements the json.Marshaler interface for Message,
 // which is like the normal json.Marshal, but only includes message IDs
 // for the "in" and "out" collections, to reduce the size of the JSON.
 func (m *Message) MarshalJSON() ([]byte, error) {
-	// Using fmt.Sprintf instead of json.Marshal to avoid
-	// an infinite loop, and to avoid marshalling a another struct.
-	return []byte(
-		fmt.Sprintf(
-			`{"id":"%s","role":"%s","content":"%s","in":[%s],"out":[%s]}`,
-			m.ID,
-			m.Role,
-			m.Content,
-			strings.Join(m.In.IDs(), ","),
-			strings.Join(m.Out.IDs(), ","),
-		),
-	), nil
+	// Using a separate struct to avoid an infinite loop.
+	return json.Marshal(m.toJSON())
+}
+
+// toJSON returns the JSON representation of the message.
+func (m *Message) toJSON() messageJSON {
+	raw := messageJSON{
+		ID:      m.ID,
+		Role:    m.Role,
+		Content: m.Content,
+		In:      append(messageIDs{}, m.In.IDs()...),
+		Out:     append(messageIDs{}, m.Out.IDs()...),
+
+		Embedding: m.Embedding,
+		Metadata:  m.Metadata,
+		Tags:      m.Tags,
+
+		OutWeights: m.OutWeights,
+		OutLabels:  m.OutLabels,
+	}
+
+	// The creation time is optional, so it's omitted if unknown.
+	if !m.CreatedAt.IsZero() {
+		raw.CreatedAt = &m.CreatedAt
+	}
+
+	return raw
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Message,
@@ -133,15 +250,8 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 //
 // This can be done at the message set or the graph level.
 func (m *Message) UnmarshalJSON(b []byte) error {
-	// Using json.Unmarshal instead of fmt.Sprintf to avoid
-	// an infinite loop, and to avoid unmarshalling a another struct.
-	var raw struct {
-		ID      string   `json:"id"`
-		Role    string   `json:"role"`
-		Content string   `json:"content"`
-		In      []string `json:"in"`
-		Out     []string `json:"out"`
-	}
+	// Using a separate struct to avoid an infinite loop.
+	var raw messageJSON
 
 	if err := json.Unmarshal(b, &raw); err != nil {
 		return err
@@ -150,6 +260,15 @@ func (m *Message) UnmarshalJSON(b []byte) error {
 	m.ID = raw.ID
 	m.Role = raw.Role
 	m.Content = raw.Content
+	m.Embedding = raw.Embedding
+	m.Metadata = raw.Metadata
+	m.Tags = raw.Tags
+	m.OutWeights = raw.OutWeights
+	m.OutLabels = raw.OutLabels
+
+	if raw.CreatedAt != nil {
+		m.CreatedAt = *raw.CreatedAt
+	}
 
 	// Parially unmarshal the "in" messages.
 	for _, id := range raw.In {
@@ -192,6 +311,72 @@ func (m *Message) AddOutIn(msg *Message) {
 	msg.In = append(msg.In, m)
 }
 
+// DefaultEdgeWeight is the weight of a link to an "out" message without one in OutWeights.
+const DefaultEdgeWeight = 1.0
+
+// AddOutWeighted adds a message to the "out" messages, and this message to its
+// "in" messages, like AddOutIn, with the given weight for the link, which is
+// recorded in OutWeights, by the other message's ID.
+func (m *Message) AddOutWeighted(msg *Message, weight float64) {
+	m.AddOutIn(msg)
+	m.setOutWeight(msg.ID, weight)
+}
+
+// OutWeight returns the weight of the link to the given "out" message from
+// OutWeights, or the DefaultEdgeWeight if it doesn't have one.
+func (m *Message) OutWeight(msg *Message) float64 {
+	if weight, ok := m.OutWeights[msg.ID]; ok {
+		return weight
+	}
+	return DefaultEdgeWeight
+}
+
+// setOutWeight records the weight of the link to the "out" message with the given ID.
+func (m *Message) setOutWeight(id string, weight float64) {
+	if m.OutWeights == nil {
+		m.OutWeights = map[string]float64{}
+	}
+	m.OutWeights[id] = weight
+}
+
+// pruneOutAttributes deletes the weights and labels of links to messages that
+// are no longer "out" messages, so they aren't inherited by a message with the
+// same ID linked later.
+func (m *Message) pruneOutAttributes() {
+	for id := range m.OutWeights {
+		if m.Out.GetByID(id) == nil {
+			delete(m.OutWeights, id)
+		}
+	}
+	for id := range m.OutLabels {
+		if m.Out.GetByID(id) == nil {
+			delete(m.OutLabels, id)
+		}
+	}
+}
+
+// AddOutLabeled adds a message to the "out" messages, and this message to its
+// "in" messages, like AddOutIn, with the given label for the link, which is
+// recorded in OutLabels, by the other message's ID.
+func (m *Message) AddOutLabeled(msg *Message, label string) {
+	m.AddOutIn(msg)
+	m.setOutLabel(msg.ID, label)
+}
+
+// setOutLabel records the label of the link to the "out" message with the given ID.
+func (m *Message) setOutLabel(id string, label string) {
+	if m.OutLabels == nil {
+		m.OutLabels = map[string]string{}
+	}
+	m.OutLabels[id] = label
+}
+
+// OutLabel returns the label of the link to the given "out" message from
+// OutLabels, or an empty string if it's unlabeled.
+func (m *Message) OutLabel(msg *Message) string {
+	return m.OutLabels[msg.ID]
+}
+
 // String returns a string representation of the message.
 func (m *Message) String() string {
 	return fmt.Sprintf("%s: %s", m.Role, m.Content)
@@ -220,6 +405,43 @@ func (msgs Messages) Match(prFn func(*Message) bool) Messages {
 	return matches
 }
 
+// Map returns a new slice of the messages returned by the given function for
+// each message, in order. The original slice isn't modified, but the messages
+// are passed as-is, so fn should return a copy of any message it changes, to
+// leave the original messages untouched.
+func (msgs Messages) Map(fn func(*Message) *Message) Messages {
+	mapped := make(Messages, len(msgs))
+	for i, msg := range msgs {
+		mapped[i] = fn(msg)
+	}
+	return mapped
+}
+
+// Reduce aggregates the messages into a single value, by calling the given
+// function with the value so far (starting from init) and each message, in
+// order. It's a function, not a method, since methods can't have type parameters.
+//
+//	words := graph.Reduce(msgs, 0, func(n int, m *graph.Message) int {
+//		return n + len(strings.Fields(m.Content))
+//	})
+func Reduce[T any](msgs Messages, init T, fn func(T, *Message) T) T {
+	acc := init
+	for _, msg := range msgs {
+		acc = fn(acc, msg)
+	}
+	return acc
+}
+
+// GroupByRole returns the messages grouped by their role (e.g. user, assistant, system),
+// preserving the original order of the messages within each group.
+func (msgs Messages) GroupByRole() map[string]Messages {
+	groups := map[string]Messages{}
+	for _, msg := range msgs {
+		groups[msg.Role] = append(groups[msg.Role], msg)
+	}
+	return groups
+}
+
 // IDs returns a slice of message IDs.
 func (msgs Messages) IDs() []string {
 	ids := make([]string, len(msgs))
@@ -239,6 +461,46 @@ func (msgs Messages) GetByID(id string) *Message {
 	return nil
 }
 
+// contains returns true if the given message is in the collection.
+func (msgs Messages) contains(msg *Message) bool {
+	for _, m := range msgs {
+		if m == msg {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns the messages without any occurrence of the given message.
+func (msgs Messages) without(msg *Message) Messages {
+	if !msgs.contains(msg) {
+		return msgs
+	}
+
+	rest := make(Messages, 0, len(msgs)-1)
+	for _, m := range msgs {
+		if m != msg {
+			rest = append(rest, m)
+		}
+	}
+	return rest
+}
+
+// withoutAll returns the messages without any occurrence of the given messages.
+func (msgs Messages) withoutAll(removed map[*Message]bool) Messages {
+	if !slices.ContainsFunc(msgs, func(m *Message) bool { return removed[m] }) {
+		return msgs
+	}
+
+	rest := make(Messages, 0, len(msgs))
+	for _, m := range msgs {
+		if !removed[m] {
+			rest = append(rest, m)
+		}
+	}
+	return rest
+}
+
 // Hydrate fully hydrates the messages by adding the "in" and "out"
 // messages to the message collections instead of just the message IDs.
 func (msgs Messages) Hydrate(ctx context.Context, graph *Chat) {
@@ -248,24 +510,29 @@ func (msgs Messages) Hydrate(ctx context.Context, graph *Chat) {
 	}
 }
 
-// Hydrated returns true if the messages are fully hydrated.
+// Hydrated returns true if the messages are fully hydrated,
+// including both the "in" and "out" messages.
 func (msgs Messages) Hydrated() bool {
 	for _, msg := range msgs {
-		for _, in := range msg.In {
-			if in.ID == "" {
-				return false
-			}
-			if in.Content == "" && in.Role == "" {
-				return false
+		for _, edges := range []Messages{msg.In, msg.Out} {
+			for _, edge := range edges {
+				if edge.ID == "" {
+					return false
+				}
+				if edge.Content == "" && edge.Role == "" {
+					return false
+				}
 			}
 		}
 	}
 	return true
 }
 
-// GetMessages returns a collection of messages by ID for the graph.
+// GetMessages returns a collection of messages by ID for the graph, in the
+// order of the top-level messages. IDs that don't match any top-level message
+// are skipped, so the collection never contains nil messages.
 func (graph *Chat) GetMessages(ids ...string) Messages {
-	msgs := make(Messages, len(ids))
+	msgs := make(Messages, 0, len(ids))
 	for _, msg := range graph.Messages {
 		for _, id := range ids {
 			if msg.ID == id {
@@ -276,6 +543,44 @@ func (graph *Chat) GetMessages(ids ...string) Messages {
 	return msgs
 }
 
+// AddMessage adds a message to the graph, assigning it a new unique ID
+// if it doesn't already have one, and returns the message's ID.
+//
+// Any functions registered with OnAddMessage are called with the message.
+func (graph *Chat) AddMessage(msg *Message) string {
+	if msg.ID == "" {
+		msg.ID = newID()
+	}
+
+	graph.Messages = append(graph.Messages, msg)
+
+	for _, fn := range graph.onAdd {
+		fn(msg)
+	}
+
+	return msg.ID
+}
+
+// OnAddMessage registers a function to be called with each message added to
+// the graph by AddMessage, such as to keep an IDIndex, or EmbeddingIndex, up
+// to date as a conversation grows, without rebuilding it:
+//
+//	index := graph.NewIDIndex(chat)
+//	chat.OnAddMessage(index.Add)
+//
+// # Consistency
+//
+// Functions are called synchronously, in the order they were registered, after
+// the message is added, so an index is consistent with the graph as soon as
+// AddMessage returns. Only messages added with AddMessage are passed, not ones
+// appended to Messages directly, or only linked to others (e.g. with AddOutIn),
+// which must be added to an index explicitly.
+//
+// Registered functions aren't serialized, or copied by Clone.
+func (graph *Chat) OnAddMessage(fn func(*Message)) {
+	graph.onAdd = append(graph.onAdd, fn)
+}
+
 // GetMessageByID returns a message by ID (first match) for the graph.
 func (graph *Chat) GetMessageByID(id string) *Message {
 	for _, msg := range graph.Messages {
@@ -286,6 +591,42 @@ func (graph *Chat) GetMessageByID(id string) *Message {
 	return nil
 }
 
+// ErrMessageNotFound is returned when a message with a given ID is not in the graph.
+var ErrMessageNotFound = errors.New("message not found")
+
+// findMessage returns a message by ID (first match) from anywhere in the graph,
+// including messages only reachable through the "out" messages of others.
+func (graph *Chat) findMessage(id string) (*Message, error) {
+	var found *Message
+
+	_ = graph.Visit(context.Background(), func(msg *Message) error {
+		if msg.ID == id {
+			found = msg
+			return ErrStopVisit
+		}
+		return nil
+	})
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %q", ErrMessageNotFound, id)
+	}
+
+	return found, nil
+}
+
+// nodes returns every message in the graph, in depth-first order, including
+// messages only reachable through the "out" messages of others.
+func (graph *Chat) nodes() Messages {
+	nodes := Messages{}
+
+	_ = graph.Visit(context.Background(), func(msg *Message) error {
+		nodes = append(nodes, msg)
+		return nil
+	})
+
+	return nodes
+}
+
 // HydrateMessages fully hydrates the messages by adding the "in" and "out"
 // messages to the message collections instead of just the message IDs.
 //
@@ -296,6 +637,49 @@ func (graph *Chat) HydrateMessages(ctx context.Context) {
 	graph.Messages.Hydrate(ctx, graph)
 }
 
+// HydrateMessagesStrict fully hydrates the messages, like HydrateMessages,
+// but returns a *ValidationError listing every "in" and "out" message ID
+// that couldn't be resolved to a message in the graph, instead of silently
+// dropping them. Unresolved messages are left as they are (ID-only).
+func (graph *Chat) HydrateMessagesStrict(ctx context.Context) error {
+	index := make(map[string]*Message, len(graph.Messages))
+	for _, msg := range graph.Messages {
+		if _, ok := index[msg.ID]; !ok {
+			index[msg.ID] = msg
+		}
+	}
+
+	var problems []error
+
+	resolve := func(msg *Message, name string, edges Messages) {
+		for i, edge := range edges {
+			if found, ok := index[edge.ID]; ok {
+				edges[i] = found
+				continue
+			}
+			problems = append(problems, fmt.Errorf("%w: message %q has %q message %q that is not in the graph", ErrDanglingEdge, msg.ID, name, edge.ID))
+		}
+	}
+
+	for _, msg := range graph.Messages {
+		// Stop if the context has been cancelled.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		resolve(msg, "in", msg.In)
+		resolve(msg, "out", msg.Out)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
 // SearchResults is a collection of search results.
 type SearchResult struct {
 	// The message that matched the search query.
@@ -309,37 +693,21 @@ type SearchResult struct {
 
 	// MatchEnd is the index of the end of the match in the message.
 	EndIndex int `json:"end_index"`
+
+	// Score is how relevant the message is to the search query, if ranked,
+	// such as the cosine similarity of their embeddings for SemanticSearch.
+	Score float64 `json:"score,omitempty"`
 }
 
 // Search searches the messages for matches to a given query.
+//
+// If the context is cancelled, the search stops early and
+// the results found so far are returned.
+//
+// It's case-insensitive, and matches substrings of words, using
+// SearchWithOptions with the default options.
 func (msgs Messages) Search(ctx context.Context, query string) []*SearchResult {
-	// Create a new matcher to be compiled into a pattern.
-	matcher := search.New(language.AmericanEnglish, search.IgnoreCase)
-
-	// Compile the query into a pattern that can be used to match messages.
-	pattern := matcher.CompileString(query)
-
-	// Results retrieved from the search.
-	results := []*SearchResult{}
-
-	// Iterate over the messages and collect any matches.
-	for i, msg := range msgs {
-		msg := msg // Avoid shadowing.
-
-		// If the message matches the pattern, add it to the results.
-		if start, end := pattern.IndexString(msg.Content); start != -1 && end != -1 {
-			// Add the result.
-			results = append(results, &SearchResult{
-				Message:      msg,
-				MessageIndex: i,
-				StartIndex:   start,
-				EndIndex:     end,
-			})
-		}
-	}
-
-	// Return the results.
-	return results
+	return msgs.SearchWithOptions(ctx, query, SearchOptions{})
 }
 
 // DefaultSummaryPrompt is the default prompt used to summarize messages for the Summarize method.
@@ -358,45 +726,95 @@ func (msgs Messages) Summarize(ctx context.Context, client *openai.Client, model
 
 // Summarize summarizes the messages using the OpenAI API.
 func (msgs Messages) SummarizeWithSystemPrompt(ctx context.Context, client *openai.Client, model string, summarySystemPrompt string) (string, error) {
-	// Create a thread of two messages, using a new system prompt to summarize conversation.
-	chatHistory := []openai.ChatMessage{
-		{
-			Role:    openai.ChatRoleSystem,
-			Content: summarySystemPrompt,
-		},
-		{
-			Role: openai.ChatRoleUser,
-			Content: func() string {
-				var b strings.Builder
-
-				for _, m := range msgs {
-					if m.Role == openai.ChatRoleSystem {
-						continue // TODO: is this always the right thing to do?
-					}
-					b.WriteString(fmt.Sprintf("%s: %s\n", m.Role, m.Content))
-				}
+	return msgs.SummarizeWithOptions(ctx, client, model, SummarizeOptions{
+		SystemPrompt: summarySystemPrompt,
+	})
+}
 
-				return b.String()
-			}(),
-		},
+// SummarizeOptions configures the SummarizeWithOptions method.
+// The zero value is the same as Summarize.
+type SummarizeOptions struct {
+	// SystemPrompt is the prompt used to summarize the messages,
+	// which is DefaultSummaryPrompt if empty.
+	SystemPrompt string
+
+	// IncludeSystem includes system messages (e.g. a persona) in the
+	// summarized conversation, which are skipped by default.
+	IncludeSystem bool
+
+	// Retry configures how the request is retried after transient errors
+	// (e.g. DefaultRetryOptions), which isn't retried if nil.
+	Retry *RetryOptions
+}
+
+// SummarizeWithOptions summarizes the messages using the OpenAI API,
+// like Summarize, configured by the given options.
+func (msgs Messages) SummarizeWithOptions(ctx context.Context, client *openai.Client, model string, opts SummarizeOptions) (string, error) {
+	prompt := opts.SystemPrompt
+	if prompt == "" {
+		prompt = DefaultSummaryPrompt
+	}
+
+	chatHistory, err := msgs.summaryChatHistory(ctx, prompt, opts.IncludeSystem)
+	if err != nil {
+		return "", err
 	}
 
 	// create a summary of the chat history
-	summary, err := client.CreateChat(ctx, &openai.CreateChatRequest{
+	summary, err := createChat(ctx, client, &openai.CreateChatRequest{
 		Model:    model,
 		Messages: chatHistory,
-	})
+	}, opts.Retry)
 
 	if err != nil {
 		return "", fmt.Errorf("failed to create summary of %d chat messages: %w", len(msgs), err)
 	}
 
+	if len(summary.Choices) == 0 {
+		return "", fmt.Errorf("failed to create summary of %d chat messages: %w", len(msgs), errNoChoices)
+	}
+
 	return summary.Choices[0].Message.Content, nil
 }
 
+// summaryChatHistory returns a thread of two messages, using a new system prompt
+// to summarize the conversation contained in the messages, optionally including
+// the system messages.
+func (msgs Messages) summaryChatHistory(ctx context.Context, summarySystemPrompt string, includeSystem bool) ([]openai.ChatMessage, error) {
+	var b strings.Builder
+
+	for _, m := range msgs {
+		// Stop if the context has been cancelled.
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if m.Role == openai.ChatRoleSystem && !includeSystem {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%s: %s\n", m.Role, m.Content))
+	}
+
+	return []openai.ChatMessage{
+		{
+			Role:    openai.ChatRoleSystem,
+			Content: summarySystemPrompt,
+		},
+		{
+			Role:    openai.ChatRoleUser,
+			Content: b.String(),
+		},
+	}, nil
+}
+
 // Visit visits the messages in a depth-first-search manner
 // and calls the given function for each message. This function is
 // useful as a foundation for other graph traversal algorithms.
+//
+// The function can return ErrStopVisit, or ErrSkipChildren, like
+// VisitMessages.
 func (msgs Messages) Visit(ctx context.Context, fn func(*Message) error) error {
 	seenMsgs := NewMessageSet()
 
@@ -405,7 +823,13 @@ func (msgs Messages) Visit(ctx context.Context, fn func(*Message) error) error {
 			continue
 		}
 
-		if err := VisitMessages(ctx, msg, seenMsgs, fn); err != nil {
+		err := walk(ctx, msg, 0, -1, seenMsgs, walkOptions{}, func(message *Message, _ int) error {
+			return fn(message)
+		})
+		if errors.Is(err, ErrStopVisit) {
+			return nil
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -415,6 +839,8 @@ func (msgs Messages) Visit(ctx context.Context, fn func(*Message) error) error {
 
 // MessageSet is a collection of messages, used to track seen messages
 // when traversing a graph to avoid infinite loops.
+//
+// A MessageSet is not safe for concurrent use, use a SyncMessageSet instead.
 type MessageSet map[*Message]struct{}
 
 // NewMessageSet returns a new seen messages collection.
@@ -457,3 +883,58 @@ func (s MessageSet) GetOrPut(message *Message) *Message {
 	s.Add(message)
 	return message
 }
+
+// SyncMessageSet is a collection of messages, like MessageSet, that is
+// safe for concurrent use by multiple goroutines, such as when traversing
+// a graph in parallel.
+type SyncMessageSet struct {
+	mu  sync.Mutex
+	set MessageSet
+}
+
+// NewSyncMessageSet returns a new concurrency-safe seen messages collection.
+func NewSyncMessageSet() *SyncMessageSet {
+	return &SyncMessageSet{
+		set: NewMessageSet(),
+	}
+}
+
+// Add adds a message to the seen messages.
+func (s *SyncMessageSet) Add(message *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set.Add(message)
+}
+
+// Has returns true if the message has been seen.
+func (s *SyncMessageSet) Has(message *Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set.Has(message)
+}
+
+// GetOrPut returns the message if it has been seen, or adds it to the
+// seen messages and returns it, as a single atomic operation.
+func (s *SyncMessageSet) GetOrPut(message *Message) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set.GetOrPut(message)
+}
+
+// AddIfAbsent adds a message to the seen messages, returning true if
+// it had not been seen before, as a single atomic operation. This is
+// useful to ensure a message is only processed once across goroutines.
+func (s *SyncMessageSet) AddIfAbsent(message *Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.set.Has(message) {
+		return false
+	}
+
+	s.set.Add(message)
+	return true
+}
@@ -2,9 +2,16 @@ package graph_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/picatz/openai"
 	"github.com/picatz/openai-chat-graph/pkg/graph"
@@ -364,3 +371,353 @@ func TestChatMessagesQandA(t *testing.T) {
 		return nil
 	})
 }
+
+func TestChatVisitCancel(t *testing.T) {
+	var (
+		root *graph.Message
+		prev *graph.Message
+	)
+
+	for i := 1; i <= 5; i++ {
+		msg := &graph.Message{
+			ID: fmt.Sprintf("message-%d", i),
+			ChatMessage: openai.ChatMessage{
+				Role:    openai.ChatRoleUser,
+				Content: fmt.Sprint(i),
+			},
+		}
+
+		if prev == nil {
+			root = msg
+		} else {
+			prev.AddOut(msg)
+		}
+
+		prev = msg
+	}
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{root},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	count := 0
+
+	err := chat.Visit(ctx, func(message *graph.Message) error {
+		count++
+
+		// Cancel the traversal midway through.
+		if message.ID == "message-2" {
+			cancel()
+		}
+
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+
+	if count != 2 {
+		t.Fatalf("expected 2 messages to be visited, got %d", count)
+	}
+}
+
+func TestSyncMessageSet(t *testing.T) {
+	set := graph.NewSyncMessageSet()
+
+	msg := &graph.Message{ID: "message-1"}
+
+	var (
+		wg    sync.WaitGroup
+		added int32
+	)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if set.AddIfAbsent(msg) {
+				atomic.AddInt32(&added, 1)
+			}
+
+			set.GetOrPut(msg)
+		}()
+	}
+
+	wg.Wait()
+
+	if added != 1 {
+		t.Fatalf("expected message to be added once, got %d", added)
+	}
+
+	if !set.Has(msg) {
+		t.Fatalf("expected message to be in the set")
+	}
+}
+
+func TestChatAddMessage(t *testing.T) {
+	chat := &graph.Chat{
+		ID:   "chat-1",
+		Name: "Test Chat",
+	}
+
+	question := graph.NewMessage(openai.ChatRoleUser, "Hello World!")
+	if question.ID == "" {
+		t.Fatalf("expected new message to have an ID")
+	}
+
+	answer := &graph.Message{
+		ChatMessage: openai.ChatMessage{
+			Role:    openai.ChatRoleAssistant,
+			Content: "Hello!",
+		},
+	}
+
+	if id := chat.AddMessage(question); id != question.ID {
+		t.Fatalf("expected message ID %q, got %q", question.ID, id)
+	}
+
+	id := chat.AddMessage(answer)
+	if id == "" || id != answer.ID {
+		t.Fatalf("expected message to be assigned an ID, got %q", answer.ID)
+	}
+
+	if id == question.ID {
+		t.Fatalf("expected unique message IDs, got %q twice", id)
+	}
+
+	if chat.GetMessageByID(id) != answer {
+		t.Fatalf("expected message %q to be in the graph", id)
+	}
+}
+
+func TestChatMessagesHydrated(t *testing.T) {
+	hydrated := &graph.Message{
+		ID: "message-1",
+		ChatMessage: openai.ChatMessage{
+			Role:    openai.ChatRoleUser,
+			Content: "Hello World!",
+		},
+	}
+
+	msg := &graph.Message{
+		ID: "message-2",
+		ChatMessage: openai.ChatMessage{
+			Role:    openai.ChatRoleAssistant,
+			Content: "Hello!",
+		},
+		In: graph.Messages{hydrated},
+	}
+
+	if !(graph.Messages{msg}).Hydrated() {
+		t.Fatalf("expected messages to be hydrated")
+	}
+
+	// Only the "out" messages are not hydrated.
+	msg.Out = graph.Messages{{ID: "message-3"}}
+
+	if (graph.Messages{msg}).Hydrated() {
+		t.Fatalf("expected messages with un-hydrated out messages to not be hydrated")
+	}
+}
+
+func TestChatHydrateMessagesStrict(t *testing.T) {
+	chat := &graph.Chat{
+		ID:   "chat-1",
+		Name: "Test Chat",
+		Messages: graph.Messages{
+			{
+				ID: "message-1",
+				ChatMessage: openai.ChatMessage{
+					Role:    openai.ChatRoleUser,
+					Content: "Hello World!",
+				},
+				Out: graph.Messages{{ID: "message-2"}, {ID: "message-3"}},
+			},
+			{
+				ID: "message-2",
+				ChatMessage: openai.ChatMessage{
+					Role:    openai.ChatRoleAssistant,
+					Content: "Hello!",
+				},
+				In: graph.Messages{{ID: "message-1"}},
+			},
+		},
+	}
+
+	err := chat.HydrateMessagesStrict(context.Background())
+	if !errors.Is(err, graph.ErrDanglingEdge) {
+		t.Fatalf("expected error %v, got %v", graph.ErrDanglingEdge, err)
+	}
+
+	if !strings.Contains(err.Error(), "message-3") {
+		t.Fatalf("expected error to list the unresolved message, got %v", err)
+	}
+
+	// Resolved messages are hydrated.
+	if chat.Messages[0].Out[0] != chat.Messages[1] || chat.Messages[1].In[0] != chat.Messages[0] {
+		t.Fatalf("expected resolved messages to be hydrated")
+	}
+
+	// Without the dangling edge, hydration succeeds.
+	chat.Messages[0].Out = chat.Messages[0].Out[:1]
+
+	if err := chat.HydrateMessagesStrict(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !chat.Messages.Hydrated() {
+		t.Fatalf("expected messages to be hydrated")
+	}
+}
+
+func TestChatGetMessages(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	msgs := chat.GetMessages("c", "missing", "a")
+
+	// Only the found messages are returned, in the graph's order, without a
+	// nil message for each ID, which HydrateMessages would link to.
+	if ids := strings.Join(msgs.IDs(), ","); ids != "a,c" {
+		t.Fatalf("expected messages %q, got %q", "a,c", ids)
+	}
+
+	if msgs := chat.GetMessages(); len(msgs) != 0 {
+		t.Fatalf("expected no messages, got %d", len(msgs))
+	}
+
+	// A dangling "out" message is dropped when hydrating, instead of becoming nil.
+	chat.Messages[2].Out = graph.Messages{{ID: "missing"}}
+	chat.HydrateMessages(context.Background())
+
+	if out := chat.Messages[2].Out; len(out) != 0 {
+		t.Fatalf("expected dangling out message to be dropped, got %d messages", len(out))
+	}
+
+	if in := chat.Messages[1].In; len(in) != 1 || in[0] != chat.Messages[0] {
+		t.Fatalf("expected b.In to be hydrated, got %v", in)
+	}
+}
+
+func TestChatMessagesGroupByRole(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage(openai.ChatRoleSystem, "You are a helpful assistant."),
+		graph.NewMessage(openai.ChatRoleUser, "1"),
+		graph.NewMessage(openai.ChatRoleAssistant, "2"),
+		graph.NewMessage(openai.ChatRoleUser, "3"),
+		graph.NewMessage(openai.ChatRoleAssistant, "4"),
+	}
+
+	groups := msgs.GroupByRole()
+
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+
+	for role, expected := range map[string]string{
+		openai.ChatRoleSystem:    "You are a helpful assistant.",
+		openai.ChatRoleUser:      "1,3",
+		openai.ChatRoleAssistant: "2,4",
+	} {
+		var contents []string
+		for _, msg := range groups[role] {
+			contents = append(contents, msg.Content)
+		}
+
+		if got := strings.Join(contents, ","); got != expected {
+			t.Fatalf("expected %s messages %q, got %q", role, expected, got)
+		}
+	}
+}
+
+func TestMessageJSON(t *testing.T) {
+	a := graph.NewMessage(openai.ChatRoleUser, `Say "hello"`)
+	b := graph.NewMessage(openai.ChatRoleAssistant, "hello\n")
+	a.AddOutIn(b)
+	a.Embedding = []float32{0.5, 1}
+	a.CreatedAt = time.Date(2023, 3, 26, 12, 0, 0, 0, time.UTC)
+	a.Metadata = map[string]any{"model": openai.ModelGPT4, "flagged": false}
+	a.AddTag("important")
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded graph.Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.ID != a.ID || decoded.Content != a.Content || len(decoded.Out) != 1 || decoded.Out[0].ID != b.ID || !slices.Equal(decoded.Embedding, a.Embedding) || !decoded.CreatedAt.Equal(a.CreatedAt) {
+		t.Fatalf("unexpected decoded message: %+v", decoded)
+	}
+
+	if data, err := json.Marshal(b); err != nil || strings.Contains(string(data), "created_at") {
+		t.Fatalf("expected unknown creation time to be omitted, got %s (%v)", data, err)
+	}
+
+	if decoded.OutWeight(b) != graph.DefaultEdgeWeight {
+		t.Fatalf("expected default weight, got %v", decoded.OutWeight(b))
+	}
+
+	if decoded.Metadata["model"] != openai.ModelGPT4 || decoded.Metadata["flagged"] != false || !decoded.HasTag("important") {
+		t.Fatalf("unexpected decoded metadata %v, or tags %v", decoded.Metadata, decoded.Tags)
+	}
+
+	t.Run("legacy numeric IDs", func(t *testing.T) {
+		var legacy graph.Message
+		if err := json.Unmarshal([]byte(`{"id":"2","role":"assistant","content":"hi","in":[1],"out":[3,4]}`), &legacy); err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := strings.Join(append(legacy.In.IDs(), legacy.Out.IDs()...), ","); ids != "1,3,4" {
+			t.Fatalf("expected IDs %q, got %q", "1,3,4", ids)
+		}
+	})
+}
+
+func TestMessagesMap(t *testing.T) {
+	msgs := newTestThread("a", "b").Messages
+
+	upper := msgs.Map(func(m *graph.Message) *graph.Message {
+		c := *m
+		c.Content = strings.ToUpper(m.Content)
+		return &c
+	})
+
+	if upper[0].Content != "MESSAGE A" || upper[1].Content != "MESSAGE B" {
+		t.Fatalf("unexpected mapped messages: %v", upper)
+	}
+
+	if msgs[0].Content != "message a" {
+		t.Fatalf("expected original messages to be untouched, got %q", msgs[0].Content)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	msgs := newTestThread("a", "b", "c").Messages
+
+	words := graph.Reduce(msgs, 0, func(n int, m *graph.Message) int {
+		return n + len(strings.Fields(m.Content))
+	})
+
+	if words != 6 {
+		t.Fatalf("expected 6 words, got %d", words)
+	}
+
+	roles := graph.Reduce(msgs, map[string]int{}, func(counts map[string]int, m *graph.Message) map[string]int {
+		counts[m.Role]++
+		return counts
+	})
+
+	if roles[openai.ChatRoleUser] != 2 || roles[openai.ChatRoleAssistant] != 1 {
+		t.Fatalf("unexpected role counts: %v", roles)
+	}
+}
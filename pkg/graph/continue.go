@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/picatz/openai"
+)
+
+// errNoChoices is returned when the OpenAI API responds without any choices.
+var errNoChoices = errors.New("no choices in response")
+
+// Continue continues the conversation using the OpenAI API, by sending the
+// top-level messages of the graph to the given model, and returns the reply
+// as a new assistant message with a new unique ID.
+//
+// The reply is added to the graph, and linked "out" from the most recent
+// (last) top-level message, if any, using AddOutIn.
+func (graph *Chat) Continue(ctx context.Context, client *openai.Client, model string) (*Message, error) {
+	resp, err := client.CreateChat(ctx, &openai.CreateChatRequest{
+		Model:    model,
+		Messages: graph.Messages.OpenAIChatMessages(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to continue conversation of %d chat messages: %w", len(graph.Messages), err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("failed to continue conversation of %d chat messages: %w", len(graph.Messages), errNoChoices)
+	}
+
+	reply := NewMessage(openai.ChatRoleAssistant, resp.Choices[0].Message.Content)
+
+	if len(graph.Messages) > 0 {
+		graph.Messages[len(graph.Messages)-1].AddOutIn(reply)
+	}
+
+	graph.AddMessage(reply)
+
+	return reply, nil
+}
@@ -0,0 +1,40 @@
+package graph_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/picatz/openai"
+)
+
+func TestChatContinue(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		if len(req.Messages) != 3 {
+			t.Fatalf("expected 3 messages in request, got %d", len(req.Messages))
+		}
+		if req.Messages[2].Content != "message c" {
+			t.Fatalf("expected last message %q, got %q", "message c", req.Messages[2].Content)
+		}
+		return "message d"
+	})
+
+	reply, err := chat.Continue(context.Background(), client, openai.ModelGPT4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.ID == "" || reply.Role != openai.ChatRoleAssistant || reply.Content != "message d" {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+
+	if chat.GetMessageByID(reply.ID) != reply {
+		t.Fatalf("expected reply to be added to the graph")
+	}
+
+	c := chat.GetMessageByID("c")
+	if len(c.Out) != 1 || c.Out[0] != reply || len(reply.In) != 1 || reply.In[0] != c {
+		t.Fatalf("expected reply to be linked from c")
+	}
+}
@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// WordCount returns the number of words in the message's content, as runs of
+// Unicode letters, marks, and digits, in any script.
+func (m *Message) WordCount() int {
+	return len(words(m.Content))
+}
+
+// CharCount returns the number of characters in the message's content, counted
+// as runes after Unicode normalization (NFC), so a character with an accent is
+// counted once, whether or not the accent is a separate combining mark.
+func (m *Message) CharCount() int {
+	return utf8.RuneCountInString(norm.NFC.String(m.Content))
+}
+
+// TotalWords returns the sum of the WordCount of each message.
+func (msgs Messages) TotalWords() int {
+	return Reduce(msgs, 0, func(n int, m *Message) int {
+		return n + m.WordCount()
+	})
+}
+
+// TotalChars returns the sum of the CharCount of each message.
+func (msgs Messages) TotalChars() int {
+	return Reduce(msgs, 0, func(n int, m *Message) int {
+		return n + m.CharCount()
+	})
+}
@@ -0,0 +1,32 @@
+package graph_test
+
+import (
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessageCounts(t *testing.T) {
+	msgs := graph.Messages{
+		// "café" with a combining accent.
+		graph.NewMessage(openai.ChatRoleUser, "Let's meet at the café, ok?"),
+		graph.NewMessage(openai.ChatRoleAssistant, "Привет, мир — 42!"),
+	}
+
+	if n := msgs[0].WordCount(); n != 7 {
+		t.Fatalf("expected 7 words, got %d", n)
+	}
+
+	if n := msgs[0].CharCount(); n != 27 {
+		t.Fatalf("expected 27 characters, got %d", n)
+	}
+
+	if n := msgs[1].WordCount(); n != 3 {
+		t.Fatalf("expected 3 words, got %d", n)
+	}
+
+	if words, chars := msgs.TotalWords(), msgs.TotalChars(); words != 10 || chars != 27+17 {
+		t.Fatalf("expected 10 words and %d characters, got %d and %d", 27+17, words, chars)
+	}
+}
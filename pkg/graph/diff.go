@@ -0,0 +1,102 @@
+package graph
+
+import "slices"
+
+// GraphDiff is the difference between two chat graphs, returned by Diff,
+// with messages matched by their IDs.
+type GraphDiff struct {
+	// Added are the messages only in the other graph.
+	Added Messages
+
+	// Removed are the messages only in the original graph.
+	Removed Messages
+
+	// Changed are the messages in both graphs with a different role, content,
+	// or "in" or "out" message IDs.
+	Changed []MessageChange
+}
+
+// MessageChange is a message that changed between two chat graphs.
+type MessageChange struct {
+	// Old is the message in the original graph.
+	Old *Message
+
+	// New is the message with the same ID in the other graph.
+	New *Message
+}
+
+// Empty returns true if there are no differences.
+func (d GraphDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff returns the differences between every message in the chat graph and in
+// the other graph, matched by their IDs, comparing their role, content, and the
+// sets of their "in" and "out" message IDs, regardless of the order of either.
+//
+// Removed and changed messages are in the same order as in this graph, and
+// added messages in the same order as in the other graph, with the top-level
+// messages first, followed by the rest in depth-first order.
+func (graph *Chat) Diff(other *Chat) GraphDiff {
+	var diff GraphDiff
+
+	msgs, otherMsgs := graph.flatten(), other.flatten()
+
+	index := make(map[string]*Message, len(otherMsgs))
+	for _, msg := range otherMsgs {
+		if _, ok := index[msg.ID]; !ok {
+			index[msg.ID] = msg
+		}
+	}
+
+	seenIDs := make(map[string]bool, len(msgs))
+
+	for _, msg := range msgs {
+		if seenIDs[msg.ID] {
+			continue
+		}
+		seenIDs[msg.ID] = true
+
+		otherMsg, ok := index[msg.ID]
+		switch {
+		case !ok:
+			diff.Removed = append(diff.Removed, msg)
+		case !sameMessage(msg, otherMsg):
+			diff.Changed = append(diff.Changed, MessageChange{Old: msg, New: otherMsg})
+		}
+	}
+
+	for _, msg := range otherMsgs {
+		if !seenIDs[msg.ID] {
+			seenIDs[msg.ID] = true
+			diff.Added = append(diff.Added, msg)
+		}
+	}
+
+	return diff
+}
+
+// Equal returns true if the chat graph has the same messages as the other
+// graph, as compared by Diff, regardless of their order.
+func (graph *Chat) Equal(other *Chat) bool {
+	return graph.Diff(other).Empty()
+}
+
+// sameMessage returns true if the messages have the same role, content,
+// and sets of "in" and "out" message IDs.
+func sameMessage(a, b *Message) bool {
+	return a.Role == b.Role &&
+		a.Content == b.Content &&
+		sameIDs(a.In, b.In) &&
+		sameIDs(a.Out, b.Out)
+}
+
+// sameIDs returns true if the messages have the same set of IDs.
+func sameIDs(a, b Messages) bool {
+	idsA, idsB := a.IDs(), b.IDs()
+
+	slices.Sort(idsA)
+	slices.Sort(idsB)
+
+	return slices.Equal(slices.Compact(idsA), slices.Compact(idsB))
+}
@@ -0,0 +1,77 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatEqual(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	chat.GetMessageByID("a").AddOutIn(chat.GetMessageByID("c"))
+
+	data, err := json.Marshal(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded graph.Chat
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded.HydrateMessages(context.Background())
+
+	// Reorder the messages, and their links.
+	decoded.Messages[0], decoded.Messages[2] = decoded.Messages[2], decoded.Messages[0]
+	a := decoded.GetMessageByID("a")
+	a.Out[0], a.Out[1] = a.Out[1], a.Out[0]
+
+	if !chat.Equal(&decoded) {
+		t.Fatalf("expected graphs to be equal, got %+v", chat.Diff(&decoded))
+	}
+
+	decoded.GetMessageByID("b").Content = "changed"
+
+	if chat.Equal(&decoded) {
+		t.Fatal("expected graphs to not be equal")
+	}
+}
+
+func TestChatDiff(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	other := chat.Clone()
+	other.GetMessageByID("b").Content = "changed"
+	other.Messages = other.Messages[:2]
+	other.GetMessageByID("b").Out = nil
+	other.GetMessageByID("a").AddOutIn(graph.NewMessage(openai.ChatRoleAssistant, "added"))
+
+	diff := chat.Diff(other)
+
+	if len(diff.Added) != 1 || diff.Added[0].Content != "added" {
+		t.Fatalf("expected 1 added message, got %v", diff.Added)
+	}
+
+	if ids := strings.Join(diff.Removed.IDs(), ","); ids != "c" {
+		t.Fatalf("expected removed messages %q, got %q", "c", ids)
+	}
+
+	var changed []string
+	for _, change := range diff.Changed {
+		changed = append(changed, change.Old.ID)
+	}
+
+	// "a" has a new "out" message, and "b" has new content.
+	if ids := strings.Join(changed, ","); ids != "a,b" {
+		t.Fatalf("expected changed messages %q, got %q", "a,b", ids)
+	}
+
+	if diff.Changed[1].New.Content != "changed" {
+		t.Fatalf("expected new content %q, got %q", "changed", diff.Changed[1].New.Content)
+	}
+}
@@ -0,0 +1,742 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RemoveOption configures the RemoveMessage method.
+type RemoveOption func(*removeOptions)
+
+type removeOptions struct {
+	reconnect bool
+}
+
+// WithReconnect is a RemoveOption that connects each of the removed message's
+// "in" messages to each of its "out" messages, so the conversation stays connected.
+// If either link along the removed path is weighted, the new link is weighted with
+// the sum of both weights. It's labeled with the label of the link to the removed
+// message, or else the label of the link from it, if either is labeled.
+func WithReconnect() RemoveOption {
+	return func(o *removeOptions) {
+		o.reconnect = true
+	}
+}
+
+// RemoveMessage removes the message with the given ID from the graph, including
+// every reference to it from the "in" and "out" messages of other messages.
+//
+// Messages that were only reachable through the removed message are kept in the
+// graph by adding them to the top-level messages. The removed message itself is
+// left untouched, so it can still be inspected (e.g. to archive it).
+func (graph *Chat) RemoveMessage(id string, opts ...RemoveOption) error {
+	var o removeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	msg, err := graph.findMessage(id)
+	if err != nil {
+		return err
+	}
+
+	graph.removeMessage(msg, o)
+
+	return nil
+}
+
+// Splice removes the message with the given ID from the graph, like RemoveMessage
+// with the WithReconnect option, connecting each of its "in" messages directly to
+// each of its "out" messages, in both directions, without duplicating existing
+// links, such as to hide an intermediate message without breaking the thread.
+func (graph *Chat) Splice(id string) error {
+	return graph.RemoveMessage(id, WithReconnect())
+}
+
+// removeMessage removes the given message from the graph, see RemoveMessage.
+func (graph *Chat) removeMessage(msg *Message, o removeOptions) {
+	removed := map[*Message]bool{msg: true}
+
+	parents, children := graph.linkedTo(Messages{msg}, removed)
+
+	if o.reconnect {
+		for _, parent := range parents {
+			for _, child := range children {
+				if !parent.Out.contains(child) {
+					parent.Out = append(parent.Out, child)
+
+					// A new link replacing a weighted path weighs as much as
+					// the path, so the shortest paths through it are kept.
+					_, weightedIn := parent.OutWeights[msg.ID]
+					_, weightedOut := msg.OutWeights[child.ID]
+					if weightedIn || weightedOut {
+						parent.setOutWeight(child.ID, parent.OutWeight(msg)+msg.OutWeight(child))
+					}
+
+					// The label of the link into the message takes precedence,
+					// since it describes why the conversation took that path.
+					if label, ok := parent.OutLabels[msg.ID]; ok {
+						parent.setOutLabel(child.ID, label)
+					} else if label, ok := msg.OutLabels[child.ID]; ok {
+						parent.setOutLabel(child.ID, label)
+					}
+				}
+				if !child.In.contains(parent) {
+					child.In = append(child.In, parent)
+				}
+			}
+		}
+	}
+
+	graph.unlink(removed, parents, children)
+}
+
+// removeMessages removes the given messages from the graph, like removeMessage
+// without reconnecting them, all at once, so the graph is only traversed once,
+// however many messages are removed (e.g. when pruning a long history).
+func (graph *Chat) removeMessages(msgs Messages) {
+	removed := make(map[*Message]bool, len(msgs))
+	for _, msg := range msgs {
+		removed[msg] = true
+	}
+
+	if len(removed) == 0 {
+		return
+	}
+
+	parents, children := graph.linkedTo(msgs, removed)
+
+	graph.unlink(removed, parents, children)
+}
+
+// linkedTo returns the messages, other than the removed ones (the given messages,
+// as a set), linked to any removed message (parents), or from one (children), in
+// either direction, since not every application keeps the "in" and "out" links
+// symmetric.
+func (graph *Chat) linkedTo(msgs Messages, removed map[*Message]bool) (parents, children Messages) {
+	isParent, isChild := map[*Message]bool{}, map[*Message]bool{}
+
+	addParent := func(msg *Message) {
+		if msg != nil && !removed[msg] && !isParent[msg] {
+			isParent[msg] = true
+			parents = append(parents, msg)
+		}
+	}
+
+	addChild := func(msg *Message) {
+		if msg != nil && !removed[msg] && !isChild[msg] {
+			isChild[msg] = true
+			children = append(children, msg)
+		}
+	}
+
+	// The links of the removed messages themselves come first, in order.
+	for _, msg := range msgs {
+		for _, in := range msg.In {
+			addParent(in)
+		}
+		for _, out := range msg.Out {
+			addChild(out)
+		}
+	}
+
+	for _, node := range graph.nodes() {
+		if removed[node] {
+			continue
+		}
+		if slices.ContainsFunc(node.Out, func(m *Message) bool { return removed[m] }) {
+			addParent(node)
+		}
+		if slices.ContainsFunc(node.In, func(m *Message) bool { return removed[m] }) {
+			addChild(node)
+		}
+	}
+
+	return parents, children
+}
+
+// unlink removes every reference to the removed messages from the graph, and
+// from their parents and children, see linkedTo. Messages that are no longer
+// reachable from the top-level messages are kept by adding them to the
+// top-level messages.
+func (graph *Chat) unlink(removed map[*Message]bool, parents, children Messages) {
+	graph.Messages = graph.Messages.withoutAll(removed)
+
+	for _, node := range append(parents, children...) {
+		node.In = node.In.withoutAll(removed)
+		node.Out = node.Out.withoutAll(removed)
+		node.pruneOutAttributes()
+	}
+
+	// Keep any messages that are no longer reachable from the top-level messages.
+	seen := NewMessageSet()
+	for _, node := range graph.Messages {
+		_ = VisitMessages(context.Background(), node, seen, func(*Message) error { return nil })
+	}
+
+	for _, child := range children {
+		if seen.Has(child) {
+			continue
+		}
+
+		graph.Messages = append(graph.Messages, child)
+
+		_ = VisitMessages(context.Background(), child, seen, func(*Message) error { return nil })
+	}
+}
+
+// Clone returns a deep copy of the graph, where every message is copied
+// and the "in" and "out" messages of each copy point to the other copies,
+// not the original messages, so the copy can be modified independently.
+func (graph *Chat) Clone() *Chat {
+	return &Chat{
+		ID:       graph.ID,
+		Name:     graph.Name,
+		Messages: cloneMessages(graph.Messages, map[*Message]*Message{}),
+	}
+}
+
+// cloneMessages returns deep copies of the given messages, including every
+// message reachable through their "in" and "out" messages. The clones map
+// tracks the original to copied messages to preserve shared references,
+// and cycles, between the copies.
+func cloneMessages(msgs Messages, clones map[*Message]*Message) Messages {
+	var queue Messages
+
+	get := func(msg *Message) *Message {
+		if msg == nil {
+			return nil
+		}
+
+		if clone, ok := clones[msg]; ok {
+			return clone
+		}
+
+		clone := msg.copyWithoutEdges()
+
+		clones[msg] = clone
+		queue = append(queue, msg)
+
+		return clone
+	}
+
+	result := make(Messages, len(msgs))
+	for i, msg := range msgs {
+		result[i] = get(msg)
+	}
+
+	for len(queue) > 0 {
+		msg := queue[0]
+		queue = queue[1:]
+
+		clone := clones[msg]
+
+		if msg.In != nil {
+			clone.In = make(Messages, len(msg.In))
+			for i, in := range msg.In {
+				clone.In[i] = get(in)
+			}
+		}
+
+		if msg.Out != nil {
+			clone.Out = make(Messages, len(msg.Out))
+			for i, out := range msg.Out {
+				clone.Out[i] = get(out)
+			}
+		}
+	}
+
+	return result
+}
+
+// Symmetrize makes every link between messages bi-directional, so that for
+// every "out" message, the message is in its "in" messages, and vice versa,
+// just like linking every message with AddInOut or AddOutIn.
+//
+// Duplicate links are removed, keeping the first occurrence.
+func (graph *Chat) Symmetrize() {
+	nodes := graph.nodes()
+
+	// Messages only referenced through "in" messages aren't reachable
+	// from the top-level messages, but need to be updated too.
+	touched := NewMessageSet()
+	for _, msg := range nodes {
+		touched.Add(msg)
+	}
+
+	for i := 0; i < len(nodes); i++ {
+		msg := nodes[i]
+
+		for _, in := range msg.In {
+			if in != nil && !touched.Has(in) {
+				touched.Add(in)
+				nodes = append(nodes, in)
+			}
+		}
+	}
+
+	for _, msg := range nodes {
+		for _, in := range msg.In {
+			if in != nil && !in.Out.contains(msg) {
+				in.Out = append(in.Out, msg)
+			}
+		}
+
+		for _, out := range msg.Out {
+			if out != nil && !out.In.contains(msg) {
+				out.In = append(out.In, msg)
+			}
+		}
+	}
+
+	for _, msg := range nodes {
+		msg.In = msg.In.dedupe()
+		msg.Out = msg.Out.dedupe()
+	}
+}
+
+// dedupe returns the messages without duplicates (or nil messages),
+// keeping the first occurrence of each message.
+func (msgs Messages) dedupe() Messages {
+	if msgs == nil {
+		return nil
+	}
+
+	seen := make(map[*Message]struct{}, len(msgs))
+	unique := make(Messages, 0, len(msgs))
+
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		if _, ok := seen[msg]; ok {
+			continue
+		}
+		seen[msg] = struct{}{}
+		unique = append(unique, msg)
+	}
+
+	return unique
+}
+
+// copyWithoutEdges returns a copy of the message, without any "in" or "out" messages.
+// The metadata map is copied, but not its values.
+func (m *Message) copyWithoutEdges() *Message {
+	return &Message{
+		ID:          m.ID,
+		ChatMessage: m.ChatMessage,
+		Embedding:   slices.Clone(m.Embedding),
+		CreatedAt:   m.CreatedAt,
+		Metadata:    maps.Clone(m.Metadata),
+		Tags:        slices.Clone(m.Tags),
+		OutWeights:  maps.Clone(m.OutWeights),
+		OutLabels:   maps.Clone(m.OutLabels),
+	}
+}
+
+// Subgraph returns a new graph containing copies of only the messages for which
+// keep returns true, in depth-first order.
+//
+// Links between the kept messages are preserved, including links that went
+// through dropped messages: if a → b → c and b is dropped, then a → c in the
+// subgraph. This may connect messages that weren't directly connected before.
+// The original graph is not modified.
+func (graph *Chat) Subgraph(keep func(*Message) bool) *Chat {
+	sub := &Chat{
+		ID:   graph.ID,
+		Name: graph.Name,
+	}
+
+	nodes := graph.nodes()
+	kept := map[*Message]*Message{}
+
+	for _, msg := range nodes {
+		if keep(msg) {
+			clone := msg.copyWithoutEdges()
+			kept[msg] = clone
+			sub.Messages = append(sub.Messages, clone)
+		}
+	}
+
+	// nearest returns the copies of the closest kept messages in the given
+	// direction, skipping over any dropped messages in between.
+	nearest := func(msg *Message, next func(*Message) Messages) Messages {
+		var (
+			result   Messages
+			seenMsgs = NewMessageSet()
+			stack    Messages
+		)
+
+		seenMsgs.Add(msg)
+
+		push := func(msgs Messages) {
+			for i := len(msgs) - 1; i >= 0; i-- {
+				if msgs[i] != nil {
+					stack = append(stack, msgs[i])
+				}
+			}
+		}
+
+		push(next(msg))
+
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if seenMsgs.Has(top) {
+				continue
+			}
+			seenMsgs.Add(top)
+
+			if clone, ok := kept[top]; ok {
+				result = append(result, clone)
+				continue
+			}
+
+			push(next(top))
+		}
+
+		return result
+	}
+
+	for _, msg := range nodes {
+		clone, ok := kept[msg]
+		if !ok {
+			continue
+		}
+
+		clone.In = nearest(msg, func(m *Message) Messages { return m.In })
+		clone.Out = nearest(msg, func(m *Message) Messages { return m.Out })
+	}
+
+	return sub
+}
+
+// DedupByContent collapses messages with the same role and content, by their
+// ContentHash, into a single message (the first one, in depth-first order),
+// rewiring every link to the duplicates to the remaining message, and returns
+// the number of messages removed.
+func (graph *Chat) DedupByContent() int {
+	var (
+		survivors    = map[string]*Message{}
+		replacements = map[*Message]*Message{}
+	)
+
+	for _, msg := range graph.nodes() {
+		hash := msg.ContentHash()
+
+		if survivor, ok := survivors[hash]; ok {
+			replacements[msg] = survivor
+			continue
+		}
+
+		survivors[hash] = msg
+	}
+
+	graph.replaceMessages(replacements)
+
+	return len(replacements)
+}
+
+// replaceMessages removes each message in the given replacements map from the
+// graph, moving its links to its replacement, and rewiring every link to it
+// to point to its replacement instead. Replacements must not be replaced themselves.
+//
+// Links are deduplicated afterwards, and links between a message and its
+// replacement are dropped instead of becoming self-references.
+func (graph *Chat) replaceMessages(replacements map[*Message]*Message) {
+	if len(replacements) == 0 {
+		return
+	}
+
+	nodes := graph.nodes()
+
+	// Self-references that existed before are kept.
+	loops := NewMessageSet()
+	for _, msg := range nodes {
+		if msg.In.contains(msg) || msg.Out.contains(msg) {
+			loops.Add(msg)
+		}
+	}
+
+	// Move the links of each replaced message to its replacement.
+	for _, msg := range nodes {
+		if replacement, ok := replacements[msg]; ok {
+			replacement.In = append(replacement.In, msg.In...)
+			replacement.Out = append(replacement.Out, msg.Out...)
+		}
+	}
+
+	remap := func(msg *Message, msgs Messages) Messages {
+		remapped := make(Messages, 0, len(msgs))
+		for _, m := range msgs {
+			if replacement, ok := replacements[m]; ok {
+				m = replacement
+			}
+			if m == msg && !loops.Has(msg) {
+				continue
+			}
+			remapped = append(remapped, m)
+		}
+		return remapped.dedupe()
+	}
+
+	for _, msg := range nodes {
+		if _, ok := replacements[msg]; ok {
+			continue
+		}
+
+		msg.In = remap(msg, msg.In)
+		msg.Out = remap(msg, msg.Out)
+	}
+
+	graph.Messages = graph.Messages.Match(func(msg *Message) bool {
+		_, ok := replacements[msg]
+		return !ok
+	})
+}
+
+// Transpose returns a new graph with the direction of every link reversed,
+// by swapping the "in" and "out" messages of each message, so traversals
+// (e.g. Visit) follow the "in" messages instead, such as to visit ancestors.
+//
+// The original graph is not modified. Since the roots of the original graph
+// become leaves, every message is included in the top-level messages of the
+// transposed graph, in the original depth-first order.
+func (graph *Chat) Transpose() *Chat {
+	clones := map[*Message]*Message{}
+
+	transposed := &Chat{
+		ID:       graph.ID,
+		Name:     graph.Name,
+		Messages: cloneMessages(graph.nodes(), clones),
+	}
+
+	for _, clone := range clones {
+		clone.In, clone.Out = clone.Out, clone.In
+	}
+
+	return transposed
+}
+
+// ErrEdgeNotFound is returned when an expected link between two messages doesn't exist.
+var ErrEdgeNotFound = errors.New("edge not found")
+
+// InsertBetween inserts a new message on the existing link from the message with
+// the "from" ID to the message with the "to" ID, so from → to becomes from → new → to,
+// updating the "in" and "out" messages of all three messages.
+//
+// The new message is assigned an ID if it doesn't have one, and is added to the
+// top-level messages just before the "to" message, if it's a top-level message.
+// A weight or label on the replaced link moves to the link from the "from" message
+// to the new message.
+func (graph *Chat) InsertBetween(newMsg *Message, fromID, toID string) error {
+	from, err := graph.findMessage(fromID)
+	if err != nil {
+		return err
+	}
+
+	to, err := graph.findMessage(toID)
+	if err != nil {
+		return err
+	}
+
+	i := indexOf(from.Out, to)
+	if i < 0 {
+		return fmt.Errorf("%w: from %q to %q", ErrEdgeNotFound, fromID, toID)
+	}
+
+	if newMsg.ID == "" {
+		newMsg.ID = newID()
+	}
+
+	// Replace the links in place, to preserve the order of the other links.
+	from.Out[i] = newMsg
+
+	if weight, ok := from.OutWeights[to.ID]; ok {
+		delete(from.OutWeights, to.ID)
+		from.setOutWeight(newMsg.ID, weight)
+	}
+	if label, ok := from.OutLabels[to.ID]; ok {
+		delete(from.OutLabels, to.ID)
+		from.setOutLabel(newMsg.ID, label)
+	}
+
+	if j := indexOf(to.In, from); j >= 0 {
+		to.In[j] = newMsg
+	} else {
+		to.In = append(to.In, newMsg)
+	}
+
+	newMsg.In = append(newMsg.In, from)
+	newMsg.Out = append(newMsg.Out, to)
+
+	if j := indexOf(graph.Messages, to); j >= 0 {
+		graph.Messages = append(graph.Messages[:j], append(Messages{newMsg}, graph.Messages[j:]...)...)
+	} else {
+		graph.Messages = append(graph.Messages, newMsg)
+	}
+
+	return nil
+}
+
+// indexOf returns the index of the first occurrence of the message, or -1.
+func indexOf(msgs Messages, msg *Message) int {
+	for i, m := range msgs {
+		if m == msg {
+			return i
+		}
+	}
+	return -1
+}
+
+// ReplaceAll replaces every occurrence of old with new in the content of
+// every message in the graph, and returns the total number of replacements.
+// If old is empty, nothing is replaced.
+func (graph *Chat) ReplaceAll(old, new string) int {
+	if old == "" {
+		return 0
+	}
+
+	var replaced int
+
+	for _, msg := range graph.nodes() {
+		if n := strings.Count(msg.Content, old); n > 0 {
+			msg.Content = strings.ReplaceAll(msg.Content, old, new)
+			replaced += n
+		}
+	}
+
+	return replaced
+}
+
+// ReplaceAllRegexp replaces every match of the regular expression with repl
+// in the content of every message in the graph, like regexp.ReplaceAllString
+// (so repl can refer to submatches, e.g. $1), and returns the total number of
+// replacements.
+func (graph *Chat) ReplaceAllRegexp(re *regexp.Regexp, repl string) int {
+	var replaced int
+
+	for _, msg := range graph.nodes() {
+		if n := len(re.FindAllStringIndex(msg.Content, -1)); n > 0 {
+			msg.Content = re.ReplaceAllString(msg.Content, repl)
+			replaced += n
+		}
+	}
+
+	return replaced
+}
+
+// ErrMessageExists is returned when a message is added to a graph it's already in.
+var ErrMessageExists = errors.New("message already in graph")
+
+// AppendOption configures the AppendLinked method.
+type AppendOption func(*appendOptions)
+
+type appendOptions struct {
+	leaves bool
+}
+
+// WithLeaves is an AppendOption that links the appended message to every
+// message without any "out" messages (the leaves), such as the latest message
+// of each branch, instead of only the last top-level message.
+func WithLeaves() AppendOption {
+	return func(o *appendOptions) {
+		o.leaves = true
+	}
+}
+
+// AppendLinked adds a message to the graph with AddMessage, assigning it an ID
+// if it doesn't have one, linked with AddInOut to the last top-level message
+// before it, if any, which is the everyday case of continuing a conversation.
+//
+// Use the WithLeaves option to link it to every leaf message instead. An
+// ErrMessageExists error is returned if the message is already in the graph.
+func (graph *Chat) AppendLinked(msg *Message, opts ...AppendOption) error {
+	var o appendOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	nodes := graph.nodes()
+
+	if nodes.contains(msg) {
+		return fmt.Errorf("%w: message %q", ErrMessageExists, msg.ID)
+	}
+
+	var parents Messages
+
+	switch {
+	case o.leaves:
+		parents = nodes.Match(func(m *Message) bool {
+			return len(m.Out) == 0
+		})
+	case len(graph.Messages) > 0:
+		parents = graph.Messages[len(graph.Messages)-1:]
+	}
+
+	for _, parent := range parents {
+		msg.AddInOut(parent)
+	}
+
+	graph.AddMessage(msg)
+
+	return nil
+}
+
+// CollapseConsecutive merges each run of consecutive messages with the same
+// role along a linear thread into its first message, joining their content with
+// the given separator, and returns the number of messages merged away, such as
+// to normalize a single turn split into many messages by its source.
+//
+// A message is only merged into the one before it if it's that message's only
+// "out" message, and that message is its only "in" message, so branches aren't
+// changed. The first message of a run keeps its ID, and other fields, and takes
+// over the "out" messages of the last one, including their weights and labels.
+func (graph *Chat) CollapseConsecutive(separator string) int {
+	var (
+		merged  int
+		removed = NewMessageSet()
+	)
+
+	for _, msg := range graph.nodes() {
+		if removed.Has(msg) {
+			continue
+		}
+
+		for len(msg.Out) == 1 {
+			next := msg.Out[0]
+
+			if next == nil || next == msg || next.Role != msg.Role || len(next.In) != 1 || next.In[0] != msg || next.Out.contains(msg) {
+				break
+			}
+
+			msg.Content += separator + next.Content
+
+			// Take over the "out" messages of the merged message.
+			for _, out := range next.Out {
+				if out == nil {
+					continue
+				}
+				if i := indexOf(out.In, next); i >= 0 {
+					out.In[i] = msg
+				}
+			}
+
+			msg.Out = next.Out
+			msg.OutWeights = next.OutWeights
+			msg.OutLabels = next.OutLabels
+
+			graph.Messages = graph.Messages.without(next)
+			removed.Add(next)
+			merged++
+		}
+	}
+
+	return merged
+}
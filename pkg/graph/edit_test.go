@@ -0,0 +1,638 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// newTestThread returns a chat graph containing a linear thread of messages
+// with the given IDs, linked together with AddOutIn.
+func newTestThread(ids ...string) *graph.Chat {
+	chat := &graph.Chat{
+		ID:   "chat-1",
+		Name: "Test Chat",
+	}
+
+	var prev *graph.Message
+
+	for i, id := range ids {
+		role := openai.ChatRoleUser
+		if i%2 == 1 {
+			role = openai.ChatRoleAssistant
+		}
+
+		msg := &graph.Message{
+			ID: id,
+			ChatMessage: openai.ChatMessage{
+				Role:    role,
+				Content: "message " + id,
+			},
+		}
+
+		if prev != nil {
+			prev.AddOutIn(msg)
+		}
+
+		chat.Messages = append(chat.Messages, msg)
+		prev = msg
+	}
+
+	return chat
+}
+
+func TestChatRemoveMessage(t *testing.T) {
+	t.Run("not found", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+
+		err := chat.RemoveMessage("z")
+		if !errors.Is(err, graph.ErrMessageNotFound) {
+			t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+
+		if err := chat.RemoveMessage("b"); err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := strings.Join(chat.Messages.IDs(), ","); ids != "a,c" {
+			t.Fatalf("expected messages %q, got %q", "a,c", ids)
+		}
+
+		a, c := chat.GetMessageByID("a"), chat.GetMessageByID("c")
+		if len(a.Out) != 0 || len(c.In) != 0 {
+			t.Fatalf("expected no edges, got a.Out=%v c.In=%v", a.Out.IDs(), c.In.IDs())
+		}
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+
+		if err := chat.RemoveMessage("b", graph.WithReconnect()); err != nil {
+			t.Fatal(err)
+		}
+
+		a, c := chat.GetMessageByID("a"), chat.GetMessageByID("c")
+		if ids := strings.Join(a.Out.IDs(), ","); ids != "c" {
+			t.Fatalf("expected a.Out %q, got %q", "c", ids)
+		}
+		if ids := strings.Join(c.In.IDs(), ","); ids != "a" {
+			t.Fatalf("expected c.In %q, got %q", "a", ids)
+		}
+	})
+
+	t.Run("root", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+		chat.Messages = chat.Messages[:1] // Only the root is a top-level message.
+
+		if err := chat.RemoveMessage("a"); err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := strings.Join(chat.Messages.IDs(), ","); ids != "b" {
+			t.Fatalf("expected messages %q, got %q", "b", ids)
+		}
+	})
+}
+
+func TestChatClone(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// Add a cycle back to the root.
+	chat.GetMessageByID("c").AddOutIn(chat.GetMessageByID("a"))
+
+	clone := chat.Clone()
+
+	if clone.ID != chat.ID || clone.Name != chat.Name {
+		t.Fatalf("expected clone of %q (%q), got %q (%q)", chat.ID, chat.Name, clone.ID, clone.Name)
+	}
+
+	if len(clone.Messages) != len(chat.Messages) {
+		t.Fatalf("expected %d messages, got %d", len(chat.Messages), len(clone.Messages))
+	}
+
+	originals := graph.NewMessageSet()
+	for _, msg := range chat.Messages {
+		originals.Add(msg)
+	}
+
+	for i, msg := range clone.Messages {
+		orig := chat.Messages[i]
+
+		if msg == orig {
+			t.Fatalf("expected message %q to be copied", msg.ID)
+		}
+
+		if msg.ID != orig.ID || msg.Role != orig.Role || msg.Content != orig.Content {
+			t.Fatalf("expected message %v, got %v", orig, msg)
+		}
+
+		for _, edges := range []struct{ clone, orig graph.Messages }{{msg.In, orig.In}, {msg.Out, orig.Out}} {
+			if strings.Join(edges.clone.IDs(), ",") != strings.Join(edges.orig.IDs(), ",") {
+				t.Fatalf("expected edges %v, got %v", edges.orig.IDs(), edges.clone.IDs())
+			}
+
+			for _, edge := range edges.clone {
+				if originals.Has(edge) {
+					t.Fatalf("expected edge %q of message %q to point to a copy", edge.ID, msg.ID)
+				}
+			}
+		}
+	}
+
+	// Modifying the clone must not modify the original.
+	clone.GetMessageByID("a").Content = "changed"
+
+	if chat.GetMessageByID("a").Content == "changed" {
+		t.Fatalf("expected original message to be unchanged")
+	}
+}
+
+func TestChatSymmetrize(t *testing.T) {
+	a := &graph.Message{ID: "a"}
+	b := &graph.Message{ID: "b"}
+	c := &graph.Message{ID: "c"}
+
+	// a → b is only known by a, b ← c is only known by c.
+	a.AddOut(b)
+	a.AddOut(b)
+	c.AddIn(b)
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{a, c},
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err == nil {
+		t.Fatalf("expected lopsided graph to be invalid")
+	}
+
+	chat.Symmetrize()
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both directions are now reachable.
+	if ids := strings.Join(a.Out.IDs(), ","); ids != "b" {
+		t.Fatalf("expected a.Out %q, got %q", "b", ids)
+	}
+	if ids := strings.Join(b.In.IDs(), ","); ids != "a" {
+		t.Fatalf("expected b.In %q, got %q", "a", ids)
+	}
+	if ids := strings.Join(b.Out.IDs(), ","); ids != "c" {
+		t.Fatalf("expected b.Out %q, got %q", "c", ids)
+	}
+	if ids := strings.Join(c.In.IDs(), ","); ids != "b" {
+		t.Fatalf("expected c.In %q, got %q", "b", ids)
+	}
+}
+
+func TestChatSubgraph(t *testing.T) {
+	// a (user) → b (assistant) → c (user) → d (assistant)
+	chat := newTestThread("a", "b", "c", "d")
+
+	sub := chat.Subgraph(func(m *graph.Message) bool {
+		return m.Role == openai.ChatRoleAssistant
+	})
+
+	if ids := strings.Join(sub.Messages.IDs(), ","); ids != "b,d" {
+		t.Fatalf("expected messages %q, got %q", "b,d", ids)
+	}
+
+	b, d := sub.GetMessageByID("b"), sub.GetMessageByID("d")
+
+	// b → d, skipping over c.
+	if len(b.Out) != 1 || b.Out[0] != d {
+		t.Fatalf("expected b.Out to be d, got %v", b.Out.IDs())
+	}
+	if len(d.In) != 1 || d.In[0] != b {
+		t.Fatalf("expected d.In to be b, got %v", d.In.IDs())
+	}
+	if len(b.In) != 0 || len(d.Out) != 0 {
+		t.Fatalf("expected no other edges, got b.In=%v d.Out=%v", b.In.IDs(), d.Out.IDs())
+	}
+
+	// The original graph is untouched.
+	if chat.GetMessageByID("b") == b {
+		t.Fatalf("expected subgraph messages to be copies")
+	}
+	if ids := strings.Join(chat.GetMessageByID("b").Out.IDs(), ","); ids != "c" {
+		t.Fatalf("expected original b.Out %q, got %q", "c", ids)
+	}
+}
+
+func TestChatDedupByContent(t *testing.T) {
+	question := graph.NewMessage(openai.ChatRoleUser, "Hello World!")
+	answer := graph.NewMessage(openai.ChatRoleAssistant, "Hello!")
+	duplicate := graph.NewMessage(openai.ChatRoleAssistant, "Hello!")
+	followUp := graph.NewMessage(openai.ChatRoleUser, "How are you?")
+
+	// The question was answered twice, with the same content.
+	question.AddOutIn(answer)
+	question.AddOutIn(duplicate)
+	duplicate.AddOutIn(followUp)
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{question, answer, duplicate, followUp},
+	}
+
+	if removed := chat.DedupByContent(); removed != 1 {
+		t.Fatalf("expected 1 message to be removed, got %d", removed)
+	}
+
+	if len(chat.Messages) != 3 || chat.GetMessageByID(duplicate.ID) != nil {
+		t.Fatalf("expected duplicate to be removed, got %v", chat.Messages.IDs())
+	}
+
+	if len(question.Out) != 1 || question.Out[0] != answer {
+		t.Fatalf("expected question to link to the answer once, got %v", question.Out.IDs())
+	}
+
+	if len(answer.Out) != 1 || answer.Out[0] != followUp {
+		t.Fatalf("expected answer to link to the follow up, got %v", answer.Out.IDs())
+	}
+
+	if len(followUp.In) != 1 || followUp.In[0] != answer {
+		t.Fatalf("expected follow up to link back to the answer, got %v", followUp.In.IDs())
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChatTranspose(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	chat.Messages = chat.Messages[:1] // Only the root is a top-level message.
+
+	transposed := chat.Transpose()
+
+	c := transposed.GetMessageByID("c")
+	if c == nil {
+		t.Fatalf("expected message %q to be a top-level message", "c")
+	}
+
+	// Visiting from the leaf now follows the ancestors.
+	var ids []string
+	err := graph.VisitMessages(context.Background(), c, graph.NewMessageSet(), func(m *graph.Message) error {
+		ids = append(ids, m.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(ids, ","); got != "c,b,a" {
+		t.Fatalf("expected ancestors %q, got %q", "c,b,a", got)
+	}
+
+	// The original graph is untouched.
+	if ids := strings.Join(chat.Messages[0].Out.IDs(), ","); ids != "b" {
+		t.Fatalf("expected original a.Out %q, got %q", "b", ids)
+	}
+}
+
+func TestChatInsertBetween(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	t.Run("missing edge", func(t *testing.T) {
+		err := chat.InsertBetween(&graph.Message{ID: "x"}, "a", "c")
+		if !errors.Is(err, graph.ErrEdgeNotFound) {
+			t.Fatalf("expected error %v, got %v", graph.ErrEdgeNotFound, err)
+		}
+	})
+
+	t.Run("inserted", func(t *testing.T) {
+		x := graph.NewMessage(openai.ChatRoleAssistant, "inserted")
+
+		if err := chat.InsertBetween(x, "a", "b"); err != nil {
+			t.Fatal(err)
+		}
+
+		a, b := chat.GetMessageByID("a"), chat.GetMessageByID("b")
+
+		if len(a.Out) != 1 || a.Out[0] != x {
+			t.Fatalf("expected a.Out to be the new message, got %v", a.Out.IDs())
+		}
+		if len(b.In) != 1 || b.In[0] != x {
+			t.Fatalf("expected b.In to be the new message, got %v", b.In.IDs())
+		}
+		if len(x.In) != 1 || x.In[0] != a || len(x.Out) != 1 || x.Out[0] != b {
+			t.Fatalf("expected new message to link a → new → b, got in=%v out=%v", x.In.IDs(), x.Out.IDs())
+		}
+
+		if ids := strings.Join(chat.Messages.IDs(), ","); ids != "a,"+x.ID+",b,c" {
+			t.Fatalf("unexpected messages %q", ids)
+		}
+
+		if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestChatInsertBetweenWeighted(t *testing.T) {
+	chat := newTestThread("a", "b")
+
+	a, b := chat.GetMessageByID("a"), chat.GetMessageByID("b")
+	a.Out = nil
+	b.In = nil
+	a.AddOutWeighted(b, 5)
+
+	x := &graph.Message{ID: "x"}
+	if err := chat.InsertBetween(x, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.OutWeights["b"]; ok {
+		t.Fatalf("expected the weight of the replaced link to be removed, got %v", a.OutWeights)
+	}
+	if w := a.OutWeight(x); w != 5 {
+		t.Fatalf("expected a → x weight 5, got %v", w)
+	}
+	if w := x.OutWeight(b); w != graph.DefaultEdgeWeight {
+		t.Fatalf("expected x → b default weight, got %v", w)
+	}
+}
+
+func TestChatReplaceAll(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// A message only reachable through another message.
+	chat.GetMessageByID("c").AddOutIn(&graph.Message{
+		ID: "d",
+		ChatMessage: openai.ChatMessage{
+			Role:    openai.ChatRoleUser,
+			Content: "message message",
+		},
+	})
+
+	if n := chat.ReplaceAll("message", "msg"); n != 5 {
+		t.Fatalf("expected 5 replacements, got %d", n)
+	}
+
+	if content := chat.GetMessageByID("a").Content; content != "msg a" {
+		t.Fatalf("expected content %q, got %q", "msg a", content)
+	}
+
+	if n := chat.ReplaceAll("", "x"); n != 0 {
+		t.Fatalf("expected no replacements, got %d", n)
+	}
+}
+
+func TestChatReplaceAllRegexp(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	n := chat.ReplaceAllRegexp(regexp.MustCompile(`message ([ab])`), "<$1>")
+	if n != 2 {
+		t.Fatalf("expected 2 replacements, got %d", n)
+	}
+
+	var contents []string
+	for _, msg := range chat.Messages {
+		contents = append(contents, msg.Content)
+	}
+
+	if got := strings.Join(contents, ","); got != "<a>,<b>,message c" {
+		t.Fatalf("expected contents %q, got %q", "<a>,<b>,message c", got)
+	}
+}
+
+func TestChatSplice(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// Two "in" and two "out" messages around "b", where "a" is already linked to "c".
+	a2 := &graph.Message{ID: "a2"}
+	c2 := &graph.Message{ID: "c2"}
+	b := chat.GetMessageByID("b")
+	a2.AddOutIn(b)
+	b.AddOutIn(c2)
+	chat.GetMessageByID("a").AddOutIn(chat.GetMessageByID("c"))
+	chat.AddMessage(a2)
+
+	if err := chat.Splice("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if chat.GetMessageByID("b") != nil {
+		t.Fatalf("expected b to be removed")
+	}
+
+	a, c := chat.GetMessageByID("a"), chat.GetMessageByID("c")
+
+	if ids := strings.Join(a.Out.IDs(), ","); ids != "c,c2" {
+		t.Fatalf("expected a.Out %q, got %q", "c,c2", ids)
+	}
+
+	if ids := strings.Join(a2.Out.IDs(), ","); ids != "c,c2" {
+		t.Fatalf("expected a2.Out %q, got %q", "c,c2", ids)
+	}
+
+	if ids := strings.Join(c.In.IDs(), ","); ids != "a,a2" {
+		t.Fatalf("expected c.In %q, got %q", "a,a2", ids)
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := chat.Splice("b"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+}
+
+func TestChatSpliceWeighted(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	a, b, c := chat.GetMessageByID("a"), chat.GetMessageByID("b"), chat.GetMessageByID("c")
+	a.Out, b.In, b.Out, c.In = nil, nil, nil, nil
+	a.AddOutWeighted(b, 5)
+	b.AddOutIn(c)
+
+	if err := chat.Splice("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.OutWeights["b"]; ok {
+		t.Fatalf("expected the weight of the removed link to be deleted, got %v", a.OutWeights)
+	}
+	if w := a.OutWeight(c); w != 5+graph.DefaultEdgeWeight {
+		t.Fatalf("expected a → c weight %v, got %v", 5+graph.DefaultEdgeWeight, w)
+	}
+
+	// Without any weights along the path, the new link stays unweighted.
+	chat = newTestThread("a", "b", "c")
+	if err := chat.Splice("b"); err != nil {
+		t.Fatal(err)
+	}
+	if a := chat.GetMessageByID("a"); len(a.OutWeights) != 0 {
+		t.Fatalf("expected no weights, got %v", a.OutWeights)
+	}
+}
+
+func TestChatRemoveMessageWeighted(t *testing.T) {
+	chat := newTestThread("a")
+
+	a := chat.GetMessageByID("a")
+	b := &graph.Message{ID: "b"}
+	a.AddOutWeighted(b, 5)
+
+	if err := chat.RemoveMessage("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.OutWeights) != 0 {
+		t.Fatalf("expected the weight of the removed link to be deleted, got %v", a.OutWeights)
+	}
+
+	// A new message with the same ID doesn't inherit the old weight.
+	a.AddOutIn(&graph.Message{ID: "b"})
+	if w := a.OutWeight(a.Out[0]); w != graph.DefaultEdgeWeight {
+		t.Fatalf("expected default weight, got %v", w)
+	}
+}
+
+func TestChatSpliceLabeled(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	a, b, c := chat.GetMessageByID("a"), chat.GetMessageByID("b"), chat.GetMessageByID("c")
+	a.Out, b.In, b.Out, c.In = nil, nil, nil, nil
+	a.AddOutIn(b)
+	b.AddOutLabeled(c, "retry")
+
+	if err := chat.Splice("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if l := a.OutLabel(c); l != "retry" {
+		t.Fatalf("expected a → c label %q, got %q", "retry", l)
+	}
+
+	// Removing a labeled link deletes its label.
+	a.AddOutLabeled(&graph.Message{ID: "d"}, "aside")
+	if err := chat.RemoveMessage("d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.OutLabels["d"]; ok {
+		t.Fatalf("expected the label of the removed link to be deleted, got %v", a.OutLabels)
+	}
+}
+
+func TestChatInsertBetweenLabeled(t *testing.T) {
+	chat := newTestThread("a", "b")
+
+	a, b := chat.GetMessageByID("a"), chat.GetMessageByID("b")
+	a.Out, b.In = nil, nil
+	a.AddOutLabeled(b, "retry")
+
+	x := &graph.Message{ID: "x"}
+	if err := chat.InsertBetween(x, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.OutLabels["b"]; ok {
+		t.Fatalf("expected the label of the replaced link to be removed, got %v", a.OutLabels)
+	}
+	if l := a.OutLabel(x); l != "retry" {
+		t.Fatalf("expected a → x label %q, got %q", "retry", l)
+	}
+}
+
+func TestChatAppendLinked(t *testing.T) {
+	chat := &graph.Chat{}
+
+	a := graph.NewMessage(openai.ChatRoleUser, "message a")
+	if err := chat.AppendLinked(a); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &graph.Message{ChatMessage: openai.ChatMessage{Role: openai.ChatRoleAssistant, Content: "message b"}}
+	if err := chat.AppendLinked(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.ID == "" || len(chat.Messages) != 2 || len(a.In) != 0 || a.Out[0] != b || b.In[0] != a {
+		t.Fatalf("expected b to be linked to a, got %+v", chat.Messages)
+	}
+
+	// Branch off of "a", then link a message to both branches.
+	c := graph.NewMessage(openai.ChatRoleAssistant, "message c")
+	a.AddOutIn(c)
+
+	d := graph.NewMessage(openai.ChatRoleUser, "message d")
+	if err := chat.AppendLinked(d, graph.WithLeaves()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.In) != 2 || d.In[0] != b || d.In[1] != c {
+		t.Fatalf("expected d to be linked to b and c, got %v", d.In)
+	}
+
+	if err := chat.AppendLinked(b); !errors.Is(err, graph.ErrMessageExists) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageExists, err)
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChatCollapseConsecutive(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// Split "b" into a run of assistant messages, with a branch at the end.
+	b, c := chat.GetMessageByID("b"), chat.GetMessageByID("c")
+	b.Out, c.In = nil, nil
+
+	b2 := &graph.Message{ID: "b2", ChatMessage: openai.ChatMessage{Role: openai.ChatRoleAssistant, Content: "message b2"}}
+	b3 := &graph.Message{ID: "b3", ChatMessage: openai.ChatMessage{Role: openai.ChatRoleAssistant, Content: "message b3"}}
+	c2 := &graph.Message{ID: "c2", ChatMessage: openai.ChatMessage{Role: openai.ChatRoleUser, Content: "message c2"}}
+	b.AddOutIn(b2)
+	b2.AddOutIn(b3)
+	b3.AddOutLabeled(c, "retry")
+	b3.AddOutIn(c2)
+
+	// A branch of an assistant message, which can't be collapsed.
+	b4 := &graph.Message{ID: "b4", ChatMessage: openai.ChatMessage{Role: openai.ChatRoleAssistant, Content: "message b4"}}
+	b3.AddOutIn(b4)
+
+	if n := chat.CollapseConsecutive("\n"); n != 2 {
+		t.Fatalf("expected 2 merged messages, got %d", n)
+	}
+
+	if b.Content != "message b\nmessage b2\nmessage b3" {
+		t.Fatalf("unexpected content %q", b.Content)
+	}
+
+	if ids := strings.Join(b.Out.IDs(), ","); ids != "c,c2,b4" {
+		t.Fatalf("expected b.Out %q, got %q", "c,c2,b4", ids)
+	}
+
+	if b.OutLabel(c) != "retry" || c.In[0] != b || b4.In[0] != b {
+		t.Fatalf("expected links to be taken over by b")
+	}
+
+	if chat.GetMessageByID("b2") != nil || chat.GetMessageByID("b3") != nil {
+		t.Fatalf("expected merged messages to be removed")
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := chat.CollapseConsecutive("\n"); n != 0 {
+		t.Fatalf("expected nothing left to merge, got %d", n)
+	}
+}
@@ -0,0 +1,194 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/picatz/openai"
+)
+
+// DefaultEmbeddingModel is the model used to embed messages by SemanticSearch.
+var DefaultEmbeddingModel = openai.ModelTextEmbeddingAda002
+
+// embed returns the embedding of the given text using the OpenAI embeddings API.
+func embed(ctx context.Context, client *openai.Client, model, text string) ([]float32, error) {
+	resp, err := client.CreateEmbedding(ctx, &openai.CreateEmbeddingRequest{
+		Model: model,
+		Input: text,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, errNoEmbedding
+	}
+
+	embedding := make([]float32, len(resp.Data[0].Embedding))
+	for i, v := range resp.Data[0].Embedding {
+		embedding[i] = float32(v)
+	}
+
+	return embedding, nil
+}
+
+// errNoEmbedding is returned when the OpenAI API responds without an embedding.
+var errNoEmbedding = errors.New("no embedding in response")
+
+// SemanticSearch searches every message in the graph for the ones most similar
+// in meaning to the given query, using the OpenAI embeddings API, which also
+// finds paraphrases that Search would miss.
+//
+// The query, and each message's content, are embedded with DefaultEmbeddingModel,
+// and the messages are ranked by the cosine similarity of their embeddings to the
+// query's, returned as the Score of each result. At most topK results are returned,
+// from most to least similar, or all of them if topK isn't positive.
+//
+// Message embeddings are cached in their Embedding field, using Embed, so only
+// messages without an embedding are embedded by repeated searches. Messages
+// without any content are skipped.
+//
+// Cached embeddings must come from the DefaultEmbeddingModel too, since those of
+// different models can't be compared. One with a different length than the
+// query's (e.g. embedded by MergeSimilar with another model) returns an
+// ErrDimensionMismatch error, instead of silently ranking its message last.
+// Clear the Embedding of such messages to embed them again.
+func (graph *Chat) SemanticSearch(ctx context.Context, client *openai.Client, query string, topK int) ([]*SearchResult, error) {
+	queryEmbedding, err := embed(ctx, client, DefaultEmbeddingModel, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed search query: %w", err)
+	}
+
+	var results []*SearchResult
+
+	nodes := graph.nodes()
+
+	if err := nodes.Embed(ctx, client, DefaultEmbeddingModel); err != nil {
+		return nil, err
+	}
+
+	for i, msg := range nodes {
+		if msg.Content == "" {
+			continue
+		}
+
+		if len(msg.Embedding) != len(queryEmbedding) {
+			return nil, fmt.Errorf("%w: message %q has %d dimensions, the query has %d", ErrDimensionMismatch, msg.ID, len(msg.Embedding), len(queryEmbedding))
+		}
+
+		results = append(results, &SearchResult{
+			Message:      msg,
+			MessageIndex: i,
+			StartIndex:   0,
+			EndIndex:     len(msg.Content),
+			Score:        CosineSimilarity(queryEmbedding, msg.Embedding),
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if topK > 0 && len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results, nil
+}
+
+// Embed populates the Embedding of every message without one, by embedding its
+// content with the given model using the OpenAI embeddings API, so new messages
+// can be embedded incrementally. Messages without any content are skipped.
+func (msgs Messages) Embed(ctx context.Context, client *openai.Client, model string) error {
+	for _, msg := range msgs {
+		if msg.Embedding != nil || msg.Content == "" {
+			continue
+		}
+
+		embedding, err := embed(ctx, client, model, msg.Content)
+		if err != nil {
+			return fmt.Errorf("failed to embed message %q: %w", msg.ID, err)
+		}
+
+		msg.Embedding = embedding
+	}
+
+	return nil
+}
+
+// Similarity returns the cosine similarity of the message's embedding to the
+// other message's embedding, or 0 if either message doesn't have one.
+func (m *Message) Similarity(other *Message) float64 {
+	return CosineSimilarity(m.Embedding, other.Embedding)
+}
+
+// CosineSimilarity returns the cosine similarity of the given vectors, from -1
+// (opposite) to 1 (same direction), or 0 if either is empty, zero, or they have
+// different lengths.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// MergeSimilar merges messages with the same role whose content means nearly the
+// same, such as regenerated answers that are worded slightly differently, into a
+// single message, like DedupByContent, and returns the number of messages merged.
+//
+// Every message is embedded with the given model using Embed, if it isn't
+// already, then each message is merged into the first message before it, in
+// depth-first order, with a Similarity of at least the given threshold (e.g.
+// 0.95), so the first message of each cluster remains, with every link to the
+// others rewired to it. Messages without any content aren't merged.
+func (graph *Chat) MergeSimilar(ctx context.Context, client *openai.Client, model string, threshold float64) (int, error) {
+	nodes := graph.nodes()
+
+	if err := nodes.Embed(ctx, client, model); err != nil {
+		return 0, err
+	}
+
+	var (
+		survivors    Messages
+		replacements = map[*Message]*Message{}
+	)
+
+	for _, msg := range nodes {
+		if msg.Embedding == nil {
+			continue
+		}
+
+		var merged bool
+
+		for _, survivor := range survivors {
+			if survivor.Role == msg.Role && survivor.Similarity(msg) >= threshold {
+				replacements[msg] = survivor
+				merged = true
+				break
+			}
+		}
+
+		if !merged {
+			survivors = append(survivors, msg)
+		}
+	}
+
+	graph.replaceMessages(replacements)
+
+	return len(replacements), nil
+}
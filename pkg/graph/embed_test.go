@@ -0,0 +1,189 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// testEmbedding returns a tiny, fake, embedding of the given text, with
+// a dimension for each of a few topics.
+func testEmbedding(text string) []float64 {
+	embedding := make([]float64, 3)
+	for i, topics := range [][]string{
+		{"dragon", "wyvern"},
+		{"sword", "blade"},
+		{"wall", "ice"},
+	} {
+		for _, topic := range topics {
+			embedding[i] += float64(strings.Count(strings.ToLower(text), topic))
+		}
+	}
+	return embedding
+}
+
+func TestChatSemanticSearch(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	chat.GetMessageByID("a").Content = "Tell me about the dragons."
+	chat.GetMessageByID("b").Content = "Valyrian steel blades can kill White Walkers."
+	chat.GetMessageByID("c").Content = "What about the Wall and its ice?"
+
+	var requests int
+
+	client := newTestEmbeddingClient(t, func(input string) []float64 {
+		requests++
+		return testEmbedding(input)
+	})
+
+	results, err := chat.SemanticSearch(context.Background(), client, "Which sword is best?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	if results[0].Message.ID != "b" || results[0].Score < 0.99 {
+		t.Fatalf("expected best result to be b, got %q with score %v", results[0].Message.ID, results[0].Score)
+	}
+
+	if results[1].Score > results[0].Score {
+		t.Fatalf("expected results ordered by score")
+	}
+
+	// The query, and the three messages.
+	if requests != 4 {
+		t.Fatalf("expected 4 embedding requests, got %d", requests)
+	}
+
+	// Only the query is embedded again, since message embeddings are cached.
+	if _, err := chat.SemanticSearch(context.Background(), client, "wyverns", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 5 {
+		t.Fatalf("expected 5 embedding requests, got %d", requests)
+	}
+
+	if len(chat.GetMessageByID("a").Embedding) != 3 {
+		t.Fatalf("expected message embedding to be cached")
+	}
+
+	// An embedding cached from another model can't be compared to the query's.
+	chat.GetMessageByID("b").Embedding = []float32{1, 0}
+
+	if _, err := chat.SemanticSearch(context.Background(), client, "wyverns", 0); !errors.Is(err, graph.ErrDimensionMismatch) {
+		t.Fatalf("expected error %v, got %v", graph.ErrDimensionMismatch, err)
+	}
+}
+
+func TestMessagesEmbed(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// Already embedded, and empty, messages are skipped.
+	chat.GetMessageByID("a").Embedding = []float32{1, 0, 0}
+	chat.GetMessageByID("c").Content = ""
+
+	var inputs []string
+
+	client := newTestEmbeddingClient(t, func(input string) []float64 {
+		inputs = append(inputs, input)
+		return []float64{0, 1, 0}
+	})
+
+	if err := chat.Messages.Embed(context.Background(), client, openai.ModelTextEmbeddingAda002); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(inputs, ","); got != "message b" {
+		t.Fatalf("expected only %q to be embedded, got %q", "message b", got)
+	}
+
+	a, b := chat.GetMessageByID("a"), chat.GetMessageByID("b")
+
+	if len(b.Embedding) != 3 || b.Embedding[1] != 1 {
+		t.Fatalf("unexpected embedding %v", b.Embedding)
+	}
+
+	if similarity := a.Similarity(b); similarity != 0 {
+		t.Fatalf("expected similarity of 0, got %v", similarity)
+	}
+
+	if similarity := a.Similarity(a); similarity != 1 {
+		t.Fatalf("expected similarity of 1, got %v", similarity)
+	}
+
+	if similarity := a.Similarity(chat.GetMessageByID("c")); similarity != 0 {
+		t.Fatalf("expected similarity of 0 without an embedding, got %v", similarity)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 2}, []float32{2, 4}, 1},
+		{[]float32{1, 0}, []float32{-1, 0}, -1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+		{nil, nil, 0},
+		{[]float32{0, 0}, []float32{1, 1}, 0},
+	}
+
+	for _, test := range tests {
+		if got := graph.CosineSimilarity(test.a, test.b); math.Abs(got-test.want) > 1e-9 {
+			t.Fatalf("expected similarity of %v and %v to be %v, got %v", test.a, test.b, test.want, got)
+		}
+	}
+}
+
+func TestChatMergeSimilar(t *testing.T) {
+	question := graph.NewMessage(openai.ChatRoleUser, "Which sword should I use?")
+	answer := graph.NewMessage(openai.ChatRoleAssistant, "A Valyrian steel sword.")
+	regenerated := graph.NewMessage(openai.ChatRoleAssistant, "Use a Valyrian steel blade.")
+	different := graph.NewMessage(openai.ChatRoleAssistant, "Stay behind the Wall.")
+	followUp := graph.NewMessage(openai.ChatRoleUser, "Where can I find one?")
+
+	// The question was answered three times, twice with a similar answer.
+	question.AddOutIn(answer)
+	question.AddOutIn(regenerated)
+	question.AddOutIn(different)
+	regenerated.AddOutIn(followUp)
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{question},
+	}
+
+	client := newTestEmbeddingClient(t, testEmbedding)
+
+	merged, err := chat.MergeSimilar(context.Background(), client, openai.ModelTextEmbeddingAda002, 0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The question is about swords too, but isn't merged, since it's not an answer.
+	if merged != 1 {
+		t.Fatalf("expected 1 merged message, got %d", merged)
+	}
+
+	if ids := strings.Join(question.Out.IDs(), ","); ids != answer.ID+","+different.ID {
+		t.Fatalf("expected question to link to the answer, and the different answer, got %q", ids)
+	}
+
+	if len(answer.Out) != 1 || answer.Out[0] != followUp || followUp.In[0] != answer {
+		t.Fatalf("expected the follow up to be rewired to the answer")
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,241 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/picatz/openai"
+)
+
+// ErrDimensionMismatch is returned when an embedding doesn't have the same
+// number of dimensions as the others in an EmbeddingIndex, or as the query of
+// a SemanticSearch.
+var ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// EmbeddingIndexOptions configures an EmbeddingIndex. The zero value uses
+// the defaults of each option.
+type EmbeddingIndexOptions struct {
+	// Tables is the number of hash tables, which is 8 if unset. More tables
+	// find more of the true nearest neighbors, but use more memory.
+	Tables int
+
+	// Bits is the number of random hyperplanes hashing the embeddings in each
+	// table, which is 12 if unset. More bits make smaller buckets, so queries
+	// are faster, but find fewer of the true nearest neighbors.
+	Bits int
+
+	// Seed seeds the random hyperplanes, so an index is reproducible.
+	Seed uint64
+}
+
+// EmbeddingIndex is an approximate nearest-neighbor index of message embeddings,
+// using locality-sensitive hashing (LSH) with random hyperplanes, which finds
+// similar messages without comparing the query to every message, unlike
+// SemanticSearch, such as to search tens of thousands of messages.
+//
+// Each table hashes an embedding to a bucket, by which side of each of its
+// random hyperplanes it's on, so embeddings with a small angle between them
+// (i.e. a high cosine similarity) are likely in the same bucket of at least
+// one table. A query only compares the messages in its buckets, and in the
+// buckets one hyperplane away, if needed.
+//
+// An EmbeddingIndex isn't safe for concurrent use.
+type EmbeddingIndex struct {
+	opts EmbeddingIndexOptions
+
+	// The number of dimensions of the embeddings, known from the first one added.
+	dims int
+
+	msgs   Messages
+	tables []lshTable
+}
+
+// lshTable is a single hash table of an EmbeddingIndex.
+type lshTable struct {
+	planes  [][]float32
+	buckets map[uint64][]int
+}
+
+// NewEmbeddingIndex returns a new, empty, embedding index.
+func NewEmbeddingIndex(opts EmbeddingIndexOptions) *EmbeddingIndex {
+	if opts.Tables <= 0 {
+		opts.Tables = 8
+	}
+
+	if opts.Bits <= 0 {
+		opts.Bits = 12
+	}
+
+	// Hashes are stored in a uint64.
+	opts.Bits = min(opts.Bits, 64)
+
+	return &EmbeddingIndex{opts: opts}
+}
+
+// BuildEmbeddingIndex returns a new embedding index of every message in the
+// graph with content, embedding the messages without an embedding with the
+// given model, using Embed.
+func (graph *Chat) BuildEmbeddingIndex(ctx context.Context, client *openai.Client, model string) (*EmbeddingIndex, error) {
+	nodes := graph.nodes()
+
+	if err := nodes.Embed(ctx, client, model); err != nil {
+		return nil, err
+	}
+
+	index := NewEmbeddingIndex(EmbeddingIndexOptions{})
+
+	for _, msg := range nodes {
+		if err := index.Add(msg); err != nil {
+			return nil, err
+		}
+	}
+
+	return index, nil
+}
+
+// Len returns the number of messages in the index.
+func (idx *EmbeddingIndex) Len() int {
+	return len(idx.msgs)
+}
+
+// Add adds the message to the index, by its Embedding, which is skipped if
+// it doesn't have one. An ErrDimensionMismatch error is returned if it has a
+// different number of dimensions than the embeddings already in the index.
+//
+// It doesn't depend on the number of messages already in the index, so the
+// index can be kept up to date as a conversation grows (e.g. with OnAddMessage),
+// without rebuilding it.
+func (idx *EmbeddingIndex) Add(msg *Message) error {
+	if len(msg.Embedding) == 0 {
+		return nil
+	}
+
+	if idx.tables == nil {
+		idx.init(len(msg.Embedding))
+	}
+
+	if len(msg.Embedding) != idx.dims {
+		return fmt.Errorf("%w: message %q has %d dimensions, but the index has %d", ErrDimensionMismatch, msg.ID, len(msg.Embedding), idx.dims)
+	}
+
+	i := len(idx.msgs)
+	idx.msgs = append(idx.msgs, msg)
+
+	for _, table := range idx.tables {
+		hash := table.hash(msg.Embedding)
+		table.buckets[hash] = append(table.buckets[hash], i)
+	}
+
+	return nil
+}
+
+// init creates the random hyperplanes of each table, for embeddings
+// with the given number of dimensions.
+func (idx *EmbeddingIndex) init(dims int) {
+	rng := rand.New(rand.NewPCG(idx.opts.Seed, uint64(dims)))
+
+	idx.dims = dims
+	idx.tables = make([]lshTable, idx.opts.Tables)
+
+	for t := range idx.tables {
+		planes := make([][]float32, idx.opts.Bits)
+		for p := range planes {
+			planes[p] = make([]float32, dims)
+			for d := range planes[p] {
+				planes[p][d] = float32(rng.NormFloat64())
+			}
+		}
+
+		idx.tables[t] = lshTable{
+			planes:  planes,
+			buckets: map[uint64][]int{},
+		}
+	}
+}
+
+// hash returns the bucket of the vector, with a bit for each hyperplane,
+// set if the vector is on its positive side.
+func (t lshTable) hash(vec []float32) uint64 {
+	var hash uint64
+	for i, plane := range t.planes {
+		var dot float32
+		for d, v := range vec {
+			dot += plane[d] * v
+		}
+		if dot > 0 {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// Query returns the (approximately) topK messages in the index most similar to
+// the given embedding, from most to least similar, with the cosine similarity
+// of their embeddings as the Score of each result, like SemanticSearch. The
+// MessageIndex of each result is the order the message was added to the index.
+//
+// Fewer than topK results may be returned, even if the index has more messages,
+// since only the messages hashed near the embedding are compared to it.
+func (idx *EmbeddingIndex) Query(vec []float32, topK int) []*SearchResult {
+	if len(vec) != idx.dims || topK <= 0 {
+		return nil
+	}
+
+	var (
+		candidates []int
+		seen       = map[int]bool{}
+	)
+
+	collect := func(bucket []int) {
+		for _, i := range bucket {
+			if !seen[i] {
+				seen[i] = true
+				candidates = append(candidates, i)
+			}
+		}
+	}
+
+	hashes := make([]uint64, len(idx.tables))
+	for t, table := range idx.tables {
+		hashes[t] = table.hash(vec)
+		collect(table.buckets[hashes[t]])
+	}
+
+	// Probe the buckets one hyperplane away, if there aren't enough candidates.
+	if len(candidates) < topK {
+		for t, table := range idx.tables {
+			for bit := range table.planes {
+				collect(table.buckets[hashes[t]^(1<<bit)])
+			}
+		}
+	}
+
+	results := make([]*SearchResult, len(candidates))
+	for r, i := range candidates {
+		msg := idx.msgs[i]
+
+		results[r] = &SearchResult{
+			Message:      msg,
+			MessageIndex: i,
+			StartIndex:   0,
+			EndIndex:     len(msg.Content),
+			Score:        CosineSimilarity(vec, msg.Embedding),
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].MessageIndex < results[j].MessageIndex
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results
+}
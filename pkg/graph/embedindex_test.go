@@ -0,0 +1,96 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestEmbeddingIndex(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	randomVector := func() []float32 {
+		vec := make([]float32, 32)
+		for i := range vec {
+			vec[i] = float32(rng.NormFloat64())
+		}
+		return vec
+	}
+
+	index := graph.NewEmbeddingIndex(graph.EmbeddingIndexOptions{Seed: 42})
+
+	var msgs graph.Messages
+	for i := 0; i < 1000; i++ {
+		msg := &graph.Message{ID: fmt.Sprint(i), Embedding: randomVector()}
+		msgs = append(msgs, msg)
+
+		if err := index.Add(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if index.Len() != 1000 {
+		t.Fatalf("expected 1000 messages, got %d", index.Len())
+	}
+
+	// A query close to a message's embedding finds it first.
+	for _, want := range msgs[:10] {
+		query := make([]float32, len(want.Embedding))
+		for i, v := range want.Embedding {
+			query[i] = v + 0.05*float32(rng.NormFloat64())
+		}
+
+		results := index.Query(query, 5)
+		if len(results) == 0 || results[0].Message != want {
+			t.Fatalf("expected message %q first, got %v", want.ID, results)
+		}
+
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Fatalf("expected results ordered by score, got %v", results)
+			}
+		}
+	}
+
+	if err := index.Add(&graph.Message{ID: "small", Embedding: []float32{1, 2}}); !errors.Is(err, graph.ErrDimensionMismatch) {
+		t.Fatalf("expected error %v, got %v", graph.ErrDimensionMismatch, err)
+	}
+
+	if results := index.Query([]float32{1, 2}, 5); results != nil {
+		t.Fatalf("expected no results for a mismatched query, got %v", results)
+	}
+}
+
+func TestChatBuildEmbeddingIndex(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	client := newTestEmbeddingClient(t, func(input string) []float64 {
+		switch input {
+		case "message a":
+			return []float64{1, 0, 0}
+		case "message b":
+			return []float64{0, 1, 0}
+		default:
+			return []float64{0, 0, 1}
+		}
+	})
+
+	index, err := chat.BuildEmbeddingIndex(context.Background(), client, openai.ModelTextEmbeddingAda002)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index.Len() != 3 {
+		t.Fatalf("expected 3 messages, got %d", index.Len())
+	}
+
+	results := index.Query([]float32{0.1, 0.9, 0}, 1)
+	if len(results) != 1 || results[0].Message.ID != "b" {
+		t.Fatalf("expected message b, got %v", results)
+	}
+}
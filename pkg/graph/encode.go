@@ -0,0 +1,157 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Encode writes the chat graph to the given writer as JSON, in the same format
+// as json.Marshal (with only the IDs of the "in" and "out" messages), but one
+// message at a time, so the whole encoding is never held in memory.
+//
+// Every message in the graph is written, including messages only reachable
+// through the "in" or "out" messages of others, after the top-level messages.
+func (graph *Chat) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header, err := json.Marshal(struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}{graph.ID, graph.Name})
+	if err != nil {
+		return fmt.Errorf("failed to encode chat: %w", err)
+	}
+
+	// Replace the closing brace of the header, to continue with the messages.
+	bw.Write(header[:len(header)-1])
+	bw.WriteString(`,"messages":[`)
+
+	for i, msg := range graph.flatten() {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+
+		b, err := msg.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to encode message %q: %w", msg.ID, err)
+		}
+
+		bw.Write(b)
+	}
+
+	bw.WriteString("]}\n")
+
+	// Any error from the writes above is returned by Flush.
+	return bw.Flush()
+}
+
+// DecodeChat reads a chat graph from the given reader, as written by Encode
+// (or json.Marshal), one message at a time, and hydrates its messages.
+//
+// Any "in" or "out" message that isn't in the chat is dropped, like HydrateMessages.
+func DecodeChat(r io.Reader) (*Chat, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, fmt.Errorf("failed to decode chat: %w", err)
+	}
+
+	chat := &Chat{}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode chat: %w", err)
+		}
+
+		switch key, _ := token.(string); key {
+		case "id":
+			err = dec.Decode(&chat.ID)
+		case "name":
+			err = dec.Decode(&chat.Name)
+		case "messages":
+			err = decodeMessages(dec, chat)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode chat: %w", err)
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, fmt.Errorf("failed to decode chat: %w", err)
+	}
+
+	chat.resolveEdges()
+
+	return chat, nil
+}
+
+// decodeMessages decodes a JSON array of messages, one at a time,
+// appending them to the chat's messages.
+func decodeMessages(dec *json.Decoder, chat *Chat) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		msg := &Message{}
+		if err := dec.Decode(msg); err != nil {
+			return fmt.Errorf("failed to decode message %d: %w", len(chat.Messages), err)
+		}
+		chat.Messages = append(chat.Messages, msg)
+	}
+
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next JSON token, and returns an error
+// if it isn't the given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+
+	return nil
+}
+
+// resolveEdges replaces the ID-only "in" and "out" messages of the top-level
+// messages with the top-level messages that have the same ID (first match),
+// keeping their order, and dropping any that can't be resolved.
+//
+// It uses an index of the IDs, so it's linear in the size of the graph. Unlike
+// HydrateMessages, which orders the links like the top-level messages, and
+// links every top-level message sharing an ID, the links keep the order they
+// were decoded in, and each resolves to a single message.
+func (graph *Chat) resolveEdges() {
+	index := make(map[string]*Message, len(graph.Messages))
+	for _, msg := range graph.Messages {
+		if _, ok := index[msg.ID]; !ok {
+			index[msg.ID] = msg
+		}
+	}
+
+	resolve := func(edges Messages) Messages {
+		resolved := edges[:0]
+		for _, edge := range edges {
+			if found, ok := index[edge.ID]; ok {
+				resolved = append(resolved, found)
+			}
+		}
+		return resolved
+	}
+
+	for _, msg := range graph.Messages {
+		msg.In = resolve(msg.In)
+		msg.Out = resolve(msg.Out)
+	}
+}
@@ -0,0 +1,79 @@
+package graph_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatEncode(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	chat.GetMessageByID("b").Content = `Say "hello"`
+
+	var buf bytes.Buffer
+	if err := chat.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The encoding is valid JSON, and matches json.Marshal.
+	want, err := json.Marshal(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.TrimSpace(buf.String()); got != string(want) {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	decoded, err := graph.DecodeChat(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.ID != chat.ID || decoded.Name != chat.Name {
+		t.Fatalf("expected chat %q (%q), got %q (%q)", chat.ID, chat.Name, decoded.ID, decoded.Name)
+	}
+
+	if ids := strings.Join(decoded.Messages.IDs(), ","); ids != "a,b,c" {
+		t.Fatalf("expected messages %q, got %q", "a,b,c", ids)
+	}
+
+	if b := decoded.GetMessageByID("b"); b.Content != `Say "hello"` || b.In[0] != decoded.GetMessageByID("a") {
+		t.Fatalf("unexpected decoded message: %+v", b)
+	}
+
+	if err := decoded.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeChatLarge(t *testing.T) {
+	ids := make([]string, 100_000)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+
+	chat := newTestThread(ids...)
+
+	var buf bytes.Buffer
+	if err := chat.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := graph.DecodeChat(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Messages) != len(ids) {
+		t.Fatalf("expected %d messages, got %d", len(ids), len(decoded.Messages))
+	}
+
+	if last := decoded.Messages[len(ids)-1]; len(last.In) != 1 || last.In[0] != decoded.Messages[len(ids)-2] {
+		t.Fatalf("expected last message to be linked from the previous one")
+	}
+}
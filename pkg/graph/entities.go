@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/picatz/openai"
+)
+
+// ErrInvalidModelResponse is returned when a model's response
+// can't be parsed in the expected format (e.g. JSON).
+var ErrInvalidModelResponse = errors.New("invalid model response")
+
+// DefaultExtractEntitiesPrompt is the default prompt used to extract entities
+// from messages for the ExtractEntities method.
+var DefaultExtractEntitiesPrompt = strings.Join(
+	[]string{
+		"You are an expert at extracting structured information from conversations.",
+		"Extract the entities (e.g. people, places, organizations, things, topics, etc) mentioned in the given conversation.",
+		`Respond only with a JSON object mapping each entity category to a list of unique values, e.g. {"people": ["Jon Snow"], "places": ["Winterfell"]}.`,
+		"Do not include any other text, or a prefix in the output.",
+	}, " ",
+)
+
+// ExtractEntities extracts the entities (e.g. people, places, topics) mentioned
+// in the messages using the OpenAI API, returned as a map of entity categories,
+// chosen by the model, to their values.
+//
+// If the model doesn't respond with a JSON object after a few attempts, an
+// ErrInvalidModelResponse error is returned. Requests are retried after
+// transient errors as configured by retry (e.g. DefaultRetryOptions), like
+// SummarizeOptions.Retry, and aren't retried if it's nil.
+func (msgs Messages) ExtractEntities(ctx context.Context, client *openai.Client, model string, retry *RetryOptions) (map[string][]string, error) {
+	chatHistory, err := msgs.summaryChatHistory(ctx, DefaultExtractEntitiesPrompt, false)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := askJSON[map[string][]string](ctx, client, model, chatHistory, retry, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract entities from %d chat messages: %w", len(msgs), err)
+	}
+
+	return entities, nil
+}
+
+// askJSONAttempts is the number of times askJSON asks the model for a valid
+// JSON response before giving up.
+const askJSONAttempts = 3
+
+// askJSON asks the model to respond to the given chat messages with JSON, and
+// returns it decoded as a T. Transient API errors are retried as configured by
+// the given options, if not nil, like createChat, while responses that aren't
+// valid JSON, or that the optional check function rejects, are asked for again,
+// a few times, before returning an ErrInvalidModelResponse error.
+func askJSON[T any](ctx context.Context, client *openai.Client, model string, messages []openai.ChatMessage, retry *RetryOptions, check func(T) error) (T, error) {
+	var (
+		value    T
+		parseErr error
+	)
+
+	for attempt := 0; attempt < askJSONAttempts; attempt++ {
+		resp, err := createChat(ctx, client, &openai.CreateChatRequest{
+			Model:    model,
+			Messages: messages,
+		}, retry)
+		if err != nil {
+			return value, err
+		}
+
+		if len(resp.Choices) == 0 {
+			parseErr = errNoChoices
+			continue
+		}
+
+		// Decode into a new value, so nothing is left over from a previous attempt.
+		var decoded T
+
+		parseErr = json.Unmarshal([]byte(trimCodeFence(resp.Choices[0].Message.Content)), &decoded)
+		if parseErr == nil && check != nil {
+			parseErr = check(decoded)
+		}
+
+		if parseErr == nil {
+			return decoded, nil
+		}
+	}
+
+	return value, fmt.Errorf("%w: no valid response after %d attempts: %w", ErrInvalidModelResponse, askJSONAttempts, parseErr)
+}
+
+// trimCodeFence returns the given text without surrounding whitespace, or a
+// Markdown code fence (e.g. ```json ... ```), which models often add to JSON.
+func trimCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text
+	}
+
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```")
+
+	// Drop the fence's language (e.g. "json"), if any.
+	if i := strings.IndexByte(text, '\n'); i != -1 {
+		text = text[i+1:]
+	}
+
+	return strings.TrimSpace(text)
+}
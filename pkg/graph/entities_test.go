@@ -0,0 +1,88 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessagesExtractEntities(t *testing.T) {
+	msgs := newTestThread("a", "b").Messages
+	msgs[0].Content = "Who is Jon Snow's father?"
+	msgs[1].Content = "Rhaegar Targaryen, though he was raised at Winterfell."
+
+	t.Run("retry", func(t *testing.T) {
+		var requests int
+
+		client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+			requests++
+			if req.Messages[0].Content != graph.DefaultExtractEntitiesPrompt {
+				t.Fatalf("expected extraction prompt, got %q", req.Messages[0].Content)
+			}
+			if requests == 1 {
+				return "Sure! Here are the entities."
+			}
+			return "```json\n{\"people\": [\"Jon Snow\", \"Rhaegar Targaryen\"], \"places\": [\"Winterfell\"]}\n```"
+		})
+
+		entities, err := msgs.ExtractEntities(context.Background(), client, openai.ModelGPT4, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if requests != 2 {
+			t.Fatalf("expected 2 requests, got %d", requests)
+		}
+
+		if !slices.Equal(entities["people"], []string{"Jon Snow", "Rhaegar Targaryen"}) || !slices.Equal(entities["places"], []string{"Winterfell"}) {
+			t.Fatalf("unexpected entities %v", entities)
+		}
+	})
+
+	t.Run("transient error", func(t *testing.T) {
+		var requests int
+
+		client := newTestClient(t, func(r *http.Request) (int, string) {
+			requests++
+			if requests == 1 {
+				return http.StatusServiceUnavailable, `{"error": {"message": "overloaded"}}`
+			}
+			return http.StatusOK, `{"choices": [{"message": {"role": "assistant", "content": "{\"people\": [\"Jon Snow\"]}"}}]}`
+		})
+
+		// Without retry options, the error is returned right away.
+		if _, err := msgs.ExtractEntities(context.Background(), client, openai.ModelGPT4, nil); err == nil || requests != 1 {
+			t.Fatalf("expected an error after 1 request, got %v after %d requests", err, requests)
+		}
+
+		requests = 0
+
+		retry := &graph.RetryOptions{MaxAttempts: 2, BaseDelay: time.Millisecond}
+
+		entities, err := msgs.ExtractEntities(context.Background(), client, openai.ModelGPT4, retry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if requests != 2 || !slices.Equal(entities["people"], []string{"Jon Snow"}) {
+			t.Fatalf("expected the request to be retried, got %d requests and entities %v", requests, entities)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+			return "not JSON"
+		})
+
+		_, err := msgs.ExtractEntities(context.Background(), client, openai.ModelGPT4, nil)
+		if !errors.Is(err, graph.ErrInvalidModelResponse) {
+			t.Fatalf("expected error %v, got %v", graph.ErrInvalidModelResponse, err)
+		}
+	})
+}
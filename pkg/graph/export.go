@@ -0,0 +1,397 @@
+package graph
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/picatz/openai"
+)
+
+// MarkdownOption configures the WriteMarkdown method.
+type MarkdownOption func(*markdownOptions)
+
+type markdownOptions struct {
+	flat bool
+}
+
+// WithFlatTranscript is a MarkdownOption that renders every message one after
+// another, without indenting branches under their parent message.
+func WithFlatTranscript() MarkdownOption {
+	return func(o *markdownOptions) {
+		o.flat = true
+	}
+}
+
+// WriteMarkdown writes the chat graph to the given writer as a Markdown
+// transcript, with the messages in the same depth-first order as Visit, and
+// each message as its bolded role followed by its content in a blockquote.
+//
+// The content is quoted as-is, so Markdown in it (e.g. fenced code blocks in
+// assistant messages) is preserved.
+//
+// # Branches
+//
+// By default, when a message has more than one "out" message, each of those
+// branches is rendered as a nested list item, indented under the message, so
+// alternative replies can be told apart. A linear thread isn't indented. Use
+// the WithFlatTranscript option to never indent messages.
+func (graph *Chat) WriteMarkdown(w io.Writer, opts ...MarkdownOption) error {
+	var o markdownOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// The level of indentation for each message, which only increases
+	// for the "out" messages of a message with more than one.
+	levels := map[*Message]int{}
+
+	return graph.Visit(context.Background(), func(msg *Message) error {
+		level := levels[msg]
+
+		if !o.flat {
+			for _, out := range msg.Out {
+				if _, ok := levels[out]; ok {
+					continue
+				}
+
+				if len(msg.Out) > 1 {
+					levels[out] = level + 1
+				} else {
+					levels[out] = level
+				}
+			}
+		}
+
+		_, err := io.WriteString(w, markdownMessage(msg, level))
+		return err
+	})
+}
+
+// markdownMessage returns the Markdown for a single message at the given level,
+// where level 0 is a paragraph, and greater levels are nested list items.
+func markdownMessage(msg *Message, level int) string {
+	var (
+		b      strings.Builder
+		indent string
+		title  = "**" + msg.Role + "**:"
+	)
+
+	if level > 0 {
+		b.WriteString(strings.Repeat("  ", level-1))
+		b.WriteString("- ")
+		indent = strings.Repeat("  ", level)
+	}
+
+	b.WriteString(title)
+	b.WriteString("\n\n")
+
+	for _, line := range strings.Split(msg.Content, "\n") {
+		b.WriteString(indent)
+		if line == "" {
+			b.WriteString(">\n")
+			continue
+		}
+		b.WriteString("> ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// ThreadTranscript returns a plain-text transcript of the thread leading to the
+// message with the given ID, as found by ThreadTo using the WithEarliestParent
+// option, with each message formatted by its String method (e.g. "user: Hello"),
+// separated by blank lines, such as to paste a conversation into a bug report.
+func (graph *Chat) ThreadTranscript(leafID string) (string, error) {
+	thread, err := graph.ThreadTo(leafID, WithEarliestParent())
+	if err != nil {
+		return "", fmt.Errorf("failed to create transcript: %w", err)
+	}
+
+	lines := make([]string, len(thread))
+	for i, msg := range thread {
+		lines[i] = msg.String()
+	}
+
+	return strings.Join(lines, "\n\n"), nil
+}
+
+// WriteJSONL writes the chat graph to the given writer as a single line of JSON
+// in the format used by OpenAI fine-tuning (JSON Lines), so a training file can
+// be built by writing one conversation after another:
+//
+//	{"messages":[{"role":"system","content":"..."},{"role":"user","content":"..."}, ...]}
+//
+// The conversation is linearized with TopologicalSort, and system messages
+// are moved to the front, keeping their relative order.
+func (graph *Chat) WriteJSONL(w io.Writer) error {
+	sorted, err := graph.TopologicalSort()
+	if err != nil {
+		return fmt.Errorf("failed to linearize conversation: %w", err)
+	}
+
+	system := sorted.Match(func(m *Message) bool {
+		return m.Role == openai.ChatRoleSystem
+	})
+
+	rest := sorted.Match(func(m *Message) bool {
+		return m.Role != openai.ChatRoleSystem
+	})
+
+	example := struct {
+		Messages []openai.ChatMessage `json:"messages"`
+	}{
+		Messages: append(system, rest...).OpenAIChatMessages(),
+	}
+
+	// The encoder terminates the JSON with a newline.
+	return json.NewEncoder(w).Encode(example)
+}
+
+// csvHeader is the header row written by WriteCSV.
+var csvHeader = []string{"id", "role", "content", "in", "out", "created_at"}
+
+// WriteCSV writes the messages of the chat graph to the given writer as CSV,
+// with a header row, followed by a row for each message with its ID, role,
+// content, the IDs of its "in" and "out" messages (joined by semicolons), and
+// its creation time (in RFC 3339 format, or empty if unknown), such as to
+// analyze a conversation in a spreadsheet.
+//
+// Messages are ordered with TopologicalSort, or in the same order as Visit if
+// the graph has a cycle, so the output is deterministic.
+func (graph *Chat) WriteCSV(w io.Writer) error {
+	msgs, err := graph.TopologicalSort()
+	if errors.Is(err, ErrCycle) {
+		msgs = graph.nodes()
+	} else if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for _, msg := range msgs {
+		var createdAt string
+		if !msg.CreatedAt.IsZero() {
+			createdAt = msg.CreatedAt.Format(time.RFC3339Nano)
+		}
+
+		record := []string{
+			msg.ID,
+			msg.Role,
+			msg.Content,
+			strings.Join(msg.In.IDs(), ";"),
+			strings.Join(msg.Out.IDs(), ";"),
+			createdAt,
+		}
+
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV record for message %q: %w", msg.ID, err)
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// EdgeList returns a (fromID, toID) pair for each "out" message of every message
+// in the chat graph, sorted by ID, such as to load the structure of the graph
+// into an external graph-analysis library.
+func (graph *Chat) EdgeList() [][2]string {
+	var edges [][2]string
+
+	for _, msg := range graph.nodes() {
+		for _, out := range msg.Out {
+			if out != nil {
+				edges = append(edges, [2]string{msg.ID, out.ID})
+			}
+		}
+	}
+
+	slices.SortFunc(edges, func(a, b [2]string) int {
+		if c := strings.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1], b[1])
+	})
+
+	return edges
+}
+
+// AdjacencyMatrix returns the sorted IDs of every message in the chat graph,
+// and a dense matrix, where matrix[i][j] is true if the message with ids[i] has
+// the message with ids[j] as an "out" message, like EdgeList.
+func (graph *Chat) AdjacencyMatrix() (ids []string, matrix [][]bool) {
+	nodes := graph.nodes()
+
+	ids = nodes.IDs()
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	matrix = make([][]bool, len(ids))
+	for i := range matrix {
+		matrix[i] = make([]bool, len(ids))
+	}
+
+	for _, msg := range nodes {
+		for _, out := range msg.Out {
+			if out != nil {
+				matrix[index[msg.ID]][index[out.ID]] = true
+			}
+		}
+	}
+
+	return ids, matrix
+}
+
+// graphMLSnippetLength is the maximum number of runes of a message's content
+// included in the GraphML written by WriteGraphML.
+const graphMLSnippetLength = 80
+
+// graphML is the GraphML document written by WriteGraphML.
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the chat graph to the given writer as GraphML, which can
+// be opened by graph visualization tools, such as Gephi. Each message is a node,
+// with its role and a snippet of its content as attributes, and each link to an
+// "out" message is a directed edge, with its weight and label (if any) as
+// attributes.
+//
+// Nodes and edges are sorted by ID, like EdgeList, so the output is deterministic.
+func (graph *Chat) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "role", For: "node", AttrName: "role", AttrType: "string"},
+			{ID: "content", For: "node", AttrName: "content", AttrType: "string"},
+			{ID: "weight", For: "edge", AttrName: "weight", AttrType: "double"},
+			{ID: "label", For: "edge", AttrName: "label", AttrType: "string"},
+		},
+	}
+
+	doc.Graph.ID = graph.ID
+	doc.Graph.EdgeDefault = "directed"
+
+	nodes := slices.Clone(graph.nodes())
+	slices.SortStableFunc(nodes, func(a, b *Message) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	for _, msg := range nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: msg.ID,
+			Data: []graphMLData{
+				{Key: "role", Value: msg.Role},
+				{Key: "content", Value: snippet(msg.Content, graphMLSnippetLength)},
+			},
+		})
+
+		for _, out := range msg.Out {
+			if out == nil {
+				continue
+			}
+
+			edge := graphMLEdge{
+				Source: msg.ID,
+				Target: out.ID,
+				Data: []graphMLData{
+					{Key: "weight", Value: fmt.Sprint(msg.OutWeight(out))},
+				},
+			}
+
+			if label := msg.OutLabel(out); label != "" {
+				edge.Data = append(edge.Data, graphMLData{Key: "label", Value: label})
+			}
+
+			doc.Graph.Edges = append(doc.Graph.Edges, edge)
+		}
+	}
+
+	slices.SortStableFunc(doc.Graph.Edges, func(a, b graphMLEdge) int {
+		if c := strings.Compare(a.Source, b.Source); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Target, b.Target)
+	})
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write GraphML: %w", err)
+	}
+
+	// The encoder doesn't terminate the document with a newline.
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// snippet returns the first n runes of the given text, with whitespace
+// collapsed, followed by an ellipsis if it was truncated.
+func snippet(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,277 @@
+package graph_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatWriteMarkdown(t *testing.T) {
+	chat := newTestThread("a", "b")
+
+	b := chat.GetMessageByID("b")
+	b.Content = "Here you go:\n\n```go\nfmt.Println(\"hi\")\n```"
+
+	// Branch off of "b" with two alternative replies.
+	for _, id := range []string{"c1", "c2"} {
+		b.AddOutIn(&graph.Message{
+			ID: id,
+			ChatMessage: openai.ChatMessage{
+				Role:    openai.ChatRoleUser,
+				Content: "message " + id,
+			},
+		})
+	}
+
+	t.Run("threaded", func(t *testing.T) {
+		var out strings.Builder
+		if err := chat.WriteMarkdown(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		want := strings.Join([]string{
+			"**user**:",
+			"",
+			"> message a",
+			"",
+			"**assistant**:",
+			"",
+			"> Here you go:",
+			">",
+			"> ```go",
+			"> fmt.Println(\"hi\")",
+			"> ```",
+			"",
+			"- **user**:",
+			"",
+			"  > message c1",
+			"",
+			"- **user**:",
+			"",
+			"  > message c2",
+			"",
+			"",
+		}, "\n")
+
+		if out.String() != want {
+			t.Fatalf("expected:\n%s\ngot:\n%s", want, out.String())
+		}
+	})
+
+	t.Run("flat", func(t *testing.T) {
+		var out strings.Builder
+		if err := chat.WriteMarkdown(&out, graph.WithFlatTranscript()); err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(out.String(), "- **user**") {
+			t.Fatalf("expected flat transcript, got:\n%s", out.String())
+		}
+
+		if !strings.Contains(out.String(), "**user**:\n\n> message c2\n") {
+			t.Fatalf("expected all messages in transcript, got:\n%s", out.String())
+		}
+	})
+}
+
+func TestChatThreadTranscript(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// An alternative branch, which isn't in the transcript.
+	chat.GetMessageByID("a").AddOutIn(&graph.Message{ID: "b2"})
+
+	transcript, err := chat.ThreadTranscript("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "user: message a\n\nassistant: message b\n\nuser: message c"; transcript != want {
+		t.Fatalf("expected transcript %q, got %q", want, transcript)
+	}
+
+	if _, err := chat.ThreadTranscript("z"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+}
+
+func TestChatWriteJSONL(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// A system message linked in the middle of the conversation.
+	system := &graph.Message{
+		ID: "system",
+		ChatMessage: openai.ChatMessage{
+			Role:    openai.ChatRoleSystem,
+			Content: "You are a helpful assistant.",
+		},
+	}
+	chat.GetMessageByID("b").AddOutIn(system)
+
+	var out strings.Builder
+	if err := chat.WriteJSONL(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(out.String(), "\n") || strings.Count(out.String(), "\n") != 1 {
+		t.Fatalf("expected a single line, got %q", out.String())
+	}
+
+	var example struct {
+		Messages []openai.ChatMessage `json:"messages"`
+	}
+
+	if err := json.Unmarshal([]byte(out.String()), &example); err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []string
+	for _, msg := range example.Messages {
+		contents = append(contents, msg.Content)
+	}
+
+	want := "You are a helpful assistant.,message a,message b,message c"
+	if got := strings.Join(contents, ","); got != want {
+		t.Fatalf("expected messages %q, got %q", want, got)
+	}
+}
+
+func TestChatWriteCSV(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	b := chat.GetMessageByID("b")
+	b.Content = "Sure, here's a list:\n- one, two\n- \"three\""
+	b.CreatedAt = time.Date(2023, 3, 26, 12, 0, 0, 0, time.UTC)
+
+	var buf strings.Builder
+	if err := chat.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(buf.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"id", "role", "content", "in", "out", "created_at"},
+		{"a", openai.ChatRoleUser, "message a", "", "b", ""},
+		{"b", openai.ChatRoleAssistant, b.Content, "a", "c", "2023-03-26T12:00:00Z"},
+		{"c", openai.ChatRoleUser, "message c", "b", "", ""},
+	}
+
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d: %q", len(want), len(records), records)
+	}
+
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Fatalf("expected record %q, got %q", want[i], records[i])
+		}
+	}
+}
+
+func TestChatEdgeList(t *testing.T) {
+	chat := newTestThread("b", "c", "d")
+
+	// A root message, linked to the thread after it was built.
+	a := &graph.Message{ID: "a"}
+	a.AddOutIn(chat.GetMessageByID("d"))
+	a.AddOutIn(chat.GetMessageByID("b"))
+	chat.AddMessage(a)
+
+	var pairs []string
+	for _, edge := range chat.EdgeList() {
+		pairs = append(pairs, edge[0]+"-"+edge[1])
+	}
+
+	if got := strings.Join(pairs, ","); got != "a-b,a-d,b-c,c-d" {
+		t.Fatalf("expected edges %q, got %q", "a-b,a-d,b-c,c-d", got)
+	}
+}
+
+func TestChatAdjacencyMatrix(t *testing.T) {
+	chat := newTestThread("c", "b", "a")
+
+	ids, matrix := chat.AdjacencyMatrix()
+
+	if got := strings.Join(ids, ","); got != "a,b,c" {
+		t.Fatalf("expected IDs %q, got %q", "a,b,c", got)
+	}
+
+	want := [][]bool{
+		{false, false, false},
+		{true, false, false},
+		{false, true, false},
+	}
+
+	for i := range want {
+		for j := range want[i] {
+			if matrix[i][j] != want[i][j] {
+				t.Fatalf("expected matrix[%d][%d] to be %v", i, j, want[i][j])
+			}
+		}
+	}
+}
+
+func TestChatWriteGraphML(t *testing.T) {
+	chat := newTestThread("b", "a")
+
+	a := chat.GetMessageByID("a")
+	a.Content = `<script>alert("hi") & bye</script> ` + strings.Repeat("word ", 50)
+	a.AddOutLabeled(&graph.Message{ID: "c"}, "reply")
+
+	var buf strings.Builder
+	if err := chat.WriteGraphML(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID   string `xml:"id,attr"`
+				Data []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+
+	if err := xml.Unmarshal([]byte(buf.String()), &doc); err != nil {
+		t.Fatalf("invalid GraphML: %v\n%s", err, buf.String())
+	}
+
+	var ids []string
+	for _, node := range doc.Graph.Nodes {
+		ids = append(ids, node.ID)
+	}
+
+	if got := strings.Join(ids, ","); got != "a,b,c" {
+		t.Fatalf("expected nodes %q, got %q", "a,b,c", got)
+	}
+
+	var edges []string
+	for _, edge := range doc.Graph.Edges {
+		edges = append(edges, edge.Source+"-"+edge.Target)
+	}
+
+	if got := strings.Join(edges, ","); got != "a-c,b-a" {
+		t.Fatalf("expected edges %q, got %q", "a-c,b-a", got)
+	}
+
+	content := doc.Graph.Nodes[0].Data[1].Value
+	if !strings.HasPrefix(content, `<script>alert("hi") & bye</script> word`) || !strings.HasSuffix(content, "…") {
+		t.Fatalf("unexpected content snippet %q", content)
+	}
+}
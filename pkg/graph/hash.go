@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ContentHash returns the hex-encoded SHA-256 hash of the message's role and
+// content, which is the same for messages with the same role and content,
+// regardless of their IDs or links, across runs and platforms, such as to
+// detect repeated model outputs.
+//
+// The underlying OpenAI chat message doesn't have a name, so it isn't included.
+func (m *Message) ContentHash() string {
+	h := sha256.New()
+
+	// The role and content are separated by a NUL byte, which can't be part of
+	// a role, so different pairs never produce the same input.
+	h.Write([]byte(m.Role))
+	h.Write([]byte{0})
+	h.Write([]byte(m.Content))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FindDuplicates returns the messages that share a ContentHash with at least one
+// other message, grouped by that hash, in their original order.
+func (msgs Messages) FindDuplicates() map[string]Messages {
+	groups := map[string]Messages{}
+	for _, msg := range msgs {
+		hash := msg.ContentHash()
+		groups[hash] = append(groups[hash], msg)
+	}
+
+	for hash, group := range groups {
+		if len(group) < 2 {
+			delete(groups, hash)
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,45 @@
+package graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessageContentHash(t *testing.T) {
+	a := graph.NewMessage(openai.ChatRoleUser, "hello")
+	b := graph.NewMessage(openai.ChatRoleUser, "hello")
+
+	// The hash is stable, and doesn't depend on the ID.
+	if want := "87ce4613405ac8c20165d125a5c2219e8b38a9e030616dffd73a89faaf7293c8"; a.ContentHash() != want {
+		t.Fatalf("expected hash %q, got %q", want, a.ContentHash())
+	}
+
+	if a.ContentHash() != b.ContentHash() {
+		t.Fatalf("expected equal hashes, got %q and %q", a.ContentHash(), b.ContentHash())
+	}
+
+	if c := graph.NewMessage(openai.ChatRoleAssistant, "hello"); c.ContentHash() == a.ContentHash() {
+		t.Fatalf("expected the role to change the hash")
+	}
+}
+
+func TestMessagesFindDuplicates(t *testing.T) {
+	msgs := newTestThread("a", "b", "c", "d").Messages
+
+	// Repeat the content of "a" in "c", which has the same role.
+	msgs.GetByID("c").Content = "message a"
+
+	duplicates := msgs.FindDuplicates()
+
+	if len(duplicates) != 1 {
+		t.Fatalf("expected 1 group of duplicates, got %d", len(duplicates))
+	}
+
+	group := duplicates[msgs.GetByID("a").ContentHash()]
+	if ids := strings.Join(group.IDs(), ","); ids != "a,c" {
+		t.Fatalf("expected duplicates %q, got %q", "a,c", ids)
+	}
+}
@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Handler returns an HTTP handler serving the chats in the given store as JSON,
+// which can be mounted on a router (e.g. with http.StripPrefix):
+//
+//   - GET /{id} returns the chat with the given ID, in the same representation
+//     as json.Marshal, with only the IDs of the "in" and "out" messages. With the
+//     hydrated=true query parameter, the "in" and "out" messages include their
+//     role and content as well.
+//   - GET /{id}/search?q= returns the results of searching the chat's messages
+//     for the given query, as found by Search.
+//
+// A 404 (Not Found) status code is returned for unknown chats, and a 400 (Bad
+// Request) status code for invalid query parameters, with a JSON error message.
+func Handler(store Store) http.Handler {
+	h := &handler{store: store}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{id}", h.getChat)
+	mux.HandleFunc("GET /{id}/search", h.searchChat)
+
+	return mux
+}
+
+// handler serves the chats of a store, for Handler.
+type handler struct {
+	store Store
+}
+
+// linkedMessageJSON is the JSON representation of an "in" or "out" message,
+// for the hydrated representation of a chat served by Handler.
+type linkedMessageJSON struct {
+	ID      string `json:"id"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// hydratedMessageJSON is the JSON representation of a message, like messageJSON,
+// but with the role and content of its "in" and "out" messages, instead of
+// only their IDs.
+type hydratedMessageJSON struct {
+	messageJSON
+
+	In  []linkedMessageJSON `json:"in"`
+	Out []linkedMessageJSON `json:"out"`
+}
+
+// linkedMessages returns the JSON representation of the given "in" or "out" messages.
+func linkedMessages(msgs Messages) []linkedMessageJSON {
+	linked := make([]linkedMessageJSON, len(msgs))
+	for i, msg := range msgs {
+		linked[i] = linkedMessageJSON{ID: msg.ID, Role: msg.Role, Content: msg.Content}
+	}
+	return linked
+}
+
+func (h *handler) getChat(w http.ResponseWriter, r *http.Request) {
+	hydrated := false
+	if v := r.URL.Query().Get("hydrated"); v != "" {
+		var err error
+		if hydrated, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid hydrated parameter: "+strconv.Quote(v))
+			return
+		}
+	}
+
+	chat, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	if !hydrated {
+		writeJSON(w, http.StatusOK, chat)
+		return
+	}
+
+	msgs := make([]hydratedMessageJSON, len(chat.Messages))
+	for i, msg := range chat.Messages {
+		msgs[i] = hydratedMessageJSON{
+			messageJSON: msg.toJSON(),
+			In:          linkedMessages(msg.In),
+			Out:         linkedMessages(msg.Out),
+		}
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		ID       string                `json:"id"`
+		Name     string                `json:"name"`
+		Messages []hydratedMessageJSON `json:"messages"`
+	}{
+		ID:       chat.ID,
+		Name:     chat.Name,
+		Messages: msgs,
+	})
+}
+
+func (h *handler) searchChat(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing q parameter")
+		return
+	}
+
+	chat, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	results := chat.flatten().Search(r.Context(), query)
+	if results == nil {
+		results = []*SearchResult{}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+// load loads the chat with the ID in the request's path, or writes
+// an error response and returns false if it can't be loaded.
+func (h *handler) load(w http.ResponseWriter, r *http.Request) (*Chat, bool) {
+	chat, err := h.store.Load(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrChatNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	return chat, true
+}
+
+// writeJSON writes the given value as a JSON response, with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes a JSON response with the given status code and error message.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
@@ -0,0 +1,92 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestHandler(t *testing.T) {
+	store := graph.NewMemoryStore()
+
+	if err := store.Save(context.Background(), newTestThread("a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.StripPrefix("/chats", graph.Handler(store)))
+	defer server.Close()
+
+	get := func(t *testing.T, path string, wantStatus int, v any) {
+		t.Helper()
+
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("expected status %d for %q, got %d", wantStatus, path, resp.StatusCode)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("compact", func(t *testing.T) {
+		var chat graph.Chat
+		get(t, "/chats/chat-1", http.StatusOK, &chat)
+
+		chat.HydrateMessages(context.Background())
+
+		if len(chat.Messages) != 3 || chat.GetMessageByID("b").In[0] != chat.GetMessageByID("a") {
+			t.Fatalf("unexpected chat %+v", chat)
+		}
+	})
+
+	t.Run("hydrated", func(t *testing.T) {
+		var chat struct {
+			Messages []struct {
+				ID  string `json:"id"`
+				Out []struct {
+					ID      string `json:"id"`
+					Content string `json:"content"`
+				} `json:"out"`
+			} `json:"messages"`
+		}
+		get(t, "/chats/chat-1?hydrated=true", http.StatusOK, &chat)
+
+		if out := chat.Messages[0].Out; len(out) != 1 || out[0].ID != "b" || out[0].Content != "message b" {
+			t.Fatalf("expected hydrated \"out\" messages, got %+v", out)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		var results []*graph.SearchResult
+		get(t, "/chats/chat-1/search?q=message+c", http.StatusOK, &results)
+
+		if len(results) != 1 || results[0].Message.ID != "c" {
+			t.Fatalf("expected a result for message c, got %v", results)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var body struct {
+			Error string `json:"error"`
+		}
+
+		get(t, "/chats/unknown", http.StatusNotFound, &body)
+		get(t, "/chats/unknown/search?q=a", http.StatusNotFound, &body)
+		get(t, "/chats/chat-1/search", http.StatusBadRequest, &body)
+		get(t, "/chats/chat-1?hydrated=maybe", http.StatusBadRequest, &body)
+
+		if body.Error == "" {
+			t.Fatal("expected an error message")
+		}
+	})
+}
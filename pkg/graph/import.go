@@ -0,0 +1,177 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/picatz/openai"
+)
+
+// FromChatMessages returns a new graph, with a new unique ID, containing
+// a linear thread of the given OpenAI chat messages, in order.
+//
+// The messages are given sequential IDs, starting from "1", and each message
+// is linked "out" from the previous one using AddOutIn.
+func FromChatMessages(msgs []openai.ChatMessage) *Chat {
+	chat := &Chat{
+		ID:       newID(),
+		Messages: make(Messages, len(msgs)),
+	}
+
+	for i, chatMsg := range msgs {
+		msg := &Message{
+			ID:          strconv.Itoa(i + 1),
+			ChatMessage: chatMsg,
+		}
+
+		if i > 0 {
+			chat.Messages[i-1].AddOutIn(msg)
+		}
+
+		chat.Messages[i] = msg
+	}
+
+	return chat
+}
+
+// chatGPTConversation is a single conversation from a ChatGPT data
+// export's "conversations.json" file, containing only the used fields.
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+}
+
+// chatGPTNode is a single node in the tree of a ChatGPT conversation,
+// which may or may not contain a message.
+type chatGPTNode struct {
+	ID       string   `json:"id"`
+	Parent   string   `json:"parent"`
+	Children []string `json:"children"`
+	Message  *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		Content struct {
+			Parts []json.RawMessage `json:"parts"`
+		} `json:"content"`
+	} `json:"message"`
+}
+
+// ReadChatGPTExport reads the conversations from a ChatGPT data export's
+// "conversations.json" file, returning a graph for each conversation, with
+// the conversation's ID and title.
+//
+// Every branch of a conversation (e.g. from an edited prompt or a regenerated
+// reply) is kept, by linking each message "out" from its parent message using
+// AddOutIn. Nodes without a message (e.g. the root of the tree) are skipped,
+// linking their children to the nearest message above them instead.
+//
+// Only the text parts of a message's content are kept, joined by newlines.
+func ReadChatGPTExport(r io.Reader) ([]*Chat, error) {
+	var conversations []chatGPTConversation
+
+	if err := json.NewDecoder(r).Decode(&conversations); err != nil {
+		return nil, fmt.Errorf("failed to decode ChatGPT export: %w", err)
+	}
+
+	chats := make([]*Chat, 0, len(conversations))
+
+	for _, conversation := range conversations {
+		chats = append(chats, conversation.chat())
+	}
+
+	return chats, nil
+}
+
+// chat returns the conversation as a graph.
+func (conversation chatGPTConversation) chat() *Chat {
+	chat := &Chat{
+		ID:   conversation.ConversationID,
+		Name: conversation.Title,
+	}
+
+	if chat.ID == "" {
+		chat.ID = conversation.ID
+	}
+
+	// The roots of the tree are the nodes without a (known) parent,
+	// sorted for a consistent order across map iterations.
+	var roots []string
+	for id, node := range conversation.Mapping {
+		if _, ok := conversation.Mapping[node.Parent]; node.Parent == "" || !ok {
+			roots = append(roots, id)
+		}
+	}
+	sort.Strings(roots)
+
+	type frame struct {
+		id     string
+		parent *Message
+	}
+
+	var stack []frame
+	for i := len(roots) - 1; i >= 0; i-- {
+		stack = append(stack, frame{id: roots[i]})
+	}
+
+	seen := map[string]bool{}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node, ok := conversation.Mapping[top.id]
+		if !ok || seen[top.id] {
+			continue
+		}
+		seen[top.id] = true
+
+		parent := top.parent
+
+		if node.Message != nil {
+			msg := &Message{
+				ID: top.id,
+				ChatMessage: openai.ChatMessage{
+					Role:    node.Message.Author.Role,
+					Content: chatGPTText(node.Message.Content.Parts),
+				},
+			}
+
+			if parent != nil {
+				parent.AddOutIn(msg)
+			}
+
+			chat.Messages = append(chat.Messages, msg)
+			parent = msg
+		}
+
+		// Push the children in reverse, so they're visited in order.
+		for i := len(node.Children) - 1; i >= 0; i-- {
+			stack = append(stack, frame{id: node.Children[i], parent: parent})
+		}
+	}
+
+	return chat
+}
+
+// chatGPTText returns the text parts of a ChatGPT message's content, joined
+// by newlines, ignoring other parts (e.g. images).
+func chatGPTText(parts []json.RawMessage) string {
+	texts := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		var text string
+		if err := json.Unmarshal(part, &text); err != nil {
+			continue
+		}
+		texts = append(texts, text)
+	}
+
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,113 @@
+package graph_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestFromChatMessages(t *testing.T) {
+	chat := graph.FromChatMessages([]openai.ChatMessage{
+		{Role: openai.ChatRoleSystem, Content: "You are a helpful assistant."},
+		{Role: openai.ChatRoleUser, Content: "Hello!"},
+		{Role: openai.ChatRoleAssistant, Content: "Hi! How can I help?"},
+	})
+
+	if chat.ID == "" {
+		t.Fatalf("expected chat to have an ID")
+	}
+
+	if ids := strings.Join(chat.Messages.IDs(), ","); ids != "1,2,3" {
+		t.Fatalf("expected messages %q, got %q", "1,2,3", ids)
+	}
+
+	thread, err := chat.ThreadTo("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(thread) != 3 || thread[1].Content != "Hello!" {
+		t.Fatalf("expected linear thread, got %v", thread)
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadChatGPTExport(t *testing.T) {
+	// A conversation where the first reply was regenerated.
+	export := `[
+		{
+			"title": "Greetings",
+			"conversation_id": "conv-1",
+			"current_node": "d",
+			"mapping": {
+				"root": {"id": "root", "message": null, "parent": null, "children": ["a"]},
+				"a": {
+					"id": "a",
+					"message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["Hello!"]}},
+					"parent": "root",
+					"children": ["b", "c"]
+				},
+				"b": {
+					"id": "b",
+					"message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["Hi!"]}},
+					"parent": "a",
+					"children": []
+				},
+				"c": {
+					"id": "c",
+					"message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["Hey!", {"asset_pointer": "image"}]}},
+					"parent": "a",
+					"children": ["d"]
+				},
+				"d": {
+					"id": "d",
+					"message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["Bye!"]}},
+					"parent": "c",
+					"children": []
+				}
+			}
+		}
+	]`
+
+	chats, err := graph.ReadChatGPTExport(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chats) != 1 {
+		t.Fatalf("expected 1 chat, got %d", len(chats))
+	}
+
+	chat := chats[0]
+
+	if chat.ID != "conv-1" || chat.Name != "Greetings" {
+		t.Fatalf("unexpected chat ID %q and name %q", chat.ID, chat.Name)
+	}
+
+	if ids := strings.Join(chat.Messages.IDs(), ","); ids != "a,b,c,d" {
+		t.Fatalf("expected messages %q, got %q", "a,b,c,d", ids)
+	}
+
+	a := chat.GetMessageByID("a")
+	if len(a.In) != 0 || strings.Join(a.Out.IDs(), ",") != "b,c" {
+		t.Fatalf("expected a to branch to b and c, got %v", a.Out.IDs())
+	}
+
+	thread, err := chat.ThreadTo("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := strings.Join(thread.IDs(), ","); ids != "a,c,d" {
+		t.Fatalf("expected thread %q, got %q", "a,c,d", ids)
+	}
+
+	if c := chat.GetMessageByID("c"); c.Content != "Hey!" {
+		t.Fatalf("expected only text parts, got %q", c.Content)
+	}
+}
@@ -0,0 +1,41 @@
+package graph
+
+// IDIndex is an index of messages by ID, which finds a message in constant
+// time, unlike GetMessageByID, which searches every top-level message.
+//
+// Messages are added in constant time with Add, so it can be kept up to date
+// as a conversation grows (e.g. with OnAddMessage), without rebuilding it. An
+// IDIndex isn't safe for concurrent use.
+type IDIndex struct {
+	msgs map[string]*Message
+}
+
+// NewIDIndex returns a new index of every message in the graph, reachable from
+// its top-level messages, in the same order as Visit.
+func NewIDIndex(graph *Chat) *IDIndex {
+	idx := &IDIndex{msgs: map[string]*Message{}}
+
+	for _, msg := range graph.nodes() {
+		idx.Add(msg)
+	}
+
+	return idx
+}
+
+// Add adds the message to the index, unless a message with
+// the same ID was added first, like GetMessageByID.
+func (idx *IDIndex) Add(msg *Message) {
+	if _, ok := idx.msgs[msg.ID]; !ok {
+		idx.msgs[msg.ID] = msg
+	}
+}
+
+// Get returns the message with the given ID, or nil if it isn't in the index.
+func (idx *IDIndex) Get(id string) *Message {
+	return idx.msgs[id]
+}
+
+// Len returns the number of messages in the index.
+func (idx *IDIndex) Len() int {
+	return len(idx.msgs)
+}
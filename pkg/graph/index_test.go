@@ -0,0 +1,42 @@
+package graph_test
+
+import (
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestIDIndex(t *testing.T) {
+	chat := newTestThread("a", "b")
+
+	// A message only reachable through the "out" messages of another.
+	chat.GetMessageByID("b").AddOutIn(&graph.Message{ID: "c"})
+
+	index := graph.NewIDIndex(chat)
+	chat.OnAddMessage(index.Add)
+
+	if index.Len() != 3 || index.Get("c") == nil {
+		t.Fatalf("expected 3 messages, including c, got %d", index.Len())
+	}
+
+	var added []string
+	chat.OnAddMessage(func(msg *graph.Message) {
+		added = append(added, msg.ID)
+	})
+
+	d := graph.NewMessage(openai.ChatRoleUser, "message d")
+	chat.AddMessage(d)
+
+	if index.Get(d.ID) != d {
+		t.Fatalf("expected added message to be indexed")
+	}
+
+	if len(added) != 1 || added[0] != d.ID {
+		t.Fatalf("expected every function to be called, got %v", added)
+	}
+
+	if index.Get("z") != nil {
+		t.Fatalf("expected no message for an unknown ID")
+	}
+}
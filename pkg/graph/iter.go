@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"context"
+	"iter"
+)
+
+// All returns an iterator over every message in the chat graph, in the same
+// depth-first order as Visit, visiting each message only once.
+//
+//	for msg := range chat.All() {
+//		fmt.Println(msg)
+//	}
+func (c *Chat) All() iter.Seq[*Message] {
+	return func(yield func(*Message) bool) {
+		_ = c.Visit(context.Background(), func(msg *Message) error {
+			if !yield(msg) {
+				return ErrStopVisit
+			}
+			return nil
+		})
+	}
+}
+
+// All returns an iterator over the messages in the collection, in order,
+// without following their "in" or "out" messages.
+func (msgs Messages) All() iter.Seq[*Message] {
+	return func(yield func(*Message) bool) {
+		for _, msg := range msgs {
+			if !yield(msg) {
+				return
+			}
+		}
+	}
+}
+
+// SearchSeq returns an iterator over the results of searching the messages for
+// matches to the query, like Search, which are found lazily, one at a time, so
+// a search can be stopped early without searching every message:
+//
+//	for result := range msgs.SearchSeq(ctx, "dragon") {
+//		fmt.Println(result.Snippet(20))
+//		break
+//	}
+//
+// If the context is cancelled, the iterator stops yielding results.
+func (msgs Messages) SearchSeq(ctx context.Context, query string) iter.Seq[*SearchResult] {
+	return func(yield func(*SearchResult) bool) {
+		msgs.search(ctx, query, SearchOptions{}, func(i, start, end int) bool {
+			return yield(&SearchResult{
+				Message:      msgs[i],
+				MessageIndex: i,
+				StartIndex:   start,
+				EndIndex:     end,
+			})
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package graph_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatAll(t *testing.T) {
+	chat := newTestTree(2, 2)
+
+	var ids []string
+	for msg := range chat.All() {
+		ids = append(ids, msg.ID)
+	}
+
+	if got := fmt.Sprint(ids); got != "[0 0.0 0.0.0 0.0.1 0.1 0.1.0 0.1.1]" {
+		t.Fatalf("unexpected iteration order %s", got)
+	}
+
+	// Stop early.
+	count := 0
+	for range chat.All() {
+		count++
+		if count == 3 {
+			break
+		}
+	}
+
+	if count != 3 {
+		t.Fatalf("expected 3 messages, got %d", count)
+	}
+}
+
+func TestMessagesAll(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	var ids []string
+	for msg := range chat.Messages[1:].All() {
+		ids = append(ids, msg.ID)
+	}
+
+	if got := fmt.Sprint(ids); got != "[b c]" {
+		t.Fatalf("unexpected iteration order %s", got)
+	}
+}
+
+func TestMessagesSearchSeq(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage("user", "Tell me about the dragons."),
+		graph.NewMessage("assistant", "Nothing to see here."),
+		graph.NewMessage("user", "More about dragons, please."),
+		graph.NewMessage("assistant", "Dragons breathe fire."),
+	}
+
+	var indexes []int
+	for result := range msgs.SearchSeq(context.Background(), "dragon") {
+		indexes = append(indexes, result.MessageIndex)
+	}
+
+	if got := fmt.Sprint(indexes); got != "[0 2 3]" {
+		t.Fatalf("expected results %q, got %q", "[0 2 3]", got)
+	}
+
+	// Stop after the first result.
+	for result := range msgs.SearchSeq(context.Background(), "dragon") {
+		if result.Message != msgs[0] || result.Snippet(0) != "…dragon…" {
+			t.Fatalf("unexpected first result %+v", result)
+		}
+		break
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var count int
+	for range msgs.SearchSeq(ctx, "dragon") {
+		count++
+		cancel()
+	}
+
+	if count != 1 {
+		t.Fatalf("expected iteration to stop once cancelled, got %d results", count)
+	}
+}
@@ -0,0 +1,246 @@
+package graph
+
+import (
+	"errors"
+	"maps"
+)
+
+var (
+	// ErrNothingToUndo is returned by Journal.Undo when there's no change to undo.
+	ErrNothingToUndo = errors.New("nothing to undo")
+
+	// ErrNothingToRedo is returned by Journal.Redo when there's no undone change to redo.
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// Journal records the changes made to the structure of a chat graph through
+// its methods, which mirror the graph's own editing methods, so they can be
+// undone, and redone, such as in an interactive editor:
+//
+//	journal := graph.NewJournal(chat)
+//
+//	if err := journal.Splice(id); err != nil {
+//		...
+//	}
+//
+//	// Put the spliced message back.
+//	if err := journal.Undo(); err != nil {
+//		...
+//	}
+//
+// Each change records the top-level messages, and the "in" and "out" messages,
+// with the weights and labels of the links, of every message it affects, before
+// and after it's made, which is enough to reverse it. Changes made to the graph
+// without the journal aren't recorded, so undoing a change after the graph was
+// changed directly can lose those changes. Making a new change discards the
+// changes that were undone, like an editor.
+//
+// A Journal is not safe for concurrent use.
+type Journal struct {
+	graph *Chat
+
+	undo []journalEntry
+	redo []journalEntry
+}
+
+// journalEntry is a change recorded by a Journal.
+type journalEntry struct {
+	before, after linkState
+}
+
+// linkState is the state of the links of a graph's top-level messages, and of
+// the "in" and "out" messages of some of its messages, with their weights and labels.
+type linkState struct {
+	messages Messages
+	in, out  map[*Message]Messages
+	weights  map[*Message]map[string]float64
+	labels   map[*Message]map[string]string
+}
+
+// NewJournal returns a new journal, without any changes, for the given graph.
+func NewJournal(graph *Chat) *Journal {
+	return &Journal{graph: graph}
+}
+
+// AddMessage adds a message to the graph, like Chat.AddMessage, and records it.
+//
+// The functions registered with OnAddMessage are called when the message is
+// added, but not reversed by Undo, or called again by Redo, so an index kept
+// up to date with them (e.g. an IDIndex) still has the message after it's
+// undone. Rebuild such an index (e.g. with NewIDIndex) after undoing changes.
+func (j *Journal) AddMessage(msg *Message) string {
+	var id string
+
+	_ = j.record(nil, func() error {
+		id = j.graph.AddMessage(msg)
+		return nil
+	})
+
+	return id
+}
+
+// AddEdge links the message with the "from" ID to the message with the "to" ID
+// with AddOutIn, and records it.
+func (j *Journal) AddEdge(fromID, toID string) error {
+	from, err := j.graph.findMessage(fromID)
+	if err != nil {
+		return err
+	}
+
+	to, err := j.graph.findMessage(toID)
+	if err != nil {
+		return err
+	}
+
+	return j.record(Messages{from, to}, func() error {
+		from.AddOutIn(to)
+		return nil
+	})
+}
+
+// InsertBetween inserts a new message on the link between two messages, like
+// Chat.InsertBetween, and records it.
+func (j *Journal) InsertBetween(newMsg *Message, fromID, toID string) error {
+	from, err := j.graph.findMessage(fromID)
+	if err != nil {
+		return err
+	}
+
+	to, err := j.graph.findMessage(toID)
+	if err != nil {
+		return err
+	}
+
+	return j.record(Messages{newMsg, from, to}, func() error {
+		return j.graph.InsertBetween(newMsg, fromID, toID)
+	})
+}
+
+// RemoveMessage removes the message with the given ID from the graph, like
+// Chat.RemoveMessage, and records it, including every link to it.
+func (j *Journal) RemoveMessage(id string, opts ...RemoveOption) error {
+	msg, err := j.graph.findMessage(id)
+	if err != nil {
+		return err
+	}
+
+	// Every message linked to the removed message, in either direction,
+	// which is changed when it's removed.
+	affected := Messages{msg}
+	for _, node := range j.graph.nodes() {
+		if node != msg && (node.In.contains(msg) || node.Out.contains(msg) || msg.In.contains(node) || msg.Out.contains(node)) {
+			affected = append(affected, node)
+		}
+	}
+
+	return j.record(affected, func() error {
+		return j.graph.RemoveMessage(id, opts...)
+	})
+}
+
+// Splice removes the message with the given ID from the graph, keeping its
+// neighbors connected, like Chat.Splice, and records it.
+func (j *Journal) Splice(id string) error {
+	return j.RemoveMessage(id, WithReconnect())
+}
+
+// Undo reverses the most recent change that hasn't been undone, returning an
+// ErrNothingToUndo error if there isn't one.
+func (j *Journal) Undo() error {
+	if len(j.undo) == 0 {
+		return ErrNothingToUndo
+	}
+
+	entry := j.undo[len(j.undo)-1]
+	j.undo = j.undo[:len(j.undo)-1]
+
+	j.restore(entry.before)
+	j.redo = append(j.redo, entry)
+
+	return nil
+}
+
+// Redo makes the most recently undone change again, returning an
+// ErrNothingToRedo error if there isn't one.
+func (j *Journal) Redo() error {
+	if len(j.redo) == 0 {
+		return ErrNothingToRedo
+	}
+
+	entry := j.redo[len(j.redo)-1]
+	j.redo = j.redo[:len(j.redo)-1]
+
+	j.restore(entry.after)
+	j.undo = append(j.undo, entry)
+
+	return nil
+}
+
+// CanUndo returns true if there's a change to undo.
+func (j *Journal) CanUndo() bool {
+	return len(j.undo) > 0
+}
+
+// CanRedo returns true if there's an undone change to redo.
+func (j *Journal) CanRedo() bool {
+	return len(j.redo) > 0
+}
+
+// record makes a change with the given function, which only changes the links
+// of the top-level messages, and of the affected messages, and records it, if
+// it doesn't return an error.
+func (j *Journal) record(affected Messages, change func() error) error {
+	before := j.snapshot(affected)
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	j.undo = append(j.undo, journalEntry{before: before, after: j.snapshot(affected)})
+	j.redo = nil
+
+	return nil
+}
+
+// snapshot returns the current state of the links of the top-level messages,
+// and of the given messages.
+func (j *Journal) snapshot(affected Messages) linkState {
+	state := linkState{
+		messages: append(Messages{}, j.graph.Messages...),
+		in:       make(map[*Message]Messages, len(affected)),
+		out:      make(map[*Message]Messages, len(affected)),
+		weights:  make(map[*Message]map[string]float64, len(affected)),
+		labels:   make(map[*Message]map[string]string, len(affected)),
+	}
+
+	for _, msg := range affected {
+		state.in[msg] = append(Messages{}, msg.In...)
+		state.out[msg] = append(Messages{}, msg.Out...)
+		state.weights[msg] = maps.Clone(msg.OutWeights)
+		state.labels[msg] = maps.Clone(msg.OutLabels)
+	}
+
+	return state
+}
+
+// restore restores the given state of the links, using copies, so the state
+// isn't changed by later changes to the graph.
+func (j *Journal) restore(state linkState) {
+	j.graph.Messages = append(Messages{}, state.messages...)
+
+	for msg, in := range state.in {
+		msg.In = append(Messages{}, in...)
+	}
+
+	for msg, out := range state.out {
+		msg.Out = append(Messages{}, out...)
+	}
+
+	for msg, weights := range state.weights {
+		msg.OutWeights = maps.Clone(weights)
+	}
+
+	for msg, labels := range state.labels {
+		msg.OutLabels = maps.Clone(labels)
+	}
+}
@@ -0,0 +1,189 @@
+package graph_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// edges returns the "out" links of every message in the graph, as "from>to",
+// separated by spaces, in the same order as Visit.
+func edges(chat *graph.Chat) string {
+	var links []string
+	for msg := range chat.All() {
+		for _, out := range msg.Out {
+			links = append(links, msg.ID+">"+out.ID)
+		}
+	}
+	return strings.Join(links, " ")
+}
+
+func TestJournal(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	journal := graph.NewJournal(chat)
+
+	if err := journal.Undo(); !errors.Is(err, graph.ErrNothingToUndo) {
+		t.Fatalf("expected error %v, got %v", graph.ErrNothingToUndo, err)
+	}
+
+	states := []string{edges(chat)}
+
+	steps := []func() error{
+		func() error { return journal.InsertBetween(&graph.Message{ID: "x"}, "a", "b") },
+		func() error { return journal.Splice("b") },
+		func() error { return journal.AddEdge("a", "c") },
+		func() error { return journal.RemoveMessage("x") },
+		func() error {
+			journal.AddMessage(&graph.Message{ID: "d"})
+			return nil
+		},
+		func() error { return journal.AddEdge("c", "d") },
+	}
+
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, edges(chat))
+	}
+
+	want := []string{
+		"a>b b>c",
+		"a>x x>b b>c",
+		"a>x x>c",
+		"a>x a>c x>c",
+		"a>c",
+		"a>c",
+		"a>c c>d",
+	}
+
+	if strings.Join(states, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected states %q, got %q", want, states)
+	}
+
+	// Undo every change, checking the graph is back to each previous state.
+	for i := len(states) - 2; i >= 0; i-- {
+		if err := journal.Undo(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := edges(chat); got != states[i] {
+			t.Fatalf("expected state %q after undo, got %q", states[i], got)
+		}
+
+		if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if journal.CanUndo() || len(chat.Messages) != 3 {
+		t.Fatalf("expected every change to be undone, got %d top-level messages", len(chat.Messages))
+	}
+
+	// Redo the first two changes, then make a new change, which discards the rest.
+	for range 2 {
+		if err := journal.Redo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := edges(chat); got != states[2] {
+		t.Fatalf("expected state %q after redo, got %q", states[2], got)
+	}
+
+	if err := journal.AddEdge("c", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := journal.Redo(); !errors.Is(err, graph.ErrNothingToRedo) {
+		t.Fatalf("expected error %v, got %v", graph.ErrNothingToRedo, err)
+	}
+
+	if err := journal.Splice("z"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+}
+
+func TestJournalWeightsAndLabels(t *testing.T) {
+	chat := newTestThread("a")
+
+	a := chat.GetMessageByID("a")
+	b, c := &graph.Message{ID: "b"}, &graph.Message{ID: "c"}
+	a.AddOutWeighted(b, 5)
+	a.OutLabels = map[string]string{"b": "retry"}
+	b.AddOutIn(c)
+
+	journal := graph.NewJournal(chat)
+
+	if err := journal.Splice("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w, l := a.OutWeight(c), a.OutLabel(c); w != 6 || l != "retry" {
+		t.Fatalf("expected a → c weight 6 and label %q, got %v and %q", "retry", w, l)
+	}
+
+	if err := journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w, l := a.OutWeight(b), a.OutLabel(b); w != 5 || l != "retry" {
+		t.Fatalf("expected a → b weight 5 and label %q after undo, got %v and %q", "retry", w, l)
+	}
+	if len(a.OutWeights) != 1 || len(a.OutLabels) != 1 {
+		t.Fatalf("expected only the a → b weight and label after undo, got %v and %v", a.OutWeights, a.OutLabels)
+	}
+
+	if err := journal.Redo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w, l := a.OutWeight(c), a.OutLabel(c); w != 6 || l != "retry" {
+		t.Fatalf("expected a → c weight 6 and label %q after redo, got %v and %q", "retry", w, l)
+	}
+}
+
+func TestJournalAddMessageHooks(t *testing.T) {
+	chat := newTestThread("a")
+
+	index := graph.NewIDIndex(chat)
+	chat.OnAddMessage(index.Add)
+
+	journal := graph.NewJournal(chat)
+	journal.AddMessage(&graph.Message{ID: "b"})
+
+	if index.Get("b") == nil {
+		t.Fatalf("expected the added message to be indexed")
+	}
+
+	if err := journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if chat.GetMessageByID("b") != nil {
+		t.Fatalf("expected the added message to be removed from the graph")
+	}
+
+	// The hook isn't reversed, so the index has to be rebuilt.
+	if index.Get("b") == nil {
+		t.Fatalf("expected the index to still have the undone message")
+	}
+
+	if index := graph.NewIDIndex(chat); index.Get("b") != nil || index.Len() != 1 {
+		t.Fatalf("expected a rebuilt index without the undone message, got %d messages", index.Len())
+	}
+
+	// Redoing the change doesn't call the hook again.
+	calls := 0
+	chat.OnAddMessage(func(*graph.Message) { calls++ })
+
+	if err := journal.Redo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 0 || chat.GetMessageByID("b") == nil {
+		t.Fatalf("expected the message to be added back without calling hooks, got %d calls", calls)
+	}
+}
@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// stopwords are common English words ignored by Keywords.
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		a about above after again against all am an and any are as at be because
+		been before being below between both but by can could did do does doing
+		down during each few for from further had has have having he her here hers
+		herself him himself his how i if in into is it its itself just let me more
+		most my myself no nor not now of off on once only or other our ours
+		ourselves out over own same she should so some such than that the their
+		theirs them themselves then there these they this those through to too
+		under until up very was we were what when where which while who whom why
+		will with would you your yours yourself yourselves
+	`) {
+		stopwords[word] = true
+	}
+}
+
+// words returns the words in the given text, as runs of Unicode letters, marks,
+// and digits, like the WholeWord search option.
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+// terms returns the words in the given text that are candidate keywords,
+// normalized and case folded, without stopwords, numbers, or single letters.
+func terms(text string, fold cases.Caser) []string {
+	var result []string
+
+	for _, word := range words(norm.NFC.String(text)) {
+		term := fold.String(word)
+
+		if stopwords[term] || len([]rune(term)) < 2 || strings.IndexFunc(term, unicode.IsLetter) < 0 {
+			continue
+		}
+
+		result = append(result, term)
+	}
+
+	return result
+}
+
+// Keywords returns the topN most salient terms in the messages' content, ranked
+// by TF-IDF (term frequency-inverse document frequency), treating each message
+// as a document, without using a model, such as to filter messages quickly.
+//
+// Terms are case folded words, without common English stopwords, or numbers.
+// Terms with the same score are sorted alphabetically, so the result is
+// deterministic. A topN of zero, or less, returns every term.
+func (msgs Messages) Keywords(topN int) []string {
+	var (
+		fold = cases.Fold()
+
+		// The sum of each term's frequency in each message,
+		// and the number of messages containing it.
+		tf = map[string]float64{}
+		df = map[string]int{}
+
+		docs int
+	)
+
+	for _, msg := range msgs {
+		msgTerms := terms(msg.Content, fold)
+		if len(msgTerms) == 0 {
+			continue
+		}
+		docs++
+
+		counts := map[string]int{}
+		for _, term := range msgTerms {
+			counts[term]++
+		}
+
+		for term, count := range counts {
+			tf[term] += float64(count) / float64(len(msgTerms))
+			df[term]++
+		}
+	}
+
+	keywords := make([]string, 0, len(tf))
+	scores := make(map[string]float64, len(tf))
+
+	for term := range tf {
+		// Smoothed, so terms in every message still have a positive weight.
+		idf := math.Log(float64(1+docs)/float64(1+df[term])) + 1
+
+		scores[term] = tf[term] * idf
+		keywords = append(keywords, term)
+	}
+
+	slices.SortFunc(keywords, func(a, b string) int {
+		if scores[a] != scores[b] {
+			if scores[a] > scores[b] {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	if topN > 0 && len(keywords) > topN {
+		keywords = keywords[:topN]
+	}
+
+	return keywords
+}
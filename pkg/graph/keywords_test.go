@@ -0,0 +1,33 @@
+package graph_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessagesKeywords(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage(openai.ChatRoleUser, "Who is Jon Snow's father? Is it Ned Stark?"),
+		graph.NewMessage(openai.ChatRoleAssistant, "Jon Snow's father is Rhaegar Targaryen, not Ned Stark."),
+		graph.NewMessage(openai.ChatRoleUser, "Tell me more about Rhaegar. Was RHAEGAR a Targaryen prince in 283?"),
+	}
+
+	// Terms with the same score are sorted alphabetically.
+	keywords := msgs.Keywords(3)
+
+	if got := strings.Join(keywords, ","); got != "rhaegar,father,jon" {
+		t.Fatalf("expected keywords %q, got %q", "rhaegar,father,jon", got)
+	}
+
+	all := msgs.Keywords(0)
+
+	for _, word := range []string{"is", "the", "283", "s"} {
+		if slices.Contains(all, word) {
+			t.Fatalf("expected %q to not be a keyword, got %q", word, all)
+		}
+	}
+}
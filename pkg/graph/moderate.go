@@ -0,0 +1,150 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/picatz/openai"
+)
+
+// DefaultModerationModel is the model used to moderate messages by Moderate.
+var DefaultModerationModel = "text-moderation-latest"
+
+// errNoModeration is returned when the OpenAI API responds without a moderation result.
+var errNoModeration = errors.New("no moderation result in response")
+
+// ModerationResult is the moderation of a single message's content.
+type ModerationResult struct {
+	// The message that was moderated.
+	Message *Message `json:"message"`
+
+	// Flagged is true if the message's content violates the usage policies,
+	// or has a category score at, or above, the WithModerationThreshold.
+	Flagged bool `json:"flagged"`
+
+	// Categories is whether the content is flagged for each category,
+	// by name (e.g. "hate", "self-harm", or "violence/graphic").
+	Categories map[string]bool `json:"categories"`
+
+	// CategoryScores is the model's confidence, from 0 to 1, that the
+	// content belongs to each category, by name.
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// ModerateOption configures the Moderate method.
+type ModerateOption func(*moderateOptions)
+
+type moderateOptions struct {
+	threshold float64
+	tag       string
+}
+
+// WithModerationThreshold is a ModerateOption that flags messages with a score
+// at, or above, the given threshold in any category, instead of relying on the
+// API's own flag, to be more, or less, strict.
+func WithModerationThreshold(threshold float64) ModerateOption {
+	return func(o *moderateOptions) {
+		o.threshold = threshold
+	}
+}
+
+// WithFlaggedTag is a ModerateOption that adds the given tag to each flagged
+// message, with AddTag, such as to find them later with MessagesWithTag.
+func WithFlaggedTag(tag string) ModerateOption {
+	return func(o *moderateOptions) {
+		o.tag = tag
+	}
+}
+
+// Moderate screens the content of each message, and every message reachable
+// through their "out" messages, in the same order as Visit, using the OpenAI
+// moderation API, such as before storing, or sending, user generated content.
+// Messages without any content are skipped.
+//
+// The moderation API is called once per message, since the client only sends
+// a single input per request.
+func (msgs Messages) Moderate(ctx context.Context, client *openai.Client, opts ...ModerateOption) ([]ModerationResult, error) {
+	var o moderateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var results []ModerationResult
+
+	err := msgs.Visit(ctx, func(msg *Message) error {
+		if msg.Content == "" {
+			return nil
+		}
+
+		result, err := moderate(ctx, client, msg, o)
+		if err != nil {
+			return fmt.Errorf("failed to moderate message %q: %w", msg.ID, err)
+		}
+
+		if result.Flagged && o.tag != "" {
+			msg.AddTag(o.tag)
+		}
+
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// moderate returns the moderation of the given message's content.
+func moderate(ctx context.Context, client *openai.Client, msg *Message, o moderateOptions) (ModerationResult, error) {
+	resp, err := client.CreateModeration(ctx, &openai.CreateModerationRequest{
+		Model: DefaultModerationModel,
+		Input: msg.Content,
+	})
+	if err != nil {
+		return ModerationResult{}, err
+	}
+
+	if len(resp.Results) == 0 {
+		return ModerationResult{}, errNoModeration
+	}
+
+	r := resp.Results[0]
+
+	result := ModerationResult{
+		Message: msg,
+		Flagged: r.Flagged,
+		Categories: map[string]bool{
+			"hate":             r.Categories.Hate,
+			"hate/threatening": r.Categories.HateThreatening,
+			"self-harm":        r.Categories.SelfHarm,
+			"sexual":           r.Categories.Sexual,
+			"sexual/minors":    r.Categories.SexualMinors,
+			"violence":         r.Categories.Violence,
+			"violence/graphic": r.Categories.ViolenceGraphic,
+		},
+		CategoryScores: map[string]float64{
+			"hate":             r.CategoryScores.Hate,
+			"hate/threatening": r.CategoryScores.HateThreatening,
+			"self-harm":        r.CategoryScores.SelfHarm,
+			"sexual":           r.CategoryScores.Sexual,
+			"sexual/minors":    r.CategoryScores.SexualMinors,
+			"violence":         r.CategoryScores.Violence,
+			"violence/graphic": r.CategoryScores.ViolenceGraphic,
+		},
+	}
+
+	if o.threshold > 0 {
+		result.Flagged = false
+
+		for _, score := range result.CategoryScores {
+			if score >= o.threshold {
+				result.Flagged = true
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
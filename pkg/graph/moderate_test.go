@@ -0,0 +1,76 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// newTestModerationClient returns an OpenAI client that answers every
+// moderation request with a violence score of 0.9 if the input mentions
+// "kill", and 0.1 otherwise.
+func newTestModerationClient(t *testing.T, inputs *[]string) *openai.Client {
+	t.Helper()
+
+	return newTestClient(t, func(r *http.Request) (int, string) {
+		var req openai.CreateModerationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode moderation request: %v", err)
+		}
+
+		*inputs = append(*inputs, req.Input)
+
+		flagged, score := false, 0.1
+		if strings.Contains(req.Input, "kill") {
+			flagged, score = true, 0.9
+		}
+
+		return http.StatusOK, fmt.Sprintf(`{"results": [{"flagged": %t, "categories": {"violence": %t}, "category_scores": {"violence": %v}}]}`, flagged, flagged, score)
+	})
+}
+
+func TestMessagesModerate(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	chat.GetMessageByID("b").Content = "I want to kill them."
+	chat.GetMessageByID("c").Content = ""
+
+	var inputs []string
+
+	client := newTestModerationClient(t, &inputs)
+
+	results, err := chat.Messages.Moderate(context.Background(), client, graph.WithFlaggedTag("flagged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inputs) != 2 || len(results) != 2 {
+		t.Fatalf("expected 2 moderated messages, got %d results for inputs %q", len(results), inputs)
+	}
+
+	if results[0].Flagged || !results[1].Flagged || results[1].Message.ID != "b" {
+		t.Fatalf("expected only b to be flagged, got %+v", results)
+	}
+
+	if !results[1].Categories["violence"] || results[1].CategoryScores["violence"] != 0.9 {
+		t.Fatalf("unexpected categories %v, and scores %v", results[1].Categories, results[1].CategoryScores)
+	}
+
+	if tagged := chat.MessagesWithTag("flagged"); len(tagged) != 1 || tagged[0].ID != "b" {
+		t.Fatalf("expected only b to be tagged, got %v", tagged.IDs())
+	}
+
+	results, err = chat.Messages.Moderate(context.Background(), client, graph.WithModerationThreshold(0.05))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !results[0].Flagged || !results[1].Flagged {
+		t.Fatalf("expected every message to be flagged with a lower threshold, got %+v", results)
+	}
+}
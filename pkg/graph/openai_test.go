@@ -0,0 +1,100 @@
+package graph_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+)
+
+// roundTripFunc is an http.RoundTripper backed by a function,
+// used to fake responses from the OpenAI API in tests.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
+
+// newTestClient returns an OpenAI client that sends every request to the given
+// handler instead of the OpenAI API.
+func newTestClient(t *testing.T, handler func(r *http.Request) (int, string)) *openai.Client {
+	t.Helper()
+
+	return openai.NewClient("test", openai.WithHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			status, body := handler(r)
+			return &http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    r,
+			}, nil
+		}),
+	}))
+}
+
+// newTestChatClient returns an OpenAI client that answers every chat request
+// with the content returned by the given function.
+func newTestChatClient(t *testing.T, reply func(req *openai.CreateChatRequest) string) *openai.Client {
+	t.Helper()
+
+	return newTestClient(t, func(r *http.Request) (int, string) {
+		var req openai.CreateChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode chat request: %v", err)
+		}
+
+		resp := openai.CreateChatResponse{}
+		resp.Choices = append(resp.Choices, struct {
+			Message      openai.ChatMessage `json:"message"`
+			FinishReason string             `json:"finish_reason"`
+			Index        int                `json:"index"`
+		}{
+			Message: openai.ChatMessage{
+				Role:    openai.ChatRoleAssistant,
+				Content: reply(&req),
+			},
+			FinishReason: "stop",
+		})
+
+		b, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatalf("failed to encode chat response: %v", err)
+		}
+
+		return http.StatusOK, string(b)
+	})
+}
+
+// newTestEmbeddingClient returns an OpenAI client that answers every embedding
+// request with the embedding returned by the given function for the input.
+func newTestEmbeddingClient(t *testing.T, embed func(input string) []float64) *openai.Client {
+	t.Helper()
+
+	return newTestClient(t, func(r *http.Request) (int, string) {
+		var req openai.CreateEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode embedding request: %v", err)
+		}
+
+		resp := openai.CreateEmbeddingResponse{Model: req.Model}
+		resp.Data = append(resp.Data, struct {
+			Object    string    `json:"object"`
+			Embedding []float64 `json:"embedding"`
+			Index     int       `json:"index"`
+		}{
+			Object:    "embedding",
+			Embedding: embed(req.Input),
+		})
+
+		b, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatalf("failed to encode embedding response: %v", err)
+		}
+
+		return http.StatusOK, string(b)
+	})
+}
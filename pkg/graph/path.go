@@ -0,0 +1,310 @@
+package graph
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+)
+
+// ErrNoPath is returned when there isn't a path between two messages.
+var ErrNoPath = errors.New("no path")
+
+// ErrNegativeWeight is returned when a link has a negative weight, but an operation requires it not to.
+var ErrNegativeWeight = errors.New("negative weight")
+
+// PathOption configures the AllPaths method.
+type PathOption func(*pathOptions)
+
+type pathOptions struct {
+	maxPaths int
+}
+
+// WithMaxPaths is a PathOption that stops finding paths once the given number
+// of paths are found, since the number of paths can grow exponentially with
+// the number of branches that reconverge.
+func WithMaxPaths(n int) PathOption {
+	return func(o *pathOptions) {
+		o.maxPaths = n
+	}
+}
+
+// AllPaths returns every simple path (without repeated messages) following the
+// "out" messages from the message with the fromID to the message with the toID,
+// each starting with the first message, and ending with the second one, in the
+// order they're found by a depth-first-search.
+//
+// Use the WithMaxPaths option to limit the number of paths returned.
+func (graph *Chat) AllPaths(fromID, toID string, opts ...PathOption) ([]Messages, error) {
+	var o pathOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	from, err := graph.findMessage(fromID)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := graph.findMessage(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	if from == to {
+		return []Messages{{from}}, nil
+	}
+
+	var (
+		paths []Messages
+
+		// The current path, and the index of the next "out" message
+		// to follow for each message in it.
+		path   = Messages{from}
+		next   = []int{0}
+		onPath = NewMessageSet()
+	)
+
+	onPath.Add(from)
+
+	for len(path) > 0 {
+		if o.maxPaths > 0 && len(paths) >= o.maxPaths {
+			break
+		}
+
+		top := len(path) - 1
+		current := path[top]
+
+		// Backtrack once every "out" message has been followed.
+		if next[top] >= len(current.Out) {
+			delete(onPath, current)
+			path, next = path[:top], next[:top]
+			continue
+		}
+
+		out := current.Out[next[top]]
+		next[top]++
+
+		if out == nil || onPath.Has(out) {
+			continue
+		}
+
+		if out == to {
+			paths = append(paths, append(append(Messages{}, path...), out))
+			continue
+		}
+
+		onPath.Add(out)
+		path, next = append(path, out), append(next, 0)
+	}
+
+	return paths, nil
+}
+
+// LongestPath returns the longest chain of messages following the "out"
+// messages, from a root message (without any "in" messages) to a leaf message
+// (without any "out" messages), such as the deepest thread of a branching
+// conversation, to spot a runaway thread. If more than one path is
+// equally long, the one found first by Visit is returned.
+//
+// # Cycles
+//
+// A cyclic graph is treated as a DAG by ignoring its back-edges: the "out"
+// links to a message that is still being visited by a depth-first-search from
+// the top-level messages, in the same order as Visit. So, a path never repeats
+// a message, and no error is returned.
+func (graph *Chat) LongestPath() Messages {
+	var (
+		// The next message on the longest path from each visited message,
+		// and the length of that path.
+		next   = map[*Message]*Message{}
+		length = map[*Message]int{}
+
+		visiting = NewMessageSet()
+	)
+
+	type frame struct {
+		message *Message
+		next    int
+	}
+
+	// visit computes the longest path from the message, and every message
+	// reachable from it, in post-order, using an explicit stack instead of
+	// recursion, like walk, so arbitrarily long threads don't overflow it.
+	visit := func(msg *Message) {
+		visiting.Add(msg)
+		length[msg] = 1
+
+		stack := []frame{{message: msg}}
+
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+
+			// Leave the message once every "out" message has been visited.
+			if top.next >= len(top.message.Out) {
+				delete(visiting, top.message)
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			out := top.message.Out[top.next]
+
+			if out == nil || visiting.Has(out) {
+				top.next++
+				continue
+			}
+
+			// Visit the "out" message first, coming back to the same link
+			// once the length of its longest path is known.
+			if _, ok := length[out]; !ok {
+				visiting.Add(out)
+				length[out] = 1
+				stack = append(stack, frame{message: out})
+				continue
+			}
+
+			if length[out]+1 > length[top.message] {
+				next[top.message], length[top.message] = out, length[out]+1
+			}
+
+			top.next++
+		}
+	}
+
+	var start *Message
+
+	for _, msg := range graph.Messages {
+		if msg == nil {
+			continue
+		}
+
+		if _, ok := length[msg]; !ok {
+			visit(msg)
+		}
+
+		if start == nil || length[msg] > length[start] {
+			start = msg
+		}
+	}
+
+	if start == nil {
+		return nil
+	}
+
+	path := make(Messages, 0, length[start])
+	for msg := start; msg != nil; msg = next[msg] {
+		path = append(path, msg)
+	}
+
+	return path
+}
+
+// WeightedShortestPath returns the path following the "out" messages from the
+// message with the fromID to the message with the toID with the lowest total
+// weight (using Dijkstra's algorithm), and that total weight, where the weight
+// of each link is given by OutWeight. Since links default to a weight of 1, an
+// unweighted graph gives the path with the fewest links, like a breadth-first-search.
+//
+// An ErrNoPath error is returned if the second message can't be reached from
+// the first one, and an ErrNegativeWeight error if a link with a negative weight
+// is found along the way.
+func (graph *Chat) WeightedShortestPath(fromID, toID string) (Messages, float64, error) {
+	from, err := graph.findMessage(fromID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	to, err := graph.findMessage(toID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		dist = map[*Message]float64{from: 0}
+		prev = map[*Message]*Message{}
+		done = NewMessageSet()
+
+		queue = &distHeap{{msg: from}}
+		seq   int
+	)
+
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(distItem)
+
+		current := item.msg
+		if done.Has(current) {
+			continue
+		}
+		done.Add(current)
+
+		if current == to {
+			break
+		}
+
+		for _, out := range current.Out {
+			if out == nil || done.Has(out) {
+				continue
+			}
+
+			weight := current.OutWeight(out)
+			if weight < 0 {
+				return nil, 0, fmt.Errorf("%w: %v from message %q to %q", ErrNegativeWeight, weight, current.ID, out.ID)
+			}
+
+			if d, ok := dist[out]; ok && d <= item.dist+weight {
+				continue
+			}
+
+			dist[out], prev[out] = item.dist+weight, current
+
+			// The sequence number breaks ties in the order messages are found.
+			seq++
+			heap.Push(queue, distItem{msg: out, dist: item.dist + weight, seq: seq})
+		}
+	}
+
+	if !done.Has(to) {
+		return nil, 0, fmt.Errorf("%w: from message %q to %q", ErrNoPath, fromID, toID)
+	}
+
+	var path Messages
+	for msg := to; msg != nil; msg = prev[msg] {
+		path = append(path, msg)
+	}
+
+	// Reverse the path, to be ordered from the first message to the second.
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return path, dist[to], nil
+}
+
+// distItem is a message in a distHeap, with its distance from the start.
+type distItem struct {
+	msg  *Message
+	dist float64
+	seq  int
+}
+
+// distHeap is a min-heap of messages by distance, implementing heap.Interface.
+type distHeap []distItem
+
+func (h distHeap) Len() int { return len(h) }
+
+func (h distHeap) Less(i, j int) bool {
+	if h[i].dist != h[j].dist {
+		return h[i].dist < h[j].dist
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h distHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *distHeap) Push(x any) { *h = append(*h, x.(distItem)) }
+
+func (h *distHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
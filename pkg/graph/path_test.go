@@ -0,0 +1,151 @@
+package graph_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// pathIDs returns the IDs of each path, joined by commas,
+// and the paths joined by spaces.
+func pathIDs(paths []graph.Messages) string {
+	ids := make([]string, len(paths))
+	for i, path := range paths {
+		ids[i] = strings.Join(path.IDs(), ",")
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestChatAllPaths(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// Branch off of "a", and reconverge at "c" and "d".
+	b2 := &graph.Message{ID: "b2"}
+	chat.GetMessageByID("a").AddOutIn(b2)
+	b2.AddOutIn(chat.GetMessageByID("c"))
+	b2.AddOutIn(chat.GetMessageByID("d"))
+
+	// A cycle back to the start.
+	chat.GetMessageByID("d").AddOutIn(chat.GetMessageByID("a"))
+
+	paths, err := chat.AllPaths("a", "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := pathIDs(paths); ids != "a,b,c,d a,b2,c,d a,b2,d" {
+		t.Fatalf("expected paths %q, got %q", "a,b,c,d a,b2,c,d a,b2,d", ids)
+	}
+
+	paths, err = chat.AllPaths("a", "d", graph.WithMaxPaths(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 paths, got %d", len(paths))
+	}
+
+	paths, err = chat.AllPaths("c", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := pathIDs(paths); ids != "c,d,a,b" {
+		t.Fatalf("expected paths %q, got %q", "c,d,a,b", ids)
+	}
+
+	if _, err := chat.AllPaths("a", "z"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+}
+
+func TestChatLongestPath(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// Branch off of "a" with a longer thread.
+	b2 := &graph.Message{ID: "b2"}
+	c2 := &graph.Message{ID: "c2"}
+	d2 := &graph.Message{ID: "d2"}
+	e2 := &graph.Message{ID: "e2"}
+	chat.GetMessageByID("a").AddOutIn(b2)
+	b2.AddOutIn(c2)
+	c2.AddOutIn(d2)
+	d2.AddOutIn(e2)
+
+	if ids := strings.Join(chat.LongestPath().IDs(), ","); ids != "a,b2,c2,d2,e2" {
+		t.Fatalf("expected path %q, got %q", "a,b2,c2,d2,e2", ids)
+	}
+
+	// A cycle back to the start is ignored.
+	e2.AddOutIn(chat.GetMessageByID("a"))
+
+	if ids := strings.Join(chat.LongestPath().IDs(), ","); ids != "a,b2,c2,d2,e2" {
+		t.Fatalf("expected path %q, got %q", "a,b2,c2,d2,e2", ids)
+	}
+
+	if path := (&graph.Chat{}).LongestPath(); len(path) != 0 {
+		t.Fatalf("expected no path, got %v", path.IDs())
+	}
+
+	// A very long thread doesn't overflow the stack.
+	const n = 100000
+
+	root := &graph.Message{ID: "0"}
+
+	prev := root
+	for i := 1; i < n; i++ {
+		next := &graph.Message{ID: fmt.Sprint(i)}
+		prev.AddOutIn(next)
+		prev = next
+	}
+
+	deep := &graph.Chat{Messages: graph.Messages{root}}
+
+	if path := deep.LongestPath(); len(path) != n || path[n-1] != prev {
+		t.Fatalf("expected a path of %d messages, got %d", n, len(path))
+	}
+}
+
+func TestChatWeightedShortestPath(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// A shortcut from "a" to "d", which is the shortest path by default.
+	a, d := chat.GetMessageByID("a"), chat.GetMessageByID("d")
+	a.AddOutWeighted(d, graph.DefaultEdgeWeight)
+
+	path, weight, err := chat.WeightedShortestPath("a", "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := strings.Join(path.IDs(), ","); ids != "a,d" || weight != 1 {
+		t.Fatalf("expected path %q with weight 1, got %q with weight %v", "a,d", ids, weight)
+	}
+
+	// Make the shortcut more costly than the long way around.
+	a.OutWeights[d.ID] = 5
+	chat.GetMessageByID("b").AddOutWeighted(d, 0.5)
+
+	path, weight, err = chat.WeightedShortestPath("a", "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := strings.Join(path.IDs(), ","); ids != "a,b,d" || weight != 1.5 {
+		t.Fatalf("expected path %q with weight 1.5, got %q with weight %v", "a,b,d", ids, weight)
+	}
+
+	if _, _, err := chat.WeightedShortestPath("d", "a"); !errors.Is(err, graph.ErrNoPath) {
+		t.Fatalf("expected error %v, got %v", graph.ErrNoPath, err)
+	}
+
+	a.OutWeights[d.ID] = -1
+
+	if _, _, err := chat.WeightedShortestPath("a", "d"); !errors.Is(err, graph.ErrNegativeWeight) {
+		t.Fatalf("expected error %v, got %v", graph.ErrNegativeWeight, err)
+	}
+}
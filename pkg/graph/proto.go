@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/picatz/openai-chat-graph/pkg/graphpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MarshalProto returns the chat graph encoded as a graphpb.Chat protocol buffer,
+// with the same fields as its JSON representation, which only includes the IDs
+// of the "in" and "out" messages, such as to send it between services.
+func (graph *Chat) MarshalProto() ([]byte, error) {
+	pb := &graphpb.Chat{
+		Id:       graph.ID,
+		Name:     graph.Name,
+		Messages: make([]*graphpb.Message, len(graph.Messages)),
+	}
+
+	for i, msg := range graph.Messages {
+		msgPB, err := msg.toProto()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal message %q: %w", msg.ID, err)
+		}
+		pb.Messages[i] = msgPB
+	}
+
+	return proto.Marshal(pb)
+}
+
+// UnmarshalChatProto returns the chat graph decoded from a graphpb.Chat protocol
+// buffer, as written by MarshalProto, with its messages hydrated.
+func UnmarshalChatProto(b []byte) (*Chat, error) {
+	var pb graphpb.Chat
+	if err := proto.Unmarshal(b, &pb); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal chat: %w", err)
+	}
+
+	chat := &Chat{
+		ID:       pb.GetId(),
+		Name:     pb.GetName(),
+		Messages: make(Messages, len(pb.GetMessages())),
+	}
+
+	for i, msgPB := range pb.GetMessages() {
+		chat.Messages[i] = messageFromProto(msgPB)
+	}
+
+	chat.HydrateMessages(context.Background())
+
+	return chat, nil
+}
+
+// toProto returns the message as a graphpb.Message.
+func (m *Message) toProto() (*graphpb.Message, error) {
+	pb := &graphpb.Message{
+		Id:         m.ID,
+		Role:       m.Role,
+		Content:    m.Content,
+		In:         m.In.IDs(),
+		Out:        m.Out.IDs(),
+		Embedding:  m.Embedding,
+		Tags:       m.Tags,
+		OutWeights: m.OutWeights,
+		OutLabels:  m.OutLabels,
+	}
+
+	// The creation time is optional, so it's omitted if unknown.
+	if !m.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(m.CreatedAt)
+	}
+
+	if m.Metadata != nil {
+		// Round-trip the metadata through JSON, so values have the same
+		// types as they would when unmarshalled from JSON.
+		b, err := json.Marshal(m.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+
+		var metadata map[string]any
+		if err := json.Unmarshal(b, &metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+
+		pb.Metadata, err = structpb.NewStruct(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+
+	return pb, nil
+}
+
+// messageFromProto returns the message decoded from a graphpb.Message,
+// partially unmarshalling the "in" and "out" messages, like UnmarshalJSON.
+func messageFromProto(pb *graphpb.Message) *Message {
+	m := &Message{
+		ID:         pb.GetId(),
+		Embedding:  pb.GetEmbedding(),
+		Tags:       pb.GetTags(),
+		OutWeights: pb.GetOutWeights(),
+		OutLabels:  pb.GetOutLabels(),
+	}
+
+	m.Role = pb.GetRole()
+	m.Content = pb.GetContent()
+
+	if pb.GetCreatedAt() != nil {
+		m.CreatedAt = pb.GetCreatedAt().AsTime()
+	}
+
+	if pb.GetMetadata() != nil {
+		m.Metadata = pb.GetMetadata().AsMap()
+	}
+
+	for _, id := range pb.GetIn() {
+		m.In = append(m.In, &Message{ID: id})
+	}
+
+	for _, id := range pb.GetOut() {
+		m.Out = append(m.Out, &Message{ID: id})
+	}
+
+	return m
+}
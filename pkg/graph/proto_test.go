@@ -0,0 +1,54 @@
+package graph_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatMarshalProto(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	a := chat.GetMessageByID("a")
+	a.Embedding = []float32{0.5, 1}
+	a.CreatedAt = time.Date(2023, 3, 26, 12, 0, 0, 0, time.UTC)
+	a.Metadata = map[string]any{"author": "alice", "cost": 0.5, "flagged": false}
+	a.AddTag("important")
+	a.OutWeights = map[string]float64{"b": 2}
+	a.OutLabels = map[string]string{"b": "reply"}
+
+	b, err := chat.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := graph.UnmarshalChatProto(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := decoded.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fields are the same as the JSON representation.
+	want, err := json.Marshal(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != string(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	if _, err := graph.UnmarshalChatProto([]byte("invalid")); err == nil {
+		t.Fatal("expected error for invalid protocol buffer")
+	}
+}
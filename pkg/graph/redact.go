@@ -0,0 +1,90 @@
+package graph
+
+import "regexp"
+
+// RedactedPlaceholder replaces each match redacted from a message's content.
+const RedactedPlaceholder = "[REDACTED]"
+
+var (
+	// EmailPattern matches email addresses.
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+	// CreditCardPattern matches credit-card-like numbers, of 13 to 19 digits,
+	// optionally separated by spaces or dashes.
+	CreditCardPattern = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+
+	// PhoneNumberPattern matches (mostly North American) phone numbers, with an
+	// optional country code, e.g. "555-123-4567", "(555) 123-4567", or "+1 555 123 4567".
+	PhoneNumberPattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{3}\)|\b\d{3})[\s.\-]?\d{3}[\s.\-]?\d{4}\b`)
+
+	// DefaultRedactPatterns are the patterns redacted by default, in order.
+	DefaultRedactPatterns = []*regexp.Regexp{
+		EmailPattern,
+		CreditCardPattern,
+		PhoneNumberPattern,
+	}
+)
+
+// Redact replaces every match of each of the given patterns, in order, with the
+// RedactedPlaceholder in the content of every message in the graph, and returns
+// the total number of replacements. If no patterns are given, the
+// DefaultRedactPatterns are used.
+//
+// This is useful to scrub sensitive information from messages before they're
+// sent to a third-party (e.g. with Summarize) or logged. Use RedactWithOptions
+// to redact a copy of the graph instead.
+func (graph *Chat) Redact(patterns ...*regexp.Regexp) int {
+	if len(patterns) == 0 {
+		patterns = DefaultRedactPatterns
+	}
+
+	var redacted int
+
+	for _, pattern := range patterns {
+		redacted += graph.ReplaceAllRegexp(pattern, RedactedPlaceholder)
+	}
+
+	return redacted
+}
+
+// RedactOption configures the RedactWithOptions method.
+type RedactOption func(*redactOptions)
+
+type redactOptions struct {
+	patterns []*regexp.Regexp
+	clone    bool
+}
+
+// WithRedactPatterns is a RedactOption that sets the patterns to redact,
+// instead of the DefaultRedactPatterns.
+func WithRedactPatterns(patterns ...*regexp.Regexp) RedactOption {
+	return func(o *redactOptions) {
+		o.patterns = append(o.patterns, patterns...)
+	}
+}
+
+// WithRedactClone is a RedactOption that redacts a deep copy of the graph,
+// created with Clone, leaving the original graph untouched.
+func WithRedactClone() RedactOption {
+	return func(o *redactOptions) {
+		o.clone = true
+	}
+}
+
+// RedactWithOptions redacts the graph like Redact, configured by the given
+// options, and returns the redacted graph, which is either this graph, or a
+// copy of it when using the WithRedactClone option, along with the total
+// number of replacements.
+func (graph *Chat) RedactWithOptions(opts ...RedactOption) (*Chat, int) {
+	var o redactOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	redacted := graph
+	if o.clone {
+		redacted = graph.Clone()
+	}
+
+	return redacted, redacted.Redact(o.patterns...)
+}
@@ -0,0 +1,71 @@
+package graph_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatRedact(t *testing.T) {
+	newChat := func() *graph.Chat {
+		chat := newTestThread("a", "b", "c")
+		chat.GetMessageByID("a").Content = "Email me at jon.snow@winterfell.org or call (555) 123-4567."
+		chat.GetMessageByID("b").Content = "My card is 4111 1111 1111 1111, and my number is +1 555.987.6543."
+		return chat
+	}
+
+	t.Run("default patterns", func(t *testing.T) {
+		chat := newChat()
+
+		if n := chat.Redact(); n != 4 {
+			t.Fatalf("expected 4 redactions, got %d", n)
+		}
+
+		want := map[string]string{
+			"a": "Email me at [REDACTED] or call [REDACTED].",
+			"b": "My card is [REDACTED], and my number is [REDACTED].",
+			"c": "message c",
+		}
+
+		for id, content := range want {
+			if got := chat.GetMessageByID(id).Content; got != content {
+				t.Fatalf("expected message %q content %q, got %q", id, content, got)
+			}
+		}
+	})
+
+	t.Run("custom patterns", func(t *testing.T) {
+		chat := newChat()
+
+		if n := chat.Redact(regexp.MustCompile(`Snow`), regexp.MustCompile(`message`)); n != 1 {
+			t.Fatalf("expected 1 redaction, got %d", n)
+		}
+
+		if got := chat.GetMessageByID("c").Content; got != "[REDACTED] c" {
+			t.Fatalf("expected content %q, got %q", "[REDACTED] c", got)
+		}
+	})
+
+	t.Run("clone", func(t *testing.T) {
+		chat := newChat()
+		original := chat.GetMessageByID("a").Content
+
+		redacted, n := chat.RedactWithOptions(graph.WithRedactClone(), graph.WithRedactPatterns(graph.EmailPattern))
+		if n != 1 {
+			t.Fatalf("expected 1 redaction, got %d", n)
+		}
+
+		if redacted == chat {
+			t.Fatalf("expected a copy of the graph")
+		}
+
+		if got := chat.GetMessageByID("a").Content; got != original {
+			t.Fatalf("expected original content %q, got %q", original, got)
+		}
+
+		if got := redacted.GetMessageByID("a").Content; got != "Email me at [REDACTED] or call (555) 123-4567." {
+			t.Fatalf("unexpected redacted content %q", got)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package graph
+
+import (
+	"time"
+
+	"github.com/picatz/openai"
+)
+
+// RetentionPolicy configures which messages are kept by ApplyRetention.
+// Every non-zero limit is applied, so the most restrictive one wins.
+type RetentionPolicy struct {
+	// MaxMessages is the maximum number of top-level messages to keep,
+	// not counting a leading system message.
+	MaxMessages int
+
+	// MaxTokens is the maximum TokenCount of the top-level messages to keep,
+	// for the Model, including a leading system message, like ContextWindow.
+	MaxTokens int
+
+	// Model is the model used to count tokens for MaxTokens.
+	Model string
+
+	// MaxAge is the maximum age of the messages to keep, based on their
+	// CreatedAt time. Messages without a CreatedAt time never expire.
+	MaxAge time.Duration
+
+	// Now is the time used to determine the age of messages,
+	// which is the current time if zero.
+	Now time.Time
+}
+
+// ApplyRetention drops the oldest top-level messages from the graph, as a
+// sliding window, until the rest satisfy the given policy, and returns the
+// dropped messages, oldest first, so they can be archived elsewhere.
+//
+// A leading system message is never dropped. Dropped messages are removed
+// like RemoveMessage, so no links to them remain in the graph, and they're
+// left untouched themselves.
+func (graph *Chat) ApplyRetention(policy RetentionPolicy) Messages {
+	start := 0
+	if len(graph.Messages) > 0 && graph.Messages[0].Role == openai.ChatRoleSystem {
+		start = 1
+	}
+
+	var (
+		rest = graph.Messages[start:]
+		drop int
+	)
+
+	if policy.MaxMessages > 0 && len(rest) > policy.MaxMessages {
+		drop = max(drop, len(rest)-policy.MaxMessages)
+	}
+
+	if policy.MaxTokens > 0 {
+		window := graph.Messages.ContextWindow(policy.Model, policy.MaxTokens)
+		drop = max(drop, len(graph.Messages)-len(window))
+	}
+
+	if policy.MaxAge > 0 {
+		now := policy.Now
+		if now.IsZero() {
+			now = time.Now()
+		}
+
+		cutoff := now.Add(-policy.MaxAge)
+
+		expired := 0
+		for _, msg := range rest {
+			if msg.CreatedAt.IsZero() || !msg.CreatedAt.Before(cutoff) {
+				break
+			}
+			expired++
+		}
+
+		drop = max(drop, expired)
+	}
+
+	if drop == 0 {
+		return nil
+	}
+
+	dropped := append(Messages{}, rest[:drop]...)
+
+	graph.removeMessages(dropped)
+
+	return dropped
+}
@@ -0,0 +1,83 @@
+package graph_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatApplyRetention(t *testing.T) {
+	now := time.Date(2023, 3, 26, 12, 0, 0, 0, time.UTC)
+
+	newChat := func() *graph.Chat {
+		chat := newTestThread("a", "b", "c", "d", "e")
+
+		for i, msg := range chat.Messages {
+			msg.CreatedAt = now.Add(time.Duration(i-len(chat.Messages)) * time.Hour)
+		}
+
+		system := graph.NewMessage(openai.ChatRoleSystem, "You are a helpful assistant.")
+		chat.Messages = append(graph.Messages{system}, chat.Messages...)
+
+		return chat
+	}
+
+	tests := []struct {
+		name    string
+		policy  graph.RetentionPolicy
+		dropped string
+	}{
+		{
+			name:    "max messages",
+			policy:  graph.RetentionPolicy{MaxMessages: 2},
+			dropped: "a,b,c",
+		},
+		{
+			name:    "max age",
+			policy:  graph.RetentionPolicy{MaxAge: 150 * time.Minute, Now: now},
+			dropped: "a,b,c",
+		},
+		{
+			name:    "max tokens",
+			policy:  graph.RetentionPolicy{MaxTokens: 40, Model: openai.ModelGPT4},
+			dropped: "a,b",
+		},
+		{
+			name:    "most restrictive",
+			policy:  graph.RetentionPolicy{MaxMessages: 4, MaxAge: 90 * time.Minute, Now: now},
+			dropped: "a,b,c,d",
+		},
+		{
+			name:    "nothing",
+			policy:  graph.RetentionPolicy{MaxMessages: 10},
+			dropped: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chat := newChat()
+
+			dropped := chat.ApplyRetention(test.policy)
+
+			if ids := strings.Join(dropped.IDs(), ","); ids != test.dropped {
+				t.Fatalf("expected dropped %q, got %q", test.dropped, ids)
+			}
+
+			if chat.Messages[0].Role != openai.ChatRoleSystem {
+				t.Fatalf("expected leading system message to be kept")
+			}
+
+			if len(chat.Messages) != 6-len(dropped) {
+				t.Fatalf("expected %d messages, got %d", 6-len(dropped), len(chat.Messages))
+			}
+
+			if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
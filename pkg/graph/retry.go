@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/picatz/openai"
+)
+
+// RetryOptions configures how requests to the OpenAI API are retried after
+// transient errors, such as rate limits (429) and server errors (5xx), using
+// exponential backoff.
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// Requests aren't retried if it's less than 2.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry, which doubles for
+	// every retry after it.
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay between attempts, if positive,
+	// unless the API asks to wait longer with a Retry-After header.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction (from 0 to 1) of each delay to randomly add or
+	// subtract, to avoid many clients retrying at the same time.
+	Jitter float64
+}
+
+// DefaultRetryOptions are sensible options for retrying requests to the OpenAI API.
+var DefaultRetryOptions = RetryOptions{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+}
+
+// delay returns the delay before the given retry (starting from 1).
+func (o *RetryOptions) delay(retry int) time.Duration {
+	delay := o.BaseDelay << (retry - 1)
+	if delay < 0 || (o.MaxDelay > 0 && delay > o.MaxDelay) {
+		delay = o.MaxDelay
+	}
+
+	if o.Jitter > 0 {
+		delay += time.Duration(float64(delay) * o.Jitter * (2*rand.Float64() - 1))
+	}
+
+	return max(delay, 0)
+}
+
+// statusCodePattern matches the status code in errors returned by the OpenAI client.
+var statusCodePattern = regexp.MustCompile(`unexpected status code: (\d+)`)
+
+// retryable returns true if the error returned by the OpenAI client is likely
+// transient: a rate limit (429), a server error (5xx), or a network error.
+func retryable(err error) bool {
+	if match := statusCodePattern.FindStringSubmatch(err.Error()); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryAfterRecorder is an http.RoundTripper that records the delay requested
+// by the Retry-After header of the last response, since the OpenAI client
+// doesn't expose response headers.
+type retryAfterRecorder struct {
+	next http.RoundTripper
+
+	mu    sync.Mutex
+	delay time.Duration
+	ok    bool
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *retryAfterRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.delay, r.ok = 0, false
+
+	if err == nil {
+		r.delay, r.ok = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	return resp, err
+}
+
+// retryAfter returns the delay requested by the last response, if any.
+func (r *retryAfterRecorder) retryAfter() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.delay, r.ok
+}
+
+// parseRetryAfter parses the value of a Retry-After header,
+// which is either a number of seconds, or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// createChat creates a chat completion using the OpenAI API, like the client's
+// CreateChat method, retrying transient errors as configured by the given
+// options, if not nil.
+func createChat(ctx context.Context, client *openai.Client, req *openai.CreateChatRequest, retry *RetryOptions) (*openai.CreateChatResponse, error) {
+	if retry == nil || retry.MaxAttempts < 2 {
+		return client.CreateChat(ctx, req)
+	}
+
+	// Use a copy of the client, to record the Retry-After header of responses.
+	httpClient := http.DefaultClient
+	if client.HTTPClient != nil {
+		httpClient = client.HTTPClient
+	}
+
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	recorder := &retryAfterRecorder{next: transport}
+
+	recordingHTTPClient := *httpClient
+	recordingHTTPClient.Transport = recorder
+
+	recordingClient := *client
+	recordingClient.HTTPClient = &recordingHTTPClient
+
+	for attempt := 1; ; attempt++ {
+		resp, err := recordingClient.CreateChat(ctx, req)
+		if err == nil || attempt >= retry.MaxAttempts || !retryable(err) {
+			return resp, err
+		}
+
+		delay, ok := recorder.retryAfter()
+		if !ok {
+			delay = retry.delay(attempt)
+		}
+
+		timer := time.NewTimer(delay)
+
+		// Stop if the context has been cancelled.
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
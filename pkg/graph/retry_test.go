@@ -0,0 +1,118 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// newTestRetryClient returns an OpenAI client that responds to each chat
+// request with the next of the given status codes (and headers), and then
+// with a summary once they're exhausted.
+func newTestRetryClient(t *testing.T, statuses []int, header http.Header, requests *int) *openai.Client {
+	t.Helper()
+
+	return openai.NewClient("test", openai.WithHTTPClient(&http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			*requests++
+
+			status, body := http.StatusOK, `{"choices":[{"message":{"role":"assistant","content":"summary"}}]}`
+			if *requests <= len(statuses) {
+				status, body = statuses[*requests-1], `{"error":{"message":"try again"}}`
+			}
+
+			return &http.Response{
+				StatusCode: status,
+				Header:     header.Clone(),
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    r,
+			}, nil
+		}),
+	}))
+}
+
+func TestMessagesSummarizeWithRetry(t *testing.T) {
+	msgs := newTestThread("a", "b").Messages
+
+	t.Run("backoff", func(t *testing.T) {
+		var requests int
+		client := newTestRetryClient(t, []int{http.StatusTooManyRequests, http.StatusBadGateway}, nil, &requests)
+
+		summary, err := msgs.SummarizeWithOptions(context.Background(), client, openai.ModelGPT4, graph.SummarizeOptions{
+			Retry: &graph.RetryOptions{MaxAttempts: 3, BaseDelay: time.Millisecond, Jitter: 0.5},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if summary != "summary" || requests != 3 {
+			t.Fatalf("expected summary after 3 requests, got %q after %d", summary, requests)
+		}
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		var requests int
+		client := newTestRetryClient(t, []int{http.StatusTooManyRequests}, http.Header{"Retry-After": {"0"}}, &requests)
+
+		// The backoff delay would time out the test, if Retry-After wasn't honored.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := msgs.SummarizeWithOptions(ctx, client, openai.ModelGPT4, graph.SummarizeOptions{
+			Retry: &graph.RetryOptions{MaxAttempts: 2, BaseDelay: time.Hour},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if requests != 2 {
+			t.Fatalf("expected 2 requests, got %d", requests)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		var requests int
+		client := newTestRetryClient(t, []int{500, 500, 500}, nil, &requests)
+
+		_, err := msgs.SummarizeWithOptions(context.Background(), client, openai.ModelGPT4, graph.SummarizeOptions{
+			Retry: &graph.RetryOptions{MaxAttempts: 2, BaseDelay: time.Millisecond},
+		})
+		if err == nil || requests != 2 {
+			t.Fatalf("expected error after 2 requests, got %v after %d", err, requests)
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		var requests int
+		client := newTestRetryClient(t, []int{http.StatusBadRequest}, nil, &requests)
+
+		_, err := msgs.SummarizeWithOptions(context.Background(), client, openai.ModelGPT4, graph.SummarizeOptions{
+			Retry: &graph.DefaultRetryOptions,
+		})
+		if err == nil || requests != 1 {
+			t.Fatalf("expected error after 1 request, got %v after %d", err, requests)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		var requests int
+		client := newTestRetryClient(t, []int{http.StatusServiceUnavailable}, nil, &requests)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := msgs.SummarizeWithOptions(ctx, client, openai.ModelGPT4, graph.SummarizeOptions{
+			Retry: &graph.RetryOptions{MaxAttempts: 2, BaseDelay: time.Hour},
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected error %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+}
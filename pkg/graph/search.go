@@ -0,0 +1,262 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+)
+
+// SearchOptions configures the SearchWithOptions method.
+// The zero value is the same as Search.
+type SearchOptions struct {
+	// CaseSensitive only matches the query with the same case,
+	// instead of ignoring case.
+	CaseSensitive bool
+
+	// WholeWord only matches the query as whole words, not as part of a
+	// longer word (e.g. "cat" doesn't match "category"), using Unicode
+	// letters, marks, and digits to find word boundaries.
+	WholeWord bool
+
+	// Language is the language of the messages, used for language-specific
+	// matching (e.g. case folding), which is American English if unset.
+	Language language.Tag
+}
+
+// SearchWithOptions searches the messages for the first match of the query in
+// each message, like Search, configured by the given options.
+//
+// If the context is cancelled, the search stops early and
+// the results found so far are returned.
+func (msgs Messages) SearchWithOptions(ctx context.Context, query string, opts SearchOptions) []*SearchResult {
+	// Results retrieved from the search.
+	results := []*SearchResult{}
+
+	msgs.search(ctx, query, opts, func(i, start, end int) bool {
+		results = append(results, &SearchResult{
+			Message:      msgs[i],
+			MessageIndex: i,
+			StartIndex:   start,
+			EndIndex:     end,
+		})
+		return true
+	})
+
+	// Return the results.
+	return results
+}
+
+// search calls fn with the message index, start, and end of the first match of
+// the query in each message, in order, until fn returns false, or the context
+// is cancelled. It's the foundation of the other search methods.
+func (msgs Messages) search(ctx context.Context, query string, opts SearchOptions, fn func(i, start, end int) bool) {
+	var matcherOpts []search.Option
+	if !opts.CaseSensitive {
+		matcherOpts = append(matcherOpts, search.IgnoreCase)
+	}
+
+	tag := opts.Language
+	if tag == language.Und {
+		tag = language.AmericanEnglish
+	}
+
+	// Create a new matcher to be compiled into a pattern.
+	matcher := search.New(tag, matcherOpts...)
+
+	// Compile the query into a pattern that can be used to match messages.
+	pattern := matcher.CompileString(query)
+
+	// Iterate over the messages and report any matches.
+	for i, msg := range msgs {
+		// Stop if the context has been cancelled.
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if start, end := indexPattern(pattern, msg.Content, opts.WholeWord); start != -1 {
+			if !fn(i, start, end) {
+				return
+			}
+		}
+	}
+}
+
+// SearchPaged searches the messages for matches to a given query, like Search,
+// but only returns the results from offset, up to limit results, along with the
+// total number of results, to page through many results with bounded memory.
+//
+// If limit isn't positive, every result from offset is returned.
+func (msgs Messages) SearchPaged(ctx context.Context, query string, offset, limit int) ([]*SearchResult, int) {
+	var (
+		results []*SearchResult
+		total   int
+	)
+
+	msgs.search(ctx, query, SearchOptions{}, func(i, start, end int) bool {
+		if total >= offset && (limit <= 0 || len(results) < limit) {
+			results = append(results, &SearchResult{
+				Message:      msgs[i],
+				MessageIndex: i,
+				StartIndex:   start,
+				EndIndex:     end,
+			})
+		}
+		total++
+		return true
+	})
+
+	return results, total
+}
+
+// CountMatches returns the number of messages matching the query, like Search,
+// without building any results, such as to show a count for many queries. Each
+// message is counted once, however many times it matches.
+//
+// If the context is cancelled, the messages counted so far are returned.
+func (msgs Messages) CountMatches(ctx context.Context, query string) int {
+	var count int
+
+	msgs.search(ctx, query, SearchOptions{}, func(_, _, _ int) bool {
+		count++
+		return true
+	})
+
+	return count
+}
+
+// SearchInLanguage searches the messages for matches to a given query, like
+// Search, using the given language for language-specific matching.
+func (msgs Messages) SearchInLanguage(ctx context.Context, query string, tag language.Tag) []*SearchResult {
+	return msgs.SearchWithOptions(ctx, query, SearchOptions{Language: tag})
+}
+
+// indexPattern returns the start and end of the first match of the pattern in
+// the given string, optionally only as a whole word, or -1, -1 if not found.
+func indexPattern(pattern *search.Pattern, s string, wholeWord bool) (int, int) {
+	for offset := 0; offset < len(s); {
+		start, end := pattern.IndexString(s[offset:])
+		if start == -1 || end == -1 {
+			return -1, -1
+		}
+
+		start, end = start+offset, end+offset
+
+		if !wholeWord || isWordBoundary(s, start, end) {
+			return start, end
+		}
+
+		// Try again after the first rune of this match.
+		_, size := utf8.DecodeRuneInString(s[start:])
+		offset = start + size
+	}
+
+	return -1, -1
+}
+
+// isWordBoundary returns true if the given range of the string isn't
+// directly preceded, or followed, by part of a word.
+func isWordBoundary(s string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && isWordRune(before) {
+		return false
+	}
+
+	if after, _ := utf8.DecodeRuneInString(s[end:]); end < len(s) && isWordRune(after) {
+		return false
+	}
+
+	return true
+}
+
+// isWordRune returns true if the rune can be part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Highlight returns the content of the result's message with the matched text
+// wrapped in the given markers (e.g. "<mark>" and "</mark>", or terminal escape
+// codes), to render search results.
+//
+// If the result's indexes are out of range for the message's content, the
+// content is returned as-is.
+func (result *SearchResult) Highlight(pre, post string) string {
+	content := result.Message.Content
+
+	var (
+		b    strings.Builder
+		last int
+	)
+
+	for _, span := range result.spans() {
+		start, end := span[0], span[1]
+		if start < last || end < start || end > len(content) {
+			return content
+		}
+
+		b.WriteString(content[last:start])
+		b.WriteString(pre)
+		b.WriteString(content[start:end])
+		b.WriteString(post)
+
+		last = end
+	}
+
+	b.WriteString(content[last:])
+
+	return b.String()
+}
+
+// Snippet returns the matched text of the result's message, with up to radius
+// characters (runes) of its content on each side, to preview a search result
+// without its whole message. An ellipsis ("…") marks each side of the content
+// that was cut off.
+//
+// The result's indexes are clamped to the content, and widened to the nearest
+// UTF-8 character boundaries, so a snippet never splits a character.
+func (result *SearchResult) Snippet(radius int) string {
+	content := result.Message.Content
+
+	start := min(max(result.StartIndex, 0), len(content))
+	end := min(max(result.EndIndex, start), len(content))
+
+	for start > 0 && start < len(content) && !utf8.RuneStart(content[start]) {
+		start--
+	}
+
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	for i := 0; i < radius && start > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(content[:start])
+		start -= size
+	}
+
+	for i := 0; i < radius && end < len(content); i++ {
+		_, size := utf8.DecodeRuneInString(content[end:])
+		end += size
+	}
+
+	text := content[start:end]
+
+	if start > 0 {
+		text = "…" + text
+	}
+
+	if end < len(content) {
+		text += "…"
+	}
+
+	return text
+}
+
+// spans returns the start and end indexes of each matched occurrence
+// in the result's message, in order.
+func (result *SearchResult) spans() [][2]int {
+	return [][2]int{{result.StartIndex, result.EndIndex}}
+}
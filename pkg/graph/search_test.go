@@ -0,0 +1,239 @@
+package graph_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+	"golang.org/x/text/language"
+)
+
+func TestMessagesSearchWithOptions(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage("user", "What category is this?"),
+		graph.NewMessage("user", "The Cat sat on the mat."),
+		graph.NewMessage("user", "A cat, a dog, and a café."),
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		opts  graph.SearchOptions
+		want  []int // message index, start index
+	}{
+		{
+			name:  "default",
+			query: "cat",
+			want:  []int{0, 5, 1, 4, 2, 2},
+		},
+		{
+			name:  "whole word",
+			query: "cat",
+			opts:  graph.SearchOptions{WholeWord: true},
+			want:  []int{1, 4, 2, 2},
+		},
+		{
+			name:  "case sensitive",
+			query: "cat",
+			opts:  graph.SearchOptions{CaseSensitive: true},
+			want:  []int{0, 5, 2, 2},
+		},
+		{
+			name:  "case sensitive whole word",
+			query: "Cat",
+			opts:  graph.SearchOptions{CaseSensitive: true, WholeWord: true},
+			want:  []int{1, 4},
+		},
+		{
+			name:  "whole word unicode",
+			query: "caf",
+			opts:  graph.SearchOptions{WholeWord: true},
+			want:  nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := msgs.SearchWithOptions(context.Background(), test.query, test.opts)
+
+			var got []int
+			for _, result := range results {
+				got = append(got, result.MessageIndex, result.StartIndex)
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("expected results %v, got %v", test.want, got)
+			}
+
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("expected results %v, got %v", test.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMessagesSearchInLanguage(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage("user", "İstanbul"),
+		graph.NewMessage("user", "Istanbul"),
+	}
+
+	// In Turkish, the uppercase of "i" is "İ", and the uppercase of "ı" is "I".
+	tests := []struct {
+		tag   language.Tag
+		query string
+		want  int
+	}{
+		{language.AmericanEnglish, "istanbul", 1},
+		{language.Turkish, "istanbul", 0},
+		{language.AmericanEnglish, "ıstanbul", -1},
+		{language.Turkish, "ıstanbul", 1},
+	}
+
+	for _, test := range tests {
+		results := msgs.SearchInLanguage(context.Background(), test.query, test.tag)
+
+		got := -1
+		if len(results) == 1 {
+			got = results[0].MessageIndex
+		} else if len(results) > 1 {
+			t.Fatalf("expected at most 1 result for %q in %v, got %d", test.query, test.tag, len(results))
+		}
+
+		if got != test.want {
+			t.Fatalf("expected %q in %v to match message %d, got %d", test.query, test.tag, test.want, got)
+		}
+	}
+}
+
+func TestSearchResultHighlight(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage("user", "The Cat sat on the mat."),
+	}
+
+	results := msgs.Search(context.Background(), "cat")
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	if got, want := results[0].Highlight("<mark>", "</mark>"), "The <mark>Cat</mark> sat on the mat."; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	invalid := &graph.SearchResult{Message: msgs[0], StartIndex: 10, EndIndex: 100}
+	if got := invalid.Highlight("[", "]"); got != msgs[0].Content {
+		t.Fatalf("expected content as-is, got %q", got)
+	}
+}
+
+func TestSearchResultSnippet(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage("user", "Ça va? The Cat sat on the mat, naïvely."),
+	}
+
+	results := msgs.Search(context.Background(), "cat")
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	tests := []struct {
+		radius int
+		want   string
+	}{
+		{0, "…Cat…"},
+		{4, "…The Cat sat…"},
+		{11, "Ça va? The Cat sat on the…"},
+		{100, msgs[0].Content},
+	}
+
+	for _, test := range tests {
+		if got := results[0].Snippet(test.radius); got != test.want {
+			t.Fatalf("expected snippet %q with radius %d, got %q", test.want, test.radius, got)
+		}
+	}
+
+	// Indexes out of range, or in the middle of a character, are clamped.
+	invalid := &graph.SearchResult{Message: msgs[0], StartIndex: 1, EndIndex: 100}
+	if got := invalid.Snippet(1); got != msgs[0].Content {
+		t.Fatalf("expected whole content, got %q", got)
+	}
+
+	end := &graph.SearchResult{Message: msgs[0], StartIndex: len(msgs[0].Content) - 3, EndIndex: len(msgs[0].Content)}
+	if got := end.Snippet(3); got != "…ïvely." {
+		t.Fatalf("expected snippet %q, got %q", "…ïvely.", got)
+	}
+
+	// Indexes at, or past (e.g. a stale result after the content was
+	// edited), the end of the content are clamped to it.
+	for _, start := range []int{len(msgs[0].Content), len(msgs[0].Content) + 5} {
+		stale := &graph.SearchResult{Message: msgs[0], StartIndex: start, EndIndex: start + 3}
+		if got := stale.Snippet(3); got != "…ly." {
+			t.Fatalf("expected snippet %q for start index %d, got %q", "…ly.", start, got)
+		}
+	}
+}
+
+func TestMessagesCountMatches(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage("user", "The cat sat on the mat, next to another CAT."),
+		graph.NewMessage("assistant", "Dogs are nice too."),
+		graph.NewMessage("user", "What about a category?"),
+	}
+
+	if n := msgs.CountMatches(context.Background(), "cat"); n != 2 {
+		t.Fatalf("expected 2 matching messages, got %d", n)
+	}
+
+	if n := msgs.CountMatches(context.Background(), "bird"); n != 0 {
+		t.Fatalf("expected no matching messages, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if n := msgs.CountMatches(ctx, "cat"); n != 0 {
+		t.Fatalf("expected no messages counted once cancelled, got %d", n)
+	}
+}
+
+func TestMessagesSearchPaged(t *testing.T) {
+	var msgs graph.Messages
+	for i := 0; i < 25; i++ {
+		content := "nothing to see here"
+		if i%2 == 0 {
+			content = "a match"
+		}
+		msgs = append(msgs, graph.NewMessage("user", content))
+	}
+
+	tests := []struct {
+		offset, limit int
+		want          []int
+	}{
+		{0, 3, []int{0, 2, 4}},
+		{3, 3, []int{6, 8, 10}},
+		{11, 3, []int{22, 24}},
+		{13, 3, nil},
+		{10, 0, []int{20, 22, 24}},
+	}
+
+	for _, test := range tests {
+		results, total := msgs.SearchPaged(context.Background(), "match", test.offset, test.limit)
+
+		if total != 13 {
+			t.Fatalf("expected 13 total results, got %d", total)
+		}
+
+		var got []int
+		for _, result := range results {
+			got = append(got, result.MessageIndex)
+		}
+
+		if !slices.Equal(got, test.want) {
+			t.Fatalf("expected page (%d, %d) to be %v, got %v", test.offset, test.limit, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/picatz/openai"
+)
+
+// DefaultSentimentPrompt is the default prompt used to score the sentiment of
+// messages for the Sentiment method.
+var DefaultSentimentPrompt = strings.Join(
+	[]string{
+		"You are an expert at sentiment analysis.",
+		"The input is a JSON array of chat messages.",
+		"Rate how negative or positive each message is, from -1 (very negative), through 0 (neutral), to 1 (very positive).",
+		"Reply with nothing but a JSON array of numbers, one per message, in the same order as the input.",
+	}, " ",
+)
+
+// sentimentChunkTokens is the maximum number of tokens (roughly) of messages
+// scored in a single request by Sentiment.
+const sentimentChunkTokens = 1000
+
+// Sentiment returns the sentiment of each message, and every message reachable
+// through their "out" messages, by ID, as a score from -1 (very negative) to 1
+// (very positive), where 0 is neutral, using the OpenAI API. Messages without
+// any content aren't scored.
+//
+// Like Translate, messages are scored in batches, as a JSON array. A batch is
+// asked for again if the model's scores are malformed, don't match the number
+// of messages, or fall outside of [-1, 1], before giving up with an
+// ErrInvalidModelResponse error. Transient errors are retried like
+// ExtractEntities.
+func (msgs Messages) Sentiment(ctx context.Context, client *openai.Client, model string, retry *RetryOptions) (map[string]float64, error) {
+	var nodes Messages
+
+	err := msgs.Visit(ctx, func(msg *Message) error {
+		if msg.Content != "" {
+			nodes = append(nodes, msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[string]float64, len(nodes))
+
+	for _, chunk := range nodes.chunk(model, sentimentChunkTokens) {
+		chatHistory, err := chunk.contentsChatHistory(DefaultSentimentPrompt)
+		if err != nil {
+			return nil, err
+		}
+
+		chunkScores, err := askJSON(ctx, client, model, chatHistory, retry, func(chunkScores []float64) error {
+			if len(chunkScores) != len(chunk) {
+				return fmt.Errorf("expected %d scores, got %d", len(chunk), len(chunkScores))
+			}
+			for _, score := range chunkScores {
+				if score < -1 || score > 1 {
+					return fmt.Errorf("score %v out of range [-1, 1]", score)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to score sentiment of %d chat messages: %w", len(chunk), err)
+		}
+
+		for i, msg := range chunk {
+			scores[msg.ID] = chunkScores[i]
+		}
+	}
+
+	return scores, nil
+}
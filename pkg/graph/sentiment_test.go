@@ -0,0 +1,58 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessagesSentiment(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+	chat.GetMessageByID("a").Content = "I love this!"
+	chat.GetMessageByID("b").Content = "This is terrible."
+	chat.GetMessageByID("c").Content = ""
+
+	var requests int
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		requests++
+
+		var contents []string
+		if err := json.Unmarshal([]byte(req.Messages[1].Content), &contents); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(contents) != 2 {
+			t.Fatalf("expected 2 messages to score, got %q", contents)
+		}
+
+		return "```json\n[0.9, -0.75]\n```"
+	})
+
+	scores, err := chat.Messages.Sentiment(context.Background(), client, openai.ModelGPT4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 1 {
+		t.Fatalf("expected messages to be scored in a single request, got %d", requests)
+	}
+
+	if len(scores) != 2 || scores["a"] != 0.9 || scores["b"] != -0.75 {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	for _, response := range []string{`[0.5]`, `[2, 0]`, `not json`} {
+		invalid := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+			return response
+		})
+
+		if _, err := chat.Messages.Sentiment(context.Background(), invalid, openai.ModelGPT4, nil); !errors.Is(err, graph.ErrInvalidModelResponse) {
+			t.Fatalf("expected error %v for response %q, got %v", graph.ErrInvalidModelResponse, response, err)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// sqliteSchema is the schema used by SQLiteStore, which is created if it
+// doesn't already exist.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS chats (
+	id   TEXT PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	chat_id    TEXT NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+	id         TEXT NOT NULL,
+	position   INTEGER NOT NULL,
+	role       TEXT NOT NULL,
+	content    TEXT NOT NULL,
+	embedding  BLOB,
+	created_at TEXT,
+	metadata   TEXT,
+	PRIMARY KEY (chat_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS edges (
+	chat_id    TEXT NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+	message_id TEXT NOT NULL,
+	direction  TEXT NOT NULL CHECK (direction IN ('in', 'out')),
+	position   INTEGER NOT NULL,
+	target_id  TEXT NOT NULL,
+	weight     REAL,
+	label      TEXT,
+	PRIMARY KEY (chat_id, message_id, direction, position)
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+	chat_id    TEXT NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+	message_id TEXT NOT NULL,
+	position   INTEGER NOT NULL,
+	tag        TEXT NOT NULL,
+	PRIMARY KEY (chat_id, message_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS tags_tag ON tags (tag);
+`
+
+// SQLiteStore is a Store that saves chats in a SQLite database, using
+// normalized tables, so conversations can be queried with SQL:
+//
+//   - chats: the ID and name of each chat.
+//   - messages: the ID, role, content, embedding (as little-endian float32s),
+//     creation time (as RFC 3339), and metadata (as JSON) of each message in
+//     a chat, and its position in the chat's messages.
+//   - edges: the ID of each "in" and "out" message of each message in a chat,
+//     with their direction ("in" or "out"), position, and weight and label
+//     (for "out" messages with one in the message's OutWeights or OutLabels).
+//   - tags: the tags of each message in a chat, with their position, and
+//     indexed by tag, to find tagged messages across chats.
+//
+// Every table's primary key starts with the chat ID, so a single chat is
+// loaded without scanning the messages of other chats.
+//
+// The store uses the given *sql.DB, so any SQLite driver can be used
+// (e.g. github.com/mattn/go-sqlite3 or modernc.org/sqlite).
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore returns a new store using the given SQLite database,
+// creating the tables if they don't already exist.
+func NewSQLiteStore(ctx context.Context, db *sql.DB) (*SQLiteStore, error) {
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		return nil, fmt.Errorf("failed to create SQLite store schema: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Save implements the Store interface, replacing any previously saved
+// messages of the chat in a single transaction.
+//
+// Messages only reachable through the "in" or "out" messages of others are
+// saved, and loaded, as top-level messages, after the original ones. Message
+// IDs must be unique within a chat.
+func (s *SQLiteStore) Save(ctx context.Context, chat *Chat) (err error) {
+	if chat.ID == "" {
+		return fmt.Errorf("failed to save chat: %w", ErrMissingChatID)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to save chat %q: %w", chat.ID, err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := s.save(ctx, tx, chat); err != nil {
+		return fmt.Errorf("failed to save chat %q: %w", chat.ID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save chat %q: %w", chat.ID, err)
+	}
+
+	return nil
+}
+
+// save saves the chat using the given transaction.
+func (s *SQLiteStore) save(ctx context.Context, tx *sql.Tx, chat *Chat) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO chats (id, name) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET name = excluded.name`,
+		chat.ID, chat.Name,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"tags", "edges", "messages"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE chat_id = ?`, chat.ID); err != nil {
+			return err
+		}
+	}
+
+	insertMessage, err := tx.PrepareContext(ctx,
+		`INSERT INTO messages (chat_id, id, position, role, content, embedding, created_at, metadata) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer insertMessage.Close()
+
+	insertEdge, err := tx.PrepareContext(ctx,
+		`INSERT INTO edges (chat_id, message_id, direction, position, target_id, weight, label) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer insertEdge.Close()
+
+	insertTag, err := tx.PrepareContext(ctx,
+		`INSERT INTO tags (chat_id, message_id, position, tag) VALUES (?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer insertTag.Close()
+
+	for i, msg := range chat.flatten() {
+		metadata, err := encodeMetadata(msg.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata of message %q: %w", msg.ID, err)
+		}
+
+		if _, err := insertMessage.ExecContext(ctx, chat.ID, msg.ID, i, msg.Role, msg.Content, encodeEmbedding(msg.Embedding), encodeTime(msg.CreatedAt), metadata); err != nil {
+			return fmt.Errorf("failed to insert message %q: %w", msg.ID, err)
+		}
+
+		for j, tag := range msg.Tags {
+			if _, err := insertTag.ExecContext(ctx, chat.ID, msg.ID, j, tag); err != nil {
+				return fmt.Errorf("failed to insert tag %q of message %q: %w", tag, msg.ID, err)
+			}
+		}
+
+		for _, edges := range []struct {
+			direction string
+			msgs      Messages
+		}{
+			{"in", msg.In},
+			{"out", msg.Out},
+		} {
+			for j, edge := range edges.msgs {
+				// Only "out" links have weights and labels, which are NULL if unset.
+				var weight, label any
+				if edges.direction == "out" {
+					if w, ok := msg.OutWeights[edge.ID]; ok {
+						weight = w
+					}
+					if l, ok := msg.OutLabels[edge.ID]; ok {
+						label = l
+					}
+				}
+
+				if _, err := insertEdge.ExecContext(ctx, chat.ID, msg.ID, edges.direction, j, edge.ID, weight, label); err != nil {
+					return fmt.Errorf("failed to insert %q message %q of message %q: %w", edges.direction, edge.ID, msg.ID, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Load implements the Store interface, hydrating the chat's messages.
+// Any "in" or "out" message that isn't in the chat is dropped, like
+// HydrateMessages.
+func (s *SQLiteStore) Load(ctx context.Context, id string) (*Chat, error) {
+	chat := &Chat{ID: id}
+
+	err := s.db.QueryRowContext(ctx, `SELECT name FROM chats WHERE id = ?`, id).Scan(&chat.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %q", ErrChatNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat %q: %w", id, err)
+	}
+
+	if err := s.loadMessages(ctx, chat); err != nil {
+		return nil, fmt.Errorf("failed to load messages of chat %q: %w", id, err)
+	}
+
+	if err := s.loadEdges(ctx, chat); err != nil {
+		return nil, fmt.Errorf("failed to load edges of chat %q: %w", id, err)
+	}
+
+	if err := s.loadTags(ctx, chat); err != nil {
+		return nil, fmt.Errorf("failed to load tags of chat %q: %w", id, err)
+	}
+
+	return chat, nil
+}
+
+// loadMessages loads the messages of the chat, without their edges.
+func (s *SQLiteStore) loadMessages(ctx context.Context, chat *Chat) error {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, role, content, embedding, created_at, metadata FROM messages WHERE chat_id = ? ORDER BY position`,
+		chat.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			msg       = &Message{}
+			embedding []byte
+			createdAt sql.NullString
+			metadata  []byte
+		)
+
+		if err := rows.Scan(&msg.ID, &msg.Role, &msg.Content, &embedding, &createdAt, &metadata); err != nil {
+			return err
+		}
+
+		msg.Embedding = decodeEmbedding(embedding)
+
+		if createdAt.Valid {
+			t, err := time.Parse(time.RFC3339Nano, createdAt.String)
+			if err != nil {
+				return fmt.Errorf("invalid creation time of message %q: %w", msg.ID, err)
+			}
+			msg.CreatedAt = t
+		}
+
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &msg.Metadata); err != nil {
+				return fmt.Errorf("invalid metadata of message %q: %w", msg.ID, err)
+			}
+		}
+
+		chat.Messages = append(chat.Messages, msg)
+	}
+
+	return rows.Err()
+}
+
+// loadEdges loads the "in" and "out" messages of the chat's messages,
+// which must already be loaded.
+func (s *SQLiteStore) loadEdges(ctx context.Context, chat *Chat) error {
+	index := make(map[string]*Message, len(chat.Messages))
+	for _, msg := range chat.Messages {
+		index[msg.ID] = msg
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT message_id, direction, target_id, weight, label FROM edges WHERE chat_id = ? ORDER BY message_id, direction, position`,
+		chat.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageID, direction, targetID string
+			weight                         sql.NullFloat64
+			label                          sql.NullString
+		)
+
+		if err := rows.Scan(&messageID, &direction, &targetID, &weight, &label); err != nil {
+			return err
+		}
+
+		msg, target := index[messageID], index[targetID]
+		if msg == nil || target == nil {
+			continue
+		}
+
+		switch direction {
+		case "in":
+			msg.In = append(msg.In, target)
+		case "out":
+			msg.Out = append(msg.Out, target)
+
+			if weight.Valid {
+				if msg.OutWeights == nil {
+					msg.OutWeights = map[string]float64{}
+				}
+				msg.OutWeights[targetID] = weight.Float64
+			}
+
+			if label.Valid {
+				if msg.OutLabels == nil {
+					msg.OutLabels = map[string]string{}
+				}
+				msg.OutLabels[targetID] = label.String
+			}
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadTags loads the tags of the chat's messages, which must already be loaded.
+func (s *SQLiteStore) loadTags(ctx context.Context, chat *Chat) error {
+	index := make(map[string]*Message, len(chat.Messages))
+	for _, msg := range chat.Messages {
+		index[msg.ID] = msg
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT message_id, tag FROM tags WHERE chat_id = ? ORDER BY message_id, position`,
+		chat.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID, tag string
+		if err := rows.Scan(&messageID, &tag); err != nil {
+			return err
+		}
+
+		if msg := index[messageID]; msg != nil {
+			msg.Tags = append(msg.Tags, tag)
+		}
+	}
+
+	return rows.Err()
+}
+
+// encodeEmbedding returns the embedding as little-endian float32s,
+// or nil (NULL) if there isn't one.
+func encodeEmbedding(embedding []float32) any {
+	if embedding == nil {
+		return nil
+	}
+
+	b := make([]byte, 0, 4*len(embedding))
+	for _, v := range embedding {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+
+	return b
+}
+
+// decodeEmbedding returns the embedding encoded by encodeEmbedding.
+func decodeEmbedding(b []byte) []float32 {
+	if len(b) == 0 {
+		return nil
+	}
+
+	embedding := make([]float32, len(b)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+
+	return embedding
+}
+
+// encodeTime returns the time as RFC 3339, or nil (NULL) if it's zero.
+func encodeTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// encodeMetadata returns the metadata as JSON, or nil (NULL) if there isn't any.
+func encodeMetadata(metadata map[string]any) (any, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,59 @@
+package graph_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "chats.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store, err := graph.NewSQLiteStore(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store)
+
+	t.Run("resave", func(t *testing.T) {
+		ctx := context.Background()
+
+		chat := newTestThread("a", "b", "c")
+		if err := store.Save(ctx, chat); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := chat.RemoveMessage("c"); err != nil {
+			t.Fatal(err)
+		}
+		chat.Messages = chat.Messages[:2]
+		chat.Name = "Renamed"
+
+		if err := store.Save(ctx, chat); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded, err := store.Load(ctx, chat.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if loaded.Name != "Renamed" || len(loaded.Messages) != 2 {
+			t.Fatalf("expected renamed chat with 2 messages, got %q with %d", loaded.Name, len(loaded.Messages))
+		}
+
+		if err := loaded.Validate(graph.WithStrictSymmetry()); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,260 @@
+package graph
+
+import (
+	"context"
+	"slices"
+)
+
+// GraphStats is a structural overview of a chat graph, returned by Stats.
+type GraphStats struct {
+	// Messages is the number of messages in the graph.
+	Messages int `json:"messages"`
+
+	// Edges is the number of links between messages, counting each
+	// "out" message once.
+	Edges int `json:"edges"`
+
+	// Roots is the number of messages without any "in" messages.
+	Roots int `json:"roots"`
+
+	// Leaves is the number of messages without any "out" messages.
+	Leaves int `json:"leaves"`
+
+	// MaxDepth is the depth of the deepest message, as visited by VisitDepth,
+	// where the top-level messages are at depth 0.
+	MaxDepth int `json:"max_depth"`
+
+	// AverageBranching is the average number of "out" messages of the
+	// messages that have any (i.e. that aren't leaves).
+	AverageBranching float64 `json:"average_branching"`
+
+	// Roles is the number of messages for each role.
+	Roles map[string]int `json:"roles"`
+}
+
+// Stats returns a structural overview of the chat graph, computed in a
+// single traversal of every message reachable from the top-level messages.
+func (graph *Chat) Stats() GraphStats {
+	stats := GraphStats{
+		Roles: map[string]int{},
+	}
+
+	_ = graph.VisitDepth(context.Background(), -1, func(msg *Message, depth int) error {
+		stats.Messages++
+		stats.Edges += len(msg.Out)
+		stats.Roles[msg.Role]++
+
+		if len(msg.In) == 0 {
+			stats.Roots++
+		}
+
+		if len(msg.Out) == 0 {
+			stats.Leaves++
+		}
+
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+
+		return nil
+	})
+
+	if branches := stats.Messages - stats.Leaves; branches > 0 {
+		stats.AverageBranching = float64(stats.Edges) / float64(branches)
+	}
+
+	return stats
+}
+
+// ConnectedComponents returns each maximal set of messages that are connected
+// to each other, treating the "in" and "out" messages as undirected links, such
+// as separate conversations that were accidentally merged into a single graph.
+//
+// Links only recorded on one side (e.g. an "in" message that doesn't have the
+// message as an "out" message) still connect both messages. Components are
+// returned in the order they're first found from the top-level messages.
+func (graph *Chat) ConnectedComponents() []Messages {
+	var (
+		all      Messages
+		index    = map[*Message]int{}
+		parents  []int
+		seenMsgs = NewMessageSet()
+	)
+
+	// Find every message reachable from the top-level messages, in either direction.
+	for _, msg := range graph.Messages {
+		if msg == nil || seenMsgs.Has(msg) {
+			continue
+		}
+
+		seenMsgs.Add(msg)
+		start := len(all)
+		all = append(all, msg)
+
+		for i := start; i < len(all); i++ {
+			for _, links := range []Messages{all[i].In, all[i].Out} {
+				for _, next := range links {
+					if next == nil || seenMsgs.Has(next) {
+						continue
+					}
+
+					seenMsgs.Add(next)
+					all = append(all, next)
+				}
+			}
+		}
+	}
+
+	for i, msg := range all {
+		index[msg] = i
+		parents = append(parents, i)
+	}
+
+	// Union-find, with path halving.
+	find := func(i int) int {
+		for parents[i] != i {
+			parents[i] = parents[parents[i]]
+			i = parents[i]
+		}
+		return i
+	}
+
+	union := func(i, j int) {
+		i, j = find(i), find(j)
+		if i == j {
+			return
+		}
+		// Keep the earliest message as the root, to preserve the order components are found.
+		if j < i {
+			i, j = j, i
+		}
+		parents[j] = i
+	}
+
+	for i, msg := range all {
+		for _, links := range []Messages{msg.In, msg.Out} {
+			for _, next := range links {
+				if next != nil {
+					union(i, index[next])
+				}
+			}
+		}
+	}
+
+	var (
+		components []Messages
+		positions  = map[int]int{}
+	)
+
+	for i, msg := range all {
+		root := find(i)
+
+		pos, ok := positions[root]
+		if !ok {
+			pos = len(components)
+			positions[root] = pos
+			components = append(components, nil)
+		}
+
+		components[pos] = append(components[pos], msg)
+	}
+
+	return components
+}
+
+// Neighbors returns copies of the "in" and "out" messages of the message
+// with the given ID.
+func (graph *Chat) Neighbors(id string) (in Messages, out Messages, err error) {
+	msg, err := graph.findMessage(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return slices.Clone(msg.In), slices.Clone(msg.Out), nil
+}
+
+// Degree returns the number of "in" and "out" messages of the message with
+// the given ID, such as to find branch points with a high "out" degree.
+func (graph *Chat) Degree(id string) (inDeg, outDeg int, err error) {
+	msg, err := graph.findMessage(id)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return len(msg.In), len(msg.Out), nil
+}
+
+// EdgesWithLabel returns a (from, to) pair of messages for each link to an "out"
+// message with the given label in OutLabels, in the same order as Visit, such
+// as every "correction" in a conversation.
+func (graph *Chat) EdgesWithLabel(label string) [][2]*Message {
+	var edges [][2]*Message
+
+	for _, msg := range graph.nodes() {
+		for _, out := range msg.Out {
+			if out == nil {
+				continue
+			}
+
+			if l, ok := msg.OutLabels[out.ID]; ok && l == label {
+				edges = append(edges, [2]*Message{msg, out})
+			}
+		}
+	}
+
+	return edges
+}
+
+// RoleTransitions returns the number of links to "out" messages between each
+// pair of roles, by the role of the message, then the role of its "out" message
+// (e.g. transitions["user"]["assistant"]), computed in a single traversal of
+// every message, such as to spot consecutive assistant messages.
+func (graph *Chat) RoleTransitions() map[string]map[string]int {
+	transitions := map[string]map[string]int{}
+
+	_ = graph.Visit(context.Background(), func(msg *Message) error {
+		for _, out := range msg.Out {
+			if out == nil {
+				continue
+			}
+
+			if transitions[msg.Role] == nil {
+				transitions[msg.Role] = map[string]int{}
+			}
+			transitions[msg.Role][out.Role]++
+		}
+
+		return nil
+	})
+
+	return transitions
+}
+
+// Unreachable returns the messages in the graph that can't be reached by
+// following the "out" messages from a root message (without any "in" messages),
+// in the same order as Visit, such as orphaned messages left behind by edits,
+// that are only in the graph because they're top-level messages, or messages
+// in a cycle without a root.
+//
+// Unlike Validate, this doesn't consider these messages a problem, since a
+// graph doesn't have to be rooted, but an application that traverses a graph
+// from its roots would silently skip them.
+func (graph *Chat) Unreachable() Messages {
+	nodes := graph.nodes()
+
+	reachable := NewMessageSet()
+	for _, msg := range nodes {
+		if len(msg.In) == 0 {
+			_ = VisitMessages(context.Background(), msg, reachable, func(*Message) error { return nil })
+		}
+	}
+
+	var unreachable Messages
+	for _, msg := range nodes {
+		if !reachable.Has(msg) {
+			unreachable = append(unreachable, msg)
+		}
+	}
+
+	return unreachable
+}
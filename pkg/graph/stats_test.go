@@ -0,0 +1,175 @@
+package graph_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatStats(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// Branch off of "b" with an alternative reply.
+	alt := &graph.Message{ID: "c2", ChatMessage: openai.ChatMessage{Role: openai.ChatRoleUser}}
+	chat.GetMessageByID("b").AddOutIn(alt)
+
+	stats := chat.Stats()
+
+	if stats.Messages != 5 {
+		t.Fatalf("expected 5 messages, got %d", stats.Messages)
+	}
+
+	if stats.Edges != 4 {
+		t.Fatalf("expected 4 edges, got %d", stats.Edges)
+	}
+
+	if stats.Roots != 1 || stats.Leaves != 2 {
+		t.Fatalf("expected 1 root and 2 leaves, got %d and %d", stats.Roots, stats.Leaves)
+	}
+
+	if stats.MaxDepth != 3 {
+		t.Fatalf("expected max depth of 3, got %d", stats.MaxDepth)
+	}
+
+	// a, b, and c have 4 "out" messages between them.
+	if want := 4.0 / 3.0; stats.AverageBranching != want {
+		t.Fatalf("expected average branching of %v, got %v", want, stats.AverageBranching)
+	}
+
+	if stats.Roles[openai.ChatRoleUser] != 3 || stats.Roles[openai.ChatRoleAssistant] != 2 {
+		t.Fatalf("unexpected role counts: %v", stats.Roles)
+	}
+}
+
+func TestChatConnectedComponents(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// A separate conversation, only linked from its first message.
+	x, y := &graph.Message{ID: "x"}, &graph.Message{ID: "y"}
+	x.AddOut(y)
+
+	// A message only linked "in" from an existing conversation.
+	z := &graph.Message{ID: "z"}
+	z.AddIn(chat.GetMessageByID("c"))
+
+	chat.Messages = append(chat.Messages, z, x)
+
+	components := chat.ConnectedComponents()
+
+	if len(components) != 2 {
+		t.Fatalf("expected 2 components, got %d", len(components))
+	}
+
+	if ids := strings.Join(components[0].IDs(), ","); ids != "a,b,c,z" {
+		t.Fatalf("expected first component %q, got %q", "a,b,c,z", ids)
+	}
+
+	if ids := strings.Join(components[1].IDs(), ","); ids != "x,y" {
+		t.Fatalf("expected second component %q, got %q", "x,y", ids)
+	}
+}
+
+func TestChatNeighbors(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// Branch off of "b" with an alternative reply.
+	chat.GetMessageByID("b").AddOutIn(&graph.Message{ID: "c2"})
+
+	in, out, err := chat.Neighbors("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := strings.Join(in.IDs(), ","); ids != "a" {
+		t.Fatalf("expected in %q, got %q", "a", ids)
+	}
+
+	if ids := strings.Join(out.IDs(), ","); ids != "c,c2" {
+		t.Fatalf("expected out %q, got %q", "c,c2", ids)
+	}
+
+	inDeg, outDeg, err := chat.Degree("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inDeg != 1 || outDeg != 2 {
+		t.Fatalf("expected degree (1, 2), got (%d, %d)", inDeg, outDeg)
+	}
+
+	if _, _, err := chat.Neighbors("z"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+
+	if _, _, err := chat.Degree("z"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+}
+
+func TestChatEdgesWithLabel(t *testing.T) {
+	chat := newTestThread("a", "b")
+
+	b := chat.GetMessageByID("b")
+	b.AddOutLabeled(&graph.Message{ID: "c"}, "reply")
+	b.AddOutLabeled(&graph.Message{ID: "d"}, "citation")
+	b.AddOutLabeled(&graph.Message{ID: "e"}, "reply")
+
+	var pairs []string
+	for _, edge := range chat.EdgesWithLabel("reply") {
+		pairs = append(pairs, edge[0].ID+"-"+edge[1].ID)
+	}
+
+	if got := strings.Join(pairs, ","); got != "b-c,b-e" {
+		t.Fatalf("expected edges %q, got %q", "b-c,b-e", got)
+	}
+
+	// Unlabeled links aren't included, even for an empty label.
+	if edges := chat.EdgesWithLabel(""); len(edges) != 0 {
+		t.Fatalf("expected no edges, got %d", len(edges))
+	}
+}
+
+func TestChatRoleTransitions(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// A second assistant reply, right after the first.
+	chat.GetMessageByID("d").AddOutIn(graph.NewMessage(openai.ChatRoleAssistant, "message e"))
+
+	transitions := chat.RoleTransitions()
+
+	user, assistant := openai.ChatRoleUser, openai.ChatRoleAssistant
+
+	if transitions[user][assistant] != 2 || transitions[assistant][user] != 1 || transitions[assistant][assistant] != 1 {
+		t.Fatalf("unexpected transitions %v", transitions)
+	}
+
+	if transitions[user][user] != 0 {
+		t.Fatalf("expected no user to user transitions, got %d", transitions[user][user])
+	}
+}
+
+func TestChatUnreachable(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// A message only linked "in" from an existing conversation.
+	z := &graph.Message{ID: "z"}
+	z.AddIn(chat.GetMessageByID("c"))
+
+	// A cycle without a root.
+	x, y := &graph.Message{ID: "x"}, &graph.Message{ID: "y"}
+	x.AddOutIn(y)
+	y.AddOutIn(x)
+
+	chat.Messages = append(chat.Messages, z, x)
+
+	if ids := strings.Join(chat.Unreachable().IDs(), ","); ids != "z,x,y" {
+		t.Fatalf("expected unreachable messages %q, got %q", "z,x,y", ids)
+	}
+
+	if unreachable := newTestThread("a", "b").Unreachable(); len(unreachable) != 0 {
+		t.Fatalf("expected no unreachable messages, got %v", unreachable.IDs())
+	}
+}
@@ -0,0 +1,203 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// ErrChatNotFound is returned when a chat with a given ID is not in a store.
+	ErrChatNotFound = errors.New("chat not found")
+
+	// ErrMissingChatID is returned when saving a chat without an ID to a store.
+	ErrMissingChatID = errors.New("missing chat ID")
+)
+
+// Store persists chat graphs, to be loaded again later by ID, enabling
+// long-term memory for conversations across processes.
+//
+// Implementations must save every message reachable from the chat's
+// top-level messages, and return fully hydrated graphs when loaded.
+type Store interface {
+	// Save saves the chat, replacing any chat with the same ID.
+	Save(ctx context.Context, chat *Chat) error
+
+	// Load loads the chat with the given ID, or returns an
+	// ErrChatNotFound error if it hasn't been saved.
+	Load(ctx context.Context, id string) (*Chat, error)
+}
+
+// MemoryStore is an in-memory Store, which is safe for concurrent use.
+//
+// Chats are copied with Clone when saved and loaded, so changes to a chat
+// aren't persisted until it's saved again.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	chats map[string]*Chat
+}
+
+// NewMemoryStore returns a new, empty, in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		chats: map[string]*Chat{},
+	}
+}
+
+// Save implements the Store interface.
+func (s *MemoryStore) Save(ctx context.Context, chat *Chat) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if chat.ID == "" {
+		return fmt.Errorf("failed to save chat: %w", ErrMissingChatID)
+	}
+
+	clone := chat.Clone()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chats[chat.ID] = clone
+
+	return nil
+}
+
+// Load implements the Store interface.
+func (s *MemoryStore) Load(ctx context.Context, id string) (*Chat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	chat, ok := s.chats[id]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrChatNotFound, id)
+	}
+
+	return chat.Clone(), nil
+}
+
+// FileStore is a Store that saves each chat as a JSON file in a directory,
+// named after the chat's (escaped) ID.
+//
+// Messages only reachable through the "in" or "out" messages of others are
+// saved, and loaded, as top-level messages, after the original ones.
+type FileStore struct {
+	// Dir is the directory the chat files are saved in.
+	Dir string
+}
+
+// NewFileStore returns a new store that saves chats in the given directory,
+// creating it if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	return &FileStore{Dir: dir}, nil
+}
+
+// path returns the path of the file for the chat with the given ID.
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.Dir, url.PathEscape(id)+".json")
+}
+
+// Save implements the Store interface.
+//
+// The file is written atomically, by writing a temporary file in the
+// same directory first, and then renaming it.
+func (s *FileStore) Save(ctx context.Context, chat *Chat) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if chat.ID == "" {
+		return fmt.Errorf("failed to save chat: %w", ErrMissingChatID)
+	}
+
+	b, err := json.Marshal(&Chat{
+		ID:       chat.ID,
+		Name:     chat.Name,
+		Messages: chat.flatten(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode chat %q: %w", chat.ID, err)
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".chat-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save chat %q: %w", chat.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save chat %q: %w", chat.ID, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save chat %q: %w", chat.ID, err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(chat.ID)); err != nil {
+		return fmt.Errorf("failed to save chat %q: %w", chat.ID, err)
+	}
+
+	return nil
+}
+
+// Load implements the Store interface, hydrating the chat with HydrateMessages.
+func (s *FileStore) Load(ctx context.Context, id string) (*Chat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrChatNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat %q: %w", id, err)
+	}
+
+	var chat Chat
+	if err := json.Unmarshal(b, &chat); err != nil {
+		return nil, fmt.Errorf("failed to decode chat %q: %w", id, err)
+	}
+
+	chat.HydrateMessages(ctx)
+
+	return &chat, nil
+}
+
+// flatten returns the top-level messages, followed by every other message
+// in the graph, in depth-first order, so each message is only included once.
+func (graph *Chat) flatten() Messages {
+	seenMsgs := NewMessageSet()
+
+	flat := make(Messages, 0, len(graph.Messages))
+	for _, msg := range graph.Messages {
+		if msg != nil && !seenMsgs.Has(msg) {
+			seenMsgs.Add(msg)
+			flat = append(flat, msg)
+		}
+	}
+
+	for _, msg := range graph.nodes() {
+		if !seenMsgs.Has(msg) {
+			seenMsgs.Add(msg)
+			flat = append(flat, msg)
+		}
+	}
+
+	return flat
+}
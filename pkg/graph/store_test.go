@@ -0,0 +1,129 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// testStore saves a branched chat graph in the given store, and checks
+// that it's loaded back the same way.
+func testStore(t *testing.T, store graph.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	chat := newTestThread("a", "b", "c")
+	chat.GetMessageByID("b").Content = `Say "hello"` + "\n" + `\o/`
+	chat.GetMessageByID("b").Embedding = []float32{0.25, -1, 3.5}
+	chat.GetMessageByID("b").Metadata = map[string]any{"user": "jon", "cost": 0.5}
+	chat.GetMessageByID("b").AddTag("important")
+	chat.GetMessageByID("b").AddTag("needs-review")
+	chat.GetMessageByID("b").CreatedAt = time.Date(2023, 3, 26, 12, 30, 0, 5, time.FixedZone("EST", -5*60*60))
+
+	// A message only reachable through the "out" messages of another, with a weighted, labeled, link.
+	b2 := graph.NewMessage(openai.ChatRoleAssistant, "message b2")
+	chat.GetMessageByID("a").AddOutWeighted(b2, 2.5)
+	chat.GetMessageByID("a").OutLabels = map[string]string{b2.ID: "retry"}
+
+	if err := store.Save(ctx, chat); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes after saving aren't persisted.
+	chat.GetMessageByID("c").Content = "changed"
+
+	loaded, err := store.Load(ctx, chat.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.ID != chat.ID || loaded.Name != chat.Name {
+		t.Fatalf("expected chat %q (%q), got %q (%q)", chat.ID, chat.Name, loaded.ID, loaded.Name)
+	}
+
+	if content := loaded.GetMessageByID("b").Content; content != `Say "hello"`+"\n"+`\o/` {
+		t.Fatalf("unexpected content %q", content)
+	}
+
+	if embedding := loaded.GetMessageByID("b").Embedding; !slices.Equal(embedding, []float32{0.25, -1, 3.5}) {
+		t.Fatalf("unexpected embedding %v", embedding)
+	}
+
+	if embedding := loaded.GetMessageByID("a").Embedding; embedding != nil {
+		t.Fatalf("expected no embedding, got %v", embedding)
+	}
+
+	if createdAt := loaded.GetMessageByID("b").CreatedAt; !createdAt.Equal(chat.GetMessageByID("b").CreatedAt) {
+		t.Fatalf("unexpected creation time %v", createdAt)
+	}
+
+	if metadata := loaded.GetMessageByID("b").Metadata; metadata["user"] != "jon" || metadata["cost"] != 0.5 {
+		t.Fatalf("unexpected metadata %v", metadata)
+	}
+
+	if tags := loaded.GetMessageByID("b").Tags; !slices.Equal(tags, []string{"important", "needs-review"}) {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	if a := loaded.GetMessageByID("a"); a.OutWeight(a.Out.GetByID(b2.ID)) != 2.5 || a.OutWeight(a.Out.GetByID("b")) != graph.DefaultEdgeWeight {
+		t.Fatalf("unexpected weights %v", a.OutWeights)
+	}
+
+	if a := loaded.GetMessageByID("a"); a.OutLabel(a.Out.GetByID(b2.ID)) != "retry" || a.OutLabel(a.Out.GetByID("b")) != "" {
+		t.Fatalf("unexpected labels %v", a.OutLabels)
+	}
+
+	if metadata := loaded.GetMessageByID("a").Metadata; metadata != nil {
+		t.Fatalf("expected no metadata, got %v", metadata)
+	}
+
+	if createdAt := loaded.GetMessageByID("a").CreatedAt; !createdAt.IsZero() {
+		t.Fatalf("expected no creation time, got %v", createdAt)
+	}
+
+	if content := loaded.GetMessageByID("c").Content; content != "message c" {
+		t.Fatalf("expected content %q, got %q", "message c", content)
+	}
+
+	if !loaded.Messages.Hydrated() {
+		t.Fatalf("expected loaded messages to be hydrated")
+	}
+
+	a := loaded.GetMessageByID("a")
+	if len(a.Out) != 2 || a.Out[1].Content != "message b2" {
+		t.Fatalf("expected a.Out to include b2, got %v", a.Out)
+	}
+
+	if err := loaded.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, graph.ErrChatNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrChatNotFound, err)
+	}
+
+	// A chat without an ID isn't confused with a message without one.
+	err = store.Save(ctx, &graph.Chat{Messages: chat.Messages})
+	if !errors.Is(err, graph.ErrMissingChatID) || errors.Is(err, graph.ErrMissingID) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMissingChatID, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, graph.NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := graph.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store)
+}
@@ -0,0 +1,475 @@
+package graph
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/picatz/openai"
+)
+
+// DefaultCombineSummaryPrompt is the default prompt used to combine partial summaries
+// into a single summary for the SummarizeChunked method.
+var DefaultCombineSummaryPrompt = strings.Join(
+	[]string{
+		"You are an expert at summarization that answers as concisely as possible.",
+		"You are given consecutive partial summaries of a single, longer conversation, in order.",
+		"Combine them into one coherent summary, including all the key information (e.g. people, places, events, things, etc) to continue on the conversation.",
+		"Do not include any unnecessary information, or a prefix in the output.",
+	}, " ",
+)
+
+// SummarizeChunked summarizes the messages using the OpenAI API, like Summarize,
+// but without sending more than (roughly) maxTokens worth of messages in a single
+// request, which allows summarizing conversations that exceed the model's context.
+//
+// The messages are split into consecutive chunks of at most maxTokens, each chunk
+// is summarized, and then the summaries are combined the same way, recursively,
+// until they fit in a single chunk. A single message that exceeds maxTokens is
+// summarized on its own.
+func (msgs Messages) SummarizeChunked(ctx context.Context, client *openai.Client, model string, maxTokens int) (string, error) {
+	if maxTokens <= 0 {
+		return "", fmt.Errorf("invalid chunk size of %d tokens", maxTokens)
+	}
+
+	// System messages are not included in summaries.
+	msgs = msgs.Match(func(m *Message) bool {
+		return m.Role != openai.ChatRoleSystem
+	})
+
+	prompt := DefaultSummaryPrompt
+
+	for round := 0; ; round++ {
+		chunks := msgs.chunk(model, maxTokens)
+
+		if len(chunks) <= 1 {
+			return msgs.SummarizeWithSystemPrompt(ctx, client, model, prompt)
+		}
+
+		// If every partial summary is still too large to be combined with another,
+		// summarizing them again would never converge.
+		if round > 0 && len(chunks) == len(msgs) {
+			return "", fmt.Errorf("failed to combine %d partial summaries within %d tokens", len(msgs), maxTokens)
+		}
+
+		summaries := make(Messages, 0, len(chunks))
+
+		for i, chunk := range chunks {
+			summary, err := chunk.SummarizeWithSystemPrompt(ctx, client, model, prompt)
+			if err != nil {
+				return "", fmt.Errorf("failed to summarize chunk %d of %d: %w", i+1, len(chunks), err)
+			}
+
+			summaries = append(summaries, &Message{
+				ChatMessage: openai.ChatMessage{
+					Role:    openai.ChatRoleAssistant,
+					Content: summary,
+				},
+			})
+		}
+
+		msgs = summaries
+		prompt = DefaultCombineSummaryPrompt
+	}
+}
+
+// SummarizeStream summarizes the messages using the streaming OpenAI chat API,
+// calling onDelta with each chunk of the summary as it arrives, and returning
+// the complete summary once the stream is finished.
+//
+// If onDelta returns an error, the stream is cancelled and the error is returned.
+func (msgs Messages) SummarizeStream(ctx context.Context, client *openai.Client, model string, onDelta func(string) error) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chatHistory, err := msgs.summaryChatHistory(ctx, DefaultSummaryPrompt, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.CreateChat(ctx, &openai.CreateChatRequest{
+		Model:    model,
+		Messages: chatHistory,
+		Stream:   true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create summary stream of %d chat messages: %w", len(msgs), err)
+	}
+	defer resp.Stream.Close()
+
+	var summary strings.Builder
+
+	// The stream is a series of server-sent events, where each "data" field
+	// contains a JSON encoded chunk of the response, until "[DONE]".
+	scanner := bufio.NewScanner(resp.Stream)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta openai.ChatMessage `json:"delta"`
+			} `json:"choices"`
+		}
+
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("failed to decode summary stream chunk: %w", err)
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+
+			summary.WriteString(choice.Delta.Content)
+
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read summary stream: %w", err)
+	}
+
+	return summary.String(), nil
+}
+
+// chunk splits the messages into consecutive chunks whose TokenCount for the
+// given model does not exceed maxTokens, unless a single message does.
+func (msgs Messages) chunk(model string, maxTokens int) []Messages {
+	var (
+		chunks []Messages
+		chunk  Messages
+		used   int
+	)
+
+	for _, msg := range msgs {
+		tokens := msg.TokenCount(model)
+
+		if len(chunk) > 0 && used+tokens > maxTokens {
+			chunks = append(chunks, chunk)
+			chunk, used = nil, 0
+		}
+
+		if len(chunk) == 0 {
+			used = replyPrimingTokens
+		}
+
+		chunk = append(chunk, msg)
+		used += tokens
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// CompressOldest replaces all but the most recent keepRecent top-level messages
+// with a single assistant message containing a summary of them, created with
+// Summarize, to keep long conversations within a model's context.
+//
+// A leading system message is never compressed. The summary message is added
+// just before the retained messages, and any retained message that was linked
+// from the compressed messages is now linked from the summary message instead.
+// If no retained message was linked, the summary is linked to the first one.
+//
+// Branches that were only reachable through the compressed messages (e.g. an
+// alternative answer to a compressed question) aren't summarized, but are kept,
+// linked from the summary message, after the retained messages it links to.
+func (graph *Chat) CompressOldest(ctx context.Context, client *openai.Client, model string, keepRecent int) error {
+	if keepRecent < 0 {
+		keepRecent = 0
+	}
+
+	start := 0
+	if len(graph.Messages) > 0 && graph.Messages[0].Role == openai.ChatRoleSystem {
+		start = 1
+	}
+
+	// Nothing to compress.
+	if len(graph.Messages)-start <= keepRecent {
+		return nil
+	}
+
+	var (
+		end    = len(graph.Messages) - keepRecent
+		oldest = append(Messages{}, graph.Messages[start:end]...)
+		recent = append(Messages{}, graph.Messages[end:]...)
+	)
+
+	summary, err := oldest.Summarize(ctx, client, model)
+	if err != nil {
+		return fmt.Errorf("failed to compress %d messages: %w", len(oldest), err)
+	}
+
+	summaryMsg := NewMessage(openai.ChatRoleAssistant, summary)
+
+	compressed := NewMessageSet()
+	for _, msg := range oldest {
+		compressed.Add(msg)
+	}
+
+	// Find the retained messages that link to, or from, the compressed messages.
+	var parents, children Messages
+
+	for _, msg := range append(graph.Messages[:start:start], recent...) {
+		for _, in := range msg.In {
+			if compressed.Has(in) && !children.contains(msg) {
+				children = append(children, msg)
+			}
+		}
+		for _, out := range msg.Out {
+			if compressed.Has(out) && !parents.contains(msg) {
+				parents = append(parents, msg)
+			}
+		}
+	}
+
+	if len(children) == 0 && len(recent) > 0 {
+		children = recent[:1]
+	}
+
+	graph.removeMessages(oldest)
+
+	// Removing the compressed messages adds the messages that were only
+	// reachable through them to the top-level messages, which are linked
+	// from the summary message instead.
+	retained := NewMessageSet()
+	for _, msg := range append(graph.Messages[:start:start], recent...) {
+		retained.Add(msg)
+	}
+
+	for _, msg := range graph.Messages {
+		if !retained.Has(msg) && !children.contains(msg) {
+			children = append(children, msg)
+		}
+	}
+
+	// Add the summary message just before the retained messages.
+	graph.Messages = append(graph.Messages[:start:start], append(Messages{summaryMsg}, recent...)...)
+
+	for _, parent := range parents {
+		parent.AddOutIn(summaryMsg)
+	}
+
+	for _, child := range children {
+		summaryMsg.AddOutIn(child)
+	}
+
+	return nil
+}
+
+// SummarizeBranch summarizes only the thread leading to the message with the
+// given ID, as found by ThreadTo using the WithEarliestParent option, instead
+// of every message in a branched graph, which would blend unrelated branches.
+func (graph *Chat) SummarizeBranch(ctx context.Context, client *openai.Client, model, leafID string) (string, error) {
+	thread, err := graph.ThreadTo(leafID, WithEarliestParent())
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize branch: %w", err)
+	}
+
+	return thread.Summarize(ctx, client, model)
+}
+
+// SummarizeRecent summarizes only the last n messages using the OpenAI API,
+// like Summarize, such as to maintain a rolling summary of a conversation.
+//
+// If n is larger than the number of messages, every message is summarized,
+// and if it's negative, none are.
+func (msgs Messages) SummarizeRecent(ctx context.Context, client *openai.Client, model string, n int) (string, error) {
+	n = max(0, min(n, len(msgs)))
+
+	return msgs[len(msgs)-n:].Summarize(ctx, client, model)
+}
+
+// SummarizeWithTemplate summarizes the messages using the OpenAI API, like
+// SummarizeWithSystemPrompt, with the system prompt rendered from the given
+// text/template and data, such as to vary the length or tone of summaries
+// without rewriting the whole prompt:
+//
+//	summary, err := msgs.SummarizeWithTemplate(ctx, client, model,
+//		"Summarize the conversation in at most {{.MaxWords}} words, in a {{.Style}} style.",
+//		map[string]any{"MaxWords": 50, "Style": "formal"},
+//	)
+//
+// An error is returned if the template can't be parsed or executed, including
+// when it refers to a key missing from a map, before any request is made.
+func (msgs Messages) SummarizeWithTemplate(ctx context.Context, client *openai.Client, model string, tmpl string, data any) (string, error) {
+	t, err := template.New("summary").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse summary prompt template: %w", err)
+	}
+
+	var prompt strings.Builder
+	if err := t.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("failed to execute summary prompt template: %w", err)
+	}
+
+	return msgs.SummarizeWithSystemPrompt(ctx, client, model, prompt.String())
+}
+
+// SummarizeToFit summarizes the messages using the OpenAI API, like Summarize,
+// but first drops the oldest messages that don't fit in the model's context
+// length, as found by ContextLength, leaving reserveForReply tokens for the
+// summary, instead of failing on a long conversation. If even the most recent
+// message doesn't fit by itself, a copy of it is truncated with TruncateTokens.
+//
+// Tokens are estimated with TokenCount, including the summary prompt. An error
+// is returned if the model's context length is unknown, and an ErrTokenLimit
+// error if the prompt alone doesn't fit. Use SummarizeChunked to summarize every
+// message of a conversation too long for a single request instead.
+func (msgs Messages) SummarizeToFit(ctx context.Context, client *openai.Client, model string, reserveForReply int) (string, error) {
+	length, err := ContextLength(model)
+	if err != nil {
+		return "", err
+	}
+
+	prompt, err := Messages{}.summaryChatHistory(ctx, DefaultSummaryPrompt, false)
+	if err != nil {
+		return "", err
+	}
+
+	request := make(Messages, len(prompt))
+	for i, chatMsg := range prompt {
+		request[i] = &Message{ChatMessage: chatMsg}
+	}
+
+	// The tokens left for the transcript, where each message is a line, which
+	// are counted separately, since a line break always ends a token.
+	available := length - reserveForReply - request.TokenCount(model)
+
+	lineTokens := func(msg *Message) int {
+		return estimateTokens(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	}
+
+	// System messages aren't summarized, so they don't count.
+	conversation := msgs.Match(func(msg *Message) bool {
+		return msg.Role != openai.ChatRoleSystem
+	})
+
+	start := len(conversation)
+	for i := len(conversation) - 1; i >= 0; i-- {
+		tokens := lineTokens(conversation[i])
+		if tokens > available {
+			break
+		}
+
+		available -= tokens
+		start = i
+	}
+
+	kept := conversation[start:]
+
+	// Truncate the most recent message if it doesn't fit by itself.
+	if len(kept) == 0 && len(conversation) > 0 {
+		latest := conversation[len(conversation)-1].copyWithoutEdges()
+
+		// Only the content can be truncated, so count the rest of its line
+		// like TruncateTokens counts the rest of a message.
+		overhead := tokensPerMessage(model) + estimateTokens(latest.Role)
+		empty := &Message{ChatMessage: openai.ChatMessage{Role: latest.Role}}
+
+		if err := latest.TruncateTokens(model, available-lineTokens(empty)+overhead); err != nil {
+			return "", fmt.Errorf("failed to fit summary of %d chat messages in %d tokens: %w", len(msgs), length-reserveForReply, err)
+		}
+
+		kept = Messages{latest}
+	}
+
+	return kept.Summarize(ctx, client, model)
+}
+
+// summarizeBranchesWorkers is the number of branches summarized concurrently
+// by SummarizeAllBranches.
+const summarizeBranchesWorkers = 4
+
+// SummarizeAllBranches summarizes every branch of the conversation, like
+// SummarizeBranch, for each leaf message (without any "out" messages), and
+// returns the summaries by leaf ID, such as to compare the branches explored
+// from a conversation at a glance.
+//
+// A few branches are summarized concurrently, so a conversation with many
+// branches doesn't take as long as summarizing them one at a time. If a branch
+// can't be summarized, or the context is cancelled, the remaining branches are
+// cancelled, and the first error is returned.
+func (graph *Chat) SummarizeAllBranches(ctx context.Context, client *openai.Client, model string) (map[string]string, error) {
+	leaves := graph.nodes().Match(func(msg *Message) bool {
+		return len(msg.Out) == 0
+	})
+
+	threads := make([]Messages, len(leaves))
+	for i, leaf := range leaves {
+		thread, err := graph.ThreadTo(leaf.ID, WithEarliestParent())
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize branch: %w", err)
+		}
+		threads[i] = thread
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		summaries = make([]string, len(leaves))
+		sem       = make(chan struct{}, summarizeBranchesWorkers)
+		wg        sync.WaitGroup
+		errOnce   sync.Once
+		firstErr  error
+	)
+
+	for i, thread := range threads {
+		// Stop if the context has been cancelled.
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				summary, err := thread.Summarize(ctx, client, model)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("failed to summarize branch ending with message %q: %w", leaves[i].ID, err)
+						cancel()
+					})
+					return
+				}
+
+				summaries[i] = summary
+			}()
+		}
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(leaves))
+	for i, leaf := range leaves {
+		result[leaf.ID] = summaries[i]
+	}
+
+	return result, nil
+}
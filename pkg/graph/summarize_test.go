@@ -0,0 +1,392 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessagesSummarizeChunked(t *testing.T) {
+	msgs := graph.Messages{}
+	for i := 0; i < 10; i++ {
+		msgs = append(msgs, &graph.Message{
+			ID: fmt.Sprint(i),
+			ChatMessage: openai.ChatMessage{
+				Role:    openai.ChatRoleUser,
+				Content: strings.Repeat("word ", 20),
+			},
+		})
+	}
+
+	var requests, combines int
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		requests++
+		if req.Messages[0].Content == graph.DefaultCombineSummaryPrompt {
+			combines++
+		}
+		return "summary"
+	})
+
+	// Each chunk fits about two messages.
+	budget := msgs[:2].TokenCount(openai.ModelGPT4)
+
+	summary, err := msgs.SummarizeChunked(context.Background(), client, openai.ModelGPT4, budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary != "summary" {
+		t.Fatalf("expected summary %q, got %q", "summary", summary)
+	}
+
+	if requests < 6 {
+		t.Fatalf("expected at least 6 requests, got %d", requests)
+	}
+
+	if combines == 0 {
+		t.Fatalf("expected partial summaries to be combined")
+	}
+}
+
+func TestMessagesSummarizeStream(t *testing.T) {
+	msgs := graph.Messages{
+		{
+			ID: "1",
+			ChatMessage: openai.ChatMessage{
+				Role:    openai.ChatRoleUser,
+				Content: "Who is Jon Snow's father?",
+			},
+		},
+	}
+
+	client := newTestClient(t, func(r *http.Request) (int, string) {
+		var b strings.Builder
+		for _, delta := range []string{"Jon ", "Snow's ", "father"} {
+			fmt.Fprintf(&b, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		b.WriteString("data: [DONE]\n\n")
+		return http.StatusOK, b.String()
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		var deltas []string
+
+		summary, err := msgs.SummarizeStream(context.Background(), client, openai.ModelGPT4, func(delta string) error {
+			deltas = append(deltas, delta)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if summary != "Jon Snow's father" {
+			t.Fatalf("expected summary %q, got %q", "Jon Snow's father", summary)
+		}
+
+		if len(deltas) != 3 {
+			t.Fatalf("expected 3 deltas, got %d", len(deltas))
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		stop := errors.New("stop")
+
+		_, err := msgs.SummarizeStream(context.Background(), client, openai.ModelGPT4, func(delta string) error {
+			return stop
+		})
+		if !errors.Is(err, stop) {
+			t.Fatalf("expected error %v, got %v", stop, err)
+		}
+	})
+}
+
+func TestChatCompressOldest(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d", "e")
+
+	system := graph.NewMessage(openai.ChatRoleSystem, "You are a helpful assistant.")
+	chat.Messages = append(graph.Messages{system}, chat.Messages...)
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		transcript := req.Messages[1].Content
+		for _, content := range []string{"message a", "message b", "message c"} {
+			if !strings.Contains(transcript, content) {
+				t.Fatalf("expected transcript to contain %q, got %q", content, transcript)
+			}
+		}
+		if strings.Contains(transcript, "message d") {
+			t.Fatalf("expected transcript to not contain recent messages, got %q", transcript)
+		}
+		return "summary of a, b, and c"
+	})
+
+	// An alternative answer to "a", only reachable through a compressed message.
+	x := &graph.Message{ID: "x"}
+	chat.GetMessageByID("a").AddOutIn(x)
+
+	if err := chat.CompressOldest(context.Background(), client, openai.ModelGPT4, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chat.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d: %v", len(chat.Messages), chat.Messages.IDs())
+	}
+
+	summary := chat.Messages[1]
+
+	if chat.Messages[0] != system || summary.Content != "summary of a, b, and c" {
+		t.Fatalf("expected system message followed by the summary, got %v", chat.Messages)
+	}
+
+	d := chat.GetMessageByID("d")
+	if len(d.In) != 1 || d.In[0] != summary {
+		t.Fatalf("expected d.In to be the summary, got %v", d.In.IDs())
+	}
+
+	if ids := strings.Join(summary.Out.IDs(), ","); ids != "d,x" {
+		t.Fatalf("expected the summary to link to d, and the kept branch x, got %q", ids)
+	}
+
+	if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChatSummarizeBranch(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// Branch off of "a" with an alternative thread.
+	b2 := graph.NewMessage(openai.ChatRoleAssistant, "message b2")
+	chat.GetMessageByID("a").AddOutIn(b2)
+	chat.AddMessage(b2)
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		transcript := req.Messages[1].Content
+		if !strings.Contains(transcript, "message a") || !strings.Contains(transcript, "message b2") {
+			t.Fatalf("expected transcript of the branch, got %q", transcript)
+		}
+		if strings.Contains(transcript, "message b\n") || strings.Contains(transcript, "message c") {
+			t.Fatalf("expected transcript to not contain other branches, got %q", transcript)
+		}
+		return "summary of b2"
+	})
+
+	summary, err := chat.SummarizeBranch(context.Background(), client, openai.ModelGPT4, b2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary != "summary of b2" {
+		t.Fatalf("expected summary %q, got %q", "summary of b2", summary)
+	}
+
+	if _, err := chat.SummarizeBranch(context.Background(), client, openai.ModelGPT4, "z"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+}
+
+func TestMessagesSummarizeWithOptions(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage(openai.ChatRoleSystem, "You are a pirate."),
+		graph.NewMessage(openai.ChatRoleUser, "Hello!"),
+	}
+
+	var transcript string
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		transcript = req.Messages[1].Content
+		return "summary"
+	})
+
+	if _, err := msgs.SummarizeWithOptions(context.Background(), client, openai.ModelGPT4, graph.SummarizeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(transcript, "pirate") {
+		t.Fatalf("expected system messages to be skipped by default, got %q", transcript)
+	}
+
+	if _, err := msgs.SummarizeWithOptions(context.Background(), client, openai.ModelGPT4, graph.SummarizeOptions{IncludeSystem: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "system: You are a pirate.\nuser: Hello!\n"; transcript != want {
+		t.Fatalf("expected transcript %q, got %q", want, transcript)
+	}
+
+	empty := newTestClient(t, func(r *http.Request) (int, string) {
+		return http.StatusOK, `{"choices": []}`
+	})
+
+	if _, err := msgs.SummarizeWithOptions(context.Background(), empty, openai.ModelGPT4, graph.SummarizeOptions{}); err == nil || !strings.Contains(err.Error(), "no choices") {
+		t.Fatalf("expected an error without any choices, got %v", err)
+	}
+}
+
+func TestMessagesSummarizeRecent(t *testing.T) {
+	msgs := newTestThread("a", "b", "c", "d").Messages
+
+	var transcript string
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		transcript = req.Messages[1].Content
+		return "summary"
+	})
+
+	for _, tc := range []struct {
+		n    int
+		want string
+	}{
+		{n: 2, want: "user: message c\nassistant: message d\n"},
+		{n: 10, want: "user: message a\nassistant: message b\nuser: message c\nassistant: message d\n"},
+		{n: -1, want: ""},
+	} {
+		if _, err := msgs.SummarizeRecent(context.Background(), client, openai.ModelGPT4, tc.n); err != nil {
+			t.Fatal(err)
+		}
+
+		if transcript != tc.want {
+			t.Fatalf("expected transcript %q for n=%d, got %q", tc.want, tc.n, transcript)
+		}
+	}
+}
+
+func TestMessagesSummarizeWithTemplate(t *testing.T) {
+	msgs := newTestThread("a", "b").Messages
+
+	var prompt string
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		prompt = req.Messages[0].Content
+		return "summary"
+	})
+
+	data := struct {
+		MaxWords int
+		Style    string
+	}{50, "formal"}
+
+	summary, err := msgs.SummarizeWithTemplate(context.Background(), client, openai.ModelGPT4, "Use at most {{.MaxWords}} words, in a {{.Style}} style.", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary != "summary" || prompt != "Use at most 50 words, in a formal style." {
+		t.Fatalf("unexpected summary %q with prompt %q", summary, prompt)
+	}
+
+	for _, tmpl := range []string{"{{.MaxWords", "{{.Tone}}"} {
+		if _, err := msgs.SummarizeWithTemplate(context.Background(), client, openai.ModelGPT4, tmpl, map[string]any{"MaxWords": 50}); err == nil {
+			t.Fatalf("expected an error for template %q", tmpl)
+		}
+	}
+}
+
+func TestMessagesSummarizeToFit(t *testing.T) {
+	const model = "test-model"
+
+	// The prompt used to summarize, without any messages.
+	promptTokens := graph.Messages{
+		graph.NewMessage(openai.ChatRoleSystem, graph.DefaultSummaryPrompt),
+		graph.NewMessage(openai.ChatRoleUser, ""),
+	}.TokenCount(model)
+
+	// Room for the prompt, a reply of 100 tokens, and the last two messages,
+	// which are 5 ("user: message c"), and 7 ("assistant: message d") tokens.
+	graph.ModelContextLengths[model] = promptTokens + 100 + 12
+	defer delete(graph.ModelContextLengths, model)
+
+	msgs := newTestThread("a", "b", "c", "d").Messages
+
+	var transcript string
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		transcript = req.Messages[1].Content
+		return "summary"
+	})
+
+	if _, err := msgs.SummarizeToFit(context.Background(), client, model, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "user: message c\nassistant: message d\n"; transcript != want {
+		t.Fatalf("expected transcript %q, got %q", want, transcript)
+	}
+
+	// The most recent message is truncated if it doesn't fit by itself.
+	long := graph.Messages{graph.NewMessage(openai.ChatRoleUser, "one two three four five six")}
+
+	if _, err := long.SummarizeToFit(context.Background(), client, model, 100+12-6); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "user: one two three\n"; transcript != want {
+		t.Fatalf("expected transcript %q, got %q", want, transcript)
+	}
+
+	if _, err := msgs.SummarizeToFit(context.Background(), client, model, 1000); !errors.Is(err, graph.ErrTokenLimit) {
+		t.Fatalf("expected error %v, got %v", graph.ErrTokenLimit, err)
+	}
+
+	if _, err := msgs.SummarizeToFit(context.Background(), client, "unknown-model", 100); !errors.Is(err, graph.ErrUnknownModel) {
+		t.Fatalf("expected error %v, got %v", graph.ErrUnknownModel, err)
+	}
+}
+
+func TestChatSummarizeAllBranches(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// An alternative answer to "a", and an alternative question after "b".
+	b2 := graph.NewMessage(openai.ChatRoleAssistant, "message b2")
+	c2 := graph.NewMessage(openai.ChatRoleUser, "message c2")
+	b2.ID, c2.ID = "b2", "c2"
+	chat.GetMessageByID("a").AddOutIn(b2)
+	chat.GetMessageByID("b").AddOutIn(c2)
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		lines := strings.Split(strings.TrimSpace(req.Messages[1].Content), "\n")
+		return fmt.Sprintf("%d messages, ending with %q", len(lines), lines[len(lines)-1])
+	})
+
+	summaries, err := chat.SummarizeAllBranches(context.Background(), client, openai.ModelGPT4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"c":  `3 messages, ending with "user: message c"`,
+		"c2": `3 messages, ending with "user: message c2"`,
+		"b2": `2 messages, ending with "assistant: message b2"`,
+	}
+
+	if len(summaries) != len(want) {
+		t.Fatalf("expected %d summaries, got %v", len(want), summaries)
+	}
+
+	for id, summary := range want {
+		if summaries[id] != summary {
+			t.Fatalf("expected summary %q for %q, got %q", summary, id, summaries[id])
+		}
+	}
+
+	failing := newTestClient(t, func(r *http.Request) (int, string) {
+		return http.StatusInternalServerError, `{"error": {"message": "server error"}}`
+	})
+
+	if _, err := chat.SummarizeAllBranches(context.Background(), failing, openai.ModelGPT4); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := chat.SummarizeAllBranches(ctx, client, openai.ModelGPT4); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+}
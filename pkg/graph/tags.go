@@ -0,0 +1,51 @@
+package graph
+
+import "slices"
+
+// AddTag adds the given tag to the message, if it doesn't already have it.
+func (m *Message) AddTag(tag string) {
+	if !m.HasTag(tag) {
+		m.Tags = append(m.Tags, tag)
+	}
+}
+
+// HasTag returns true if the message has the given tag.
+func (m *Message) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// MessagesWithTag returns every message in the graph with the given tag,
+// in depth-first order.
+//
+// Every message is checked, so use a TagIndex for repeated lookups.
+func (graph *Chat) MessagesWithTag(tag string) Messages {
+	return graph.nodes().Match(func(m *Message) bool {
+		return m.HasTag(tag)
+	})
+}
+
+// TagIndex is an index of messages by tag, to efficiently look up the
+// messages with a tag, built by the TagIndex method of a graph.
+//
+// The index isn't updated when tags are added to messages, so it
+// must be rebuilt to include them.
+type TagIndex map[string]Messages
+
+// TagIndex returns an index of every message in the graph by tag,
+// with the messages for each tag in depth-first order.
+func (graph *Chat) TagIndex() TagIndex {
+	index := TagIndex{}
+
+	for _, msg := range graph.nodes() {
+		for _, tag := range msg.Tags {
+			index[tag] = append(index[tag], msg)
+		}
+	}
+
+	return index
+}
+
+// MessagesWithTag returns the indexed messages with the given tag.
+func (index TagIndex) MessagesWithTag(tag string) Messages {
+	return index[tag]
+}
@@ -0,0 +1,39 @@
+package graph_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMessageTags(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	a, c := chat.GetMessageByID("a"), chat.GetMessageByID("c")
+
+	a.AddTag("important")
+	a.AddTag("important")
+	a.AddTag("needs-review")
+	c.AddTag("important")
+
+	if tags := strings.Join(a.Tags, ","); tags != "important,needs-review" {
+		t.Fatalf("expected tags %q, got %q", "important,needs-review", tags)
+	}
+
+	if !a.HasTag("needs-review") || c.HasTag("needs-review") {
+		t.Fatalf("unexpected HasTag results")
+	}
+
+	if ids := strings.Join(chat.MessagesWithTag("important").IDs(), ","); ids != "a,c" {
+		t.Fatalf("expected messages %q, got %q", "a,c", ids)
+	}
+
+	index := chat.TagIndex()
+
+	if ids := strings.Join(index.MessagesWithTag("important").IDs(), ","); ids != "a,c" {
+		t.Fatalf("expected indexed messages %q, got %q", "a,c", ids)
+	}
+
+	if msgs := index.MessagesWithTag("missing"); len(msgs) != 0 {
+		t.Fatalf("expected no messages, got %v", msgs.IDs())
+	}
+}
@@ -0,0 +1,321 @@
+package graph
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+
+	"github.com/picatz/openai"
+)
+
+// ErrAmbiguousThread is returned when the thread leading to a message can't be
+// determined because a message along the way has more than one "in" message.
+var ErrAmbiguousThread = errors.New("ambiguous thread")
+
+// ErrNoCommonAncestor is returned when two messages don't share an ancestor.
+var ErrNoCommonAncestor = errors.New("no common ancestor")
+
+// ErrCycle is returned when a graph contains a cycle, but an operation requires it not to.
+var ErrCycle = errors.New("cycle in graph")
+
+// ThreadOption configures the ThreadTo method.
+type ThreadOption func(*threadOptions)
+
+type threadOptions struct {
+	earliestParent bool
+}
+
+// WithEarliestParent is a ThreadOption that follows the earliest "in" message
+// (the first one added) when a message has more than one, instead of returning
+// an ErrAmbiguousThread error.
+func WithEarliestParent() ThreadOption {
+	return func(o *threadOptions) {
+		o.earliestParent = true
+	}
+}
+
+// ThreadTo returns the linear thread of messages leading to the message with
+// the given ID, ordered from the root message to the given message, which is
+// the conversation to replay to a model to continue from that message.
+//
+// The thread is found by following the "in" messages upward until a message
+// without any "in" messages (the root) is reached, or a message is repeated
+// because of a cycle.
+//
+// # Ambiguity
+//
+// If a message along the way has more than one "in" message, the thread is
+// ambiguous, and an ErrAmbiguousThread error is returned by default. Use the
+// WithEarliestParent option to follow the earliest "in" message instead.
+func (graph *Chat) ThreadTo(id string, opts ...ThreadOption) (Messages, error) {
+	var o threadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	msg, err := graph.findMessage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := Messages{msg}
+
+	seenMsgs := NewMessageSet()
+	seenMsgs.Add(msg)
+
+	for current := msg; len(current.In) > 0; {
+		if len(current.In) > 1 && !o.earliestParent {
+			return nil, fmt.Errorf("%w: message %q has %d \"in\" messages", ErrAmbiguousThread, current.ID, len(current.In))
+		}
+
+		parent := current.In[0]
+
+		// Stop at the first repeated message if there's a cycle.
+		if seenMsgs.Has(parent) {
+			break
+		}
+
+		seenMsgs.Add(parent)
+		thread = append(thread, parent)
+		current = parent
+	}
+
+	// Reverse the thread, to be ordered from the root to the message.
+	for i, j := 0, len(thread)-1; i < j; i, j = i+1, j-1 {
+		thread[i], thread[j] = thread[j], thread[i]
+	}
+
+	return thread, nil
+}
+
+// Fork returns a new graph, with a new unique ID, containing a deep copy of
+// the thread leading to the message with the given ID, as found by ThreadTo
+// using the WithEarliestParent option, so the conversation can be continued
+// from that message independently, without modifying this graph.
+//
+// The copied messages keep their IDs, and are linked from the root to the
+// given message using AddOutIn.
+func (graph *Chat) Fork(atID string) (*Chat, error) {
+	thread, err := graph.ThreadTo(atID, WithEarliestParent())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fork at message %q: %w", atID, err)
+	}
+
+	fork := &Chat{
+		ID:       newID(),
+		Name:     graph.Name,
+		Messages: make(Messages, len(thread)),
+	}
+
+	for i, msg := range thread {
+		fork.Messages[i] = msg.copyWithoutEdges()
+
+		if i > 0 {
+			fork.Messages[i-1].AddOutIn(fork.Messages[i])
+		}
+	}
+
+	return fork, nil
+}
+
+// CommonAncestor returns the nearest message that both messages with the given
+// IDs descend from, following their "in" messages upward, which is where two
+// branches of a conversation diverged.
+//
+// A message is considered its own ancestor, so if one message is an ancestor
+// of the other, it's returned. If more than one common ancestor is equally
+// near, the one found first from the second message is returned. If the
+// messages don't share an ancestor, an ErrNoCommonAncestor error is returned.
+func (graph *Chat) CommonAncestor(idA, idB string) (*Message, error) {
+	a, err := graph.findMessage(idA)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := graph.findMessage(idB)
+	if err != nil {
+		return nil, err
+	}
+
+	distA, _ := ancestors(a)
+	distB, orderB := ancestors(b)
+
+	var (
+		nearest *Message
+		best    int
+	)
+
+	for _, msg := range orderB {
+		d, ok := distA[msg]
+		if !ok {
+			continue
+		}
+
+		if dist := d + distB[msg]; nearest == nil || dist < best {
+			nearest, best = msg, dist
+		}
+	}
+
+	if nearest == nil {
+		return nil, fmt.Errorf("%w: messages %q and %q", ErrNoCommonAncestor, idA, idB)
+	}
+
+	return nearest, nil
+}
+
+// DiffBranches compares two branches of a conversation, ending with the messages
+// with the given IDs (typically leaves, such as two alternative continuations
+// regenerated from the same point), returning the thread they have in common,
+// from the root to their CommonAncestor, followed by the messages of each
+// branch after it, which are empty if a message is an ancestor of the other.
+//
+// Each branch is the thread leading to its message, found by ThreadTo using the
+// WithEarliestParent option. An ErrNoCommonAncestor error is returned if the
+// messages don't share an ancestor, and an ErrAmbiguousThread error if their
+// common ancestor isn't on the earliest thread leading to both of them.
+func (graph *Chat) DiffBranches(leafA, leafB string) (commonPrefix Messages, branchA Messages, branchB Messages, err error) {
+	ancestor, err := graph.CommonAncestor(leafA, leafB)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	threadA, err := graph.ThreadTo(leafA, WithEarliestParent())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	threadB, err := graph.ThreadTo(leafB, WithEarliestParent())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	i, j := indexOf(threadA, ancestor), indexOf(threadB, ancestor)
+	if i < 0 || j < 0 {
+		return nil, nil, nil, fmt.Errorf("%w: common ancestor %q of messages %q and %q isn't on the earliest thread to both", ErrAmbiguousThread, ancestor.ID, leafA, leafB)
+	}
+
+	return threadA[:i+1], threadA[i+1:], threadB[j+1:], nil
+}
+
+// ancestors returns the distance to every message reachable by following the
+// "in" messages upward from the given message (including itself, at zero), and
+// the messages in breadth-first-search order.
+func ancestors(msg *Message) (map[*Message]int, Messages) {
+	dist := map[*Message]int{msg: 0}
+	order := Messages{msg}
+
+	for i := 0; i < len(order); i++ {
+		current := order[i]
+
+		for _, parent := range current.In {
+			if parent == nil {
+				continue
+			}
+
+			if _, ok := dist[parent]; ok {
+				continue
+			}
+
+			dist[parent] = dist[current] + 1
+			order = append(order, parent)
+		}
+	}
+
+	return dist, order
+}
+
+// TopologicalSort returns every message in the graph, ordered so that each
+// message comes before all of its "out" messages, which linearizes a branched
+// conversation into a single sequence.
+//
+// The sort is stable: when more than one message could come next, the one
+// visited first by Visit is used, so a linear thread is returned in order. An
+// ErrCycle error is returned if the messages can't be ordered because of a cycle.
+func (graph *Chat) TopologicalSort() (Messages, error) {
+	nodes := graph.nodes()
+
+	index := make(map[*Message]int, len(nodes))
+	for i, msg := range nodes {
+		index[msg] = i
+	}
+
+	// Count the "in" links of each message, using their "out" messages.
+	inDegree := make([]int, len(nodes))
+	for _, msg := range nodes {
+		for _, out := range msg.Out {
+			if i, ok := index[out]; ok {
+				inDegree[i]++
+			}
+		}
+	}
+
+	ready := &intHeap{}
+	for i, degree := range inDegree {
+		if degree == 0 {
+			heap.Push(ready, i)
+		}
+	}
+
+	sorted := make(Messages, 0, len(nodes))
+
+	for ready.Len() > 0 {
+		msg := nodes[heap.Pop(ready).(int)]
+		sorted = append(sorted, msg)
+
+		for _, out := range msg.Out {
+			i, ok := index[out]
+			if !ok {
+				continue
+			}
+
+			inDegree[i]--
+			if inDegree[i] == 0 {
+				heap.Push(ready, i)
+			}
+		}
+	}
+
+	if len(sorted) != len(nodes) {
+		return nil, fmt.Errorf("%w: %d of %d messages can't be ordered", ErrCycle, len(nodes)-len(sorted), len(nodes))
+	}
+
+	return sorted, nil
+}
+
+// intHeap is a min-heap of ints, implementing heap.Interface.
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *intHeap) Push(x any) { *h = append(*h, x.(int)) }
+
+func (h *intHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// QAPairs returns each pair of a user message (the question) and an assistant
+// message in its "out" messages (the answer), in the same depth-first order as
+// Visit, such as to build a dataset for evaluation. A question with more than
+// one answer is included in a pair for each answer.
+func (graph *Chat) QAPairs() [][2]*Message {
+	var pairs [][2]*Message
+
+	for _, msg := range graph.nodes() {
+		if msg.Role != openai.ChatRoleUser {
+			continue
+		}
+
+		for _, out := range msg.Out {
+			if out != nil && out.Role == openai.ChatRoleAssistant {
+				pairs = append(pairs, [2]*Message{msg, out})
+			}
+		}
+	}
+
+	return pairs
+}
@@ -0,0 +1,229 @@
+package graph_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatThreadTo(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// Branch off of "b" with an alternative reply.
+	b := chat.GetMessageByID("b")
+	alt := &graph.Message{ID: "c2"}
+	b.AddOutIn(alt)
+	chat.Messages = append(chat.Messages, alt)
+
+	t.Run("linear", func(t *testing.T) {
+		thread, err := chat.ThreadTo("d")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := strings.Join(thread.IDs(), ","); ids != "a,b,c,d" {
+			t.Fatalf("expected thread %q, got %q", "a,b,c,d", ids)
+		}
+	})
+
+	t.Run("branch", func(t *testing.T) {
+		thread, err := chat.ThreadTo("c2")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := strings.Join(thread.IDs(), ","); ids != "a,b,c2" {
+			t.Fatalf("expected thread %q, got %q", "a,b,c2", ids)
+		}
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		// Merge both branches into a single reply.
+		merge := &graph.Message{ID: "e"}
+		chat.GetMessageByID("c2").AddOutIn(merge)
+		chat.GetMessageByID("d").AddOutIn(merge)
+		chat.Messages = append(chat.Messages, merge)
+
+		_, err := chat.ThreadTo("e")
+		if !errors.Is(err, graph.ErrAmbiguousThread) {
+			t.Fatalf("expected error %v, got %v", graph.ErrAmbiguousThread, err)
+		}
+
+		thread, err := chat.ThreadTo("e", graph.WithEarliestParent())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := strings.Join(thread.IDs(), ","); ids != "a,b,c2,e" {
+			t.Fatalf("expected thread %q, got %q", "a,b,c2,e", ids)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := chat.ThreadTo("z")
+		if !errors.Is(err, graph.ErrMessageNotFound) {
+			t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+		}
+	})
+}
+
+func TestChatFork(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	fork, err := chat.Fork("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fork.ID == chat.ID {
+		t.Fatalf("expected fork to have a new ID")
+	}
+
+	if ids := strings.Join(fork.Messages.IDs(), ","); ids != "a,b,c" {
+		t.Fatalf("expected fork %q, got %q", "a,b,c", ids)
+	}
+
+	// Continue the fork with an alternative reply.
+	c := fork.GetMessageByID("c")
+	c.AddOutIn(&graph.Message{ID: "d2"})
+	c.Content = "changed"
+
+	if orig := chat.GetMessageByID("c"); orig == c || orig.Content != "message c" || len(orig.Out) != 1 || orig.Out[0].ID != "d" {
+		t.Fatalf("expected original graph to be untouched")
+	}
+
+	if _, err := chat.Fork("z"); !errors.Is(err, graph.ErrMessageNotFound) {
+		t.Fatalf("expected error %v, got %v", graph.ErrMessageNotFound, err)
+	}
+}
+
+func TestChatCommonAncestor(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// Branch off of "b" with an alternative thread.
+	c2 := &graph.Message{ID: "c2"}
+	d2 := &graph.Message{ID: "d2"}
+	chat.GetMessageByID("b").AddOutIn(c2)
+	c2.AddOutIn(d2)
+	chat.Messages = append(chat.Messages, c2, d2)
+
+	// An unrelated conversation.
+	other := &graph.Message{ID: "x"}
+	chat.Messages = append(chat.Messages, other)
+
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"d", "d2", "b"},
+		{"c", "c2", "b"},
+		{"b", "d2", "b"},
+		{"d", "a", "a"},
+		{"c", "c", "c"},
+	}
+
+	for _, test := range tests {
+		ancestor, err := chat.CommonAncestor(test.a, test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ancestor.ID != test.want {
+			t.Fatalf("expected common ancestor of %q and %q to be %q, got %q", test.a, test.b, test.want, ancestor.ID)
+		}
+	}
+
+	if _, err := chat.CommonAncestor("d", "x"); !errors.Is(err, graph.ErrNoCommonAncestor) {
+		t.Fatalf("expected error %v, got %v", graph.ErrNoCommonAncestor, err)
+	}
+}
+
+func TestChatDiffBranches(t *testing.T) {
+	chat := newTestThread("a", "b", "c", "d")
+
+	// Regenerate from "b" with an alternative thread.
+	c2 := &graph.Message{ID: "c2"}
+	chat.GetMessageByID("b").AddOutIn(c2)
+
+	tests := []struct {
+		a, b                     string
+		common, branchA, branchB string
+	}{
+		{"d", "c2", "a,b", "c,d", "c2"},
+		{"c2", "d", "a,b", "c2", "c,d"},
+		{"b", "d", "a,b", "", "c,d"},
+		{"d", "d", "a,b,c,d", "", ""},
+	}
+
+	for _, test := range tests {
+		common, branchA, branchB, err := chat.DiffBranches(test.a, test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{strings.Join(common.IDs(), ","), strings.Join(branchA.IDs(), ","), strings.Join(branchB.IDs(), ",")}
+		want := []string{test.common, test.branchA, test.branchB}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected branches of %q and %q to be %q, got %q", test.a, test.b, want, got)
+		}
+	}
+
+	chat.Messages = append(chat.Messages, &graph.Message{ID: "x"})
+
+	if _, _, _, err := chat.DiffBranches("d", "x"); !errors.Is(err, graph.ErrNoCommonAncestor) {
+		t.Fatalf("expected error %v, got %v", graph.ErrNoCommonAncestor, err)
+	}
+}
+
+func TestChatTopologicalSort(t *testing.T) {
+	t.Run("branched", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+
+		// Branch off of "a", and merge back into "c".
+		alt := &graph.Message{ID: "b2"}
+		chat.GetMessageByID("a").AddOutIn(alt)
+		alt.AddOutIn(chat.GetMessageByID("c"))
+
+		sorted, err := chat.TopologicalSort()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := strings.Join(sorted.IDs(), ","); ids != "a,b,b2,c" {
+			t.Fatalf("expected order %q, got %q", "a,b,b2,c", ids)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+		chat.GetMessageByID("c").AddOutIn(chat.GetMessageByID("a"))
+
+		if _, err := chat.TopologicalSort(); !errors.Is(err, graph.ErrCycle) {
+			t.Fatalf("expected error %v, got %v", graph.ErrCycle, err)
+		}
+	})
+}
+
+func TestChatQAPairs(t *testing.T) {
+	chat := newTestThread("q1", "a1", "q2", "a2")
+
+	// A regenerated answer to the first question, and a follow-up question.
+	regenerated := graph.NewMessage(openai.ChatRoleAssistant, "message a1b")
+	regenerated.ID = "a1b"
+	chat.GetMessageByID("q1").AddOutIn(regenerated)
+	chat.GetMessageByID("q2").AddOutIn(graph.NewMessage(openai.ChatRoleUser, "follow-up"))
+
+	var pairs []string
+	for _, pair := range chat.QAPairs() {
+		pairs = append(pairs, pair[0].ID+"-"+pair[1].ID)
+	}
+
+	if got := strings.Join(pairs, ","); got != "q1-a1,q1-a1b,q2-a2" {
+		t.Fatalf("expected pairs %q, got %q", "q1-a1,q1-a1b,q2-a2", got)
+	}
+}
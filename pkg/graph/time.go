@@ -0,0 +1,24 @@
+package graph
+
+import (
+	"sort"
+	"time"
+)
+
+// Between returns the messages created within the given time range, from start
+// (inclusive) to end (exclusive), in their original order. Messages without a
+// CreatedAt time are never included.
+func (msgs Messages) Between(start, end time.Time) Messages {
+	return msgs.Match(func(m *Message) bool {
+		return !m.CreatedAt.IsZero() && !m.CreatedAt.Before(start) && m.CreatedAt.Before(end)
+	})
+}
+
+// SortByTime sorts the messages in place by their CreatedAt time, oldest first,
+// which is useful when the links between messages don't imply a chronological
+// order. The sort is stable, and messages without a CreatedAt time come first.
+func (msgs Messages) SortByTime() {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+	})
+}
@@ -0,0 +1,40 @@
+package graph_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessagesBetween(t *testing.T) {
+	start := time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC)
+
+	chat := newTestThread("a", "b", "c", "d")
+	for i, msg := range chat.Messages[:3] {
+		msg.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+	}
+
+	between := chat.Messages.Between(start, start.Add(2*time.Hour))
+
+	if ids := strings.Join(between.IDs(), ","); ids != "a,b" {
+		t.Fatalf("expected messages %q, got %q", "a,b", ids)
+	}
+}
+
+func TestMessagesSortByTime(t *testing.T) {
+	start := time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC)
+
+	chat := newTestThread("a", "b", "c", "d")
+	chat.GetMessageByID("a").CreatedAt = start.Add(2 * time.Hour)
+	chat.GetMessageByID("b").CreatedAt = start
+	chat.GetMessageByID("c").CreatedAt = start.Add(time.Hour)
+
+	msgs := append(graph.Messages{}, chat.Messages...)
+	msgs.SortByTime()
+
+	if ids := strings.Join(msgs.IDs(), ","); ids != "d,b,c,a" {
+		t.Fatalf("expected messages %q, got %q", "d,b,c,a", ids)
+	}
+}
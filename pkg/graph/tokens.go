@@ -0,0 +1,305 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/picatz/openai"
+)
+
+// replyPrimingTokens is the number of tokens every reply is primed with
+// by the chat API (e.g. "<|start|>assistant<|message|>").
+const replyPrimingTokens = 3
+
+// tokensPerMessage returns the fixed number of tokens the chat API adds
+// around every message for the given model.
+func tokensPerMessage(model string) int {
+	if model == openai.ModelGPT35Turbo0301 {
+		return 4
+	}
+	return 3
+}
+
+// estimateTokens approximates the number of BPE tokens in the given text.
+//
+// It is a conservative estimate, not an exact tokenizer: runs of ASCII
+// letters and digits count as one token per four characters, ASCII
+// punctuation and symbols count as one token each, whitespace is folded
+// into the following token, and every non-ASCII rune counts as a token.
+func estimateTokens(s string) int {
+	var (
+		tokens int
+		run    int
+	)
+
+	flush := func() {
+		tokens += (run + 3) / 4
+		run = 0
+	}
+
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			run++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+
+	flush()
+
+	return tokens
+}
+
+// TokenCount returns an estimate of the number of prompt tokens the message
+// uses when sent to the given model, including the per-message overhead.
+func (m *Message) TokenCount(model string) int {
+	return tokensPerMessage(model) + estimateTokens(m.Role) + estimateTokens(m.Content)
+}
+
+// TokenCount returns an estimate of the number of prompt tokens the messages
+// use when sent to the given model, including the tokens used to prime the reply.
+func (msgs Messages) TokenCount(model string) int {
+	total := replyPrimingTokens
+	for _, msg := range msgs {
+		total += msg.TokenCount(model)
+	}
+	return total
+}
+
+// ContextWindow returns the most recent messages whose combined TokenCount
+// for the given model does not exceed maxTokens, in their original order,
+// ready to be passed to OpenAIChatMessages.
+//
+// Messages are selected by walking backward from the end of the collection,
+// stopping at the first message that doesn't fit, so the window is always a
+// contiguous tail of the conversation. A leading system message is always
+// kept, even if it alone exceeds the budget, and its tokens count against
+// maxTokens.
+//
+// A message that alone exceeds the remaining budget is dropped, along with
+// every message before it. So, if the most recent message doesn't fit, the
+// window will only contain the leading system message, if any.
+func (msgs Messages) ContextWindow(model string, maxTokens int) Messages {
+	var (
+		system Messages
+		rest   = msgs
+	)
+
+	if len(rest) > 0 && rest[0].Role == openai.ChatRoleSystem {
+		system, rest = rest[:1], rest[1:]
+	}
+
+	used := system.TokenCount(model)
+
+	start := len(rest)
+	for i := len(rest) - 1; i >= 0; i-- {
+		tokens := rest[i].TokenCount(model)
+		if used+tokens > maxTokens {
+			break
+		}
+		used += tokens
+		start = i
+	}
+
+	window := make(Messages, 0, len(system)+len(rest)-start)
+	window = append(window, system...)
+	window = append(window, rest[start:]...)
+
+	return window
+}
+
+// ErrUnknownModel is returned when a model is not in a registry, such as ModelContextLengths.
+var ErrUnknownModel = errors.New("unknown model")
+
+// ModelContextLengths is a registry of the maximum context length, in tokens,
+// of known models, shared by the prompt and the reply. It can be modified to
+// add (or override) models.
+var ModelContextLengths = map[string]int{
+	openai.ModelGPT35Turbo:     4096,
+	openai.ModelGPT35Turbo0301: 4096,
+	"gpt-3.5-turbo-16k":        16385,
+	"gpt-3.5-turbo-0125":       16385,
+	openai.ModelGPT4:           8192,
+	openai.ModelGPT40314:       8192,
+	"gpt-4-0613":               8192,
+	openai.ModelGPT432K:        32768,
+	openai.ModelGPT432K0314:    32768,
+	"gpt-4-turbo":              128000,
+	"gpt-4o":                   128000,
+	"gpt-4o-mini":              128000,
+}
+
+// ContextLength returns the maximum context length, in tokens,
+// of the given model from the ModelContextLengths registry.
+func ContextLength(model string) (int, error) {
+	length, ok := ModelContextLengths[model]
+	if !ok {
+		return 0, fmt.Errorf("%w: no context length for %q", ErrUnknownModel, model)
+	}
+	return length, nil
+}
+
+// TrimToModel returns the most recent messages that fit in the given model's
+// context length, leaving reserveForReply tokens for the reply, by dropping
+// the oldest messages (but never a leading system message), like ContextWindow.
+//
+// An error is returned if the model's context length is unknown.
+func (msgs Messages) TrimToModel(model string, reserveForReply int) (Messages, error) {
+	length, err := ContextLength(model)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgs.ContextWindow(model, length-reserveForReply), nil
+}
+
+// ModelPrice is the price of a model, in US dollars per 1,000 tokens.
+type ModelPrice struct {
+	// Prompt is the price of prompt (input) tokens.
+	Prompt float64
+
+	// Completion is the price of completion (output) tokens.
+	Completion float64
+}
+
+// ModelPrices is a registry of the prices of known models, used by EstimateCost.
+// Prices change over time, so it can be modified to add (or override) models.
+var ModelPrices = map[string]ModelPrice{
+	openai.ModelGPT35Turbo:     {Prompt: 0.0015, Completion: 0.002},
+	openai.ModelGPT35Turbo0301: {Prompt: 0.0015, Completion: 0.002},
+	"gpt-3.5-turbo-16k":        {Prompt: 0.003, Completion: 0.004},
+	"gpt-3.5-turbo-0125":       {Prompt: 0.0005, Completion: 0.0015},
+	openai.ModelGPT4:           {Prompt: 0.03, Completion: 0.06},
+	openai.ModelGPT40314:       {Prompt: 0.03, Completion: 0.06},
+	"gpt-4-0613":               {Prompt: 0.03, Completion: 0.06},
+	openai.ModelGPT432K:        {Prompt: 0.06, Completion: 0.12},
+	openai.ModelGPT432K0314:    {Prompt: 0.06, Completion: 0.12},
+	"gpt-4-turbo":              {Prompt: 0.01, Completion: 0.03},
+	"gpt-4o":                   {Prompt: 0.0025, Completion: 0.01},
+	"gpt-4o-mini":              {Prompt: 0.00015, Completion: 0.0006},
+}
+
+// EstimateCost estimates the number of prompt tokens, and their cost in US
+// dollars, of summarizing the messages with the given model using Summarize,
+// based on TokenCount and the ModelPrices registry. The cost of the summary
+// itself (the completion) isn't included, since its length isn't known.
+//
+// An error is returned if the model's price is unknown.
+func (msgs Messages) EstimateCost(model string) (promptTokens int, estDollars float64, err error) {
+	price, ok := ModelPrices[model]
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: no price for %q", ErrUnknownModel, model)
+	}
+
+	chatHistory, err := msgs.summaryChatHistory(context.Background(), DefaultSummaryPrompt, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	request := make(Messages, len(chatHistory))
+	for i, chatMsg := range chatHistory {
+		request[i] = &Message{ChatMessage: chatMsg}
+	}
+
+	promptTokens = request.TokenCount(model)
+
+	return promptTokens, float64(promptTokens) / 1000 * price.Prompt, nil
+}
+
+// ErrTokenLimit is returned when a token limit is too small to fit a message,
+// even without any content.
+var ErrTokenLimit = errors.New("token limit too small")
+
+// TruncateOption configures the TruncateTokens method.
+type TruncateOption func(*truncateOptions)
+
+type truncateOptions struct {
+	ellipsis bool
+}
+
+// WithEllipsis is a TruncateOption that appends an ellipsis ("…") to
+// truncated content, counted against the token limit.
+func WithEllipsis() TruncateOption {
+	return func(o *truncateOptions) {
+		o.ellipsis = true
+	}
+}
+
+// TruncateTokens trims the end of the message's content, so its TokenCount for
+// the given model doesn't exceed maxTokens, if it does, such as to keep a single
+// large message from dominating the context window.
+//
+// The content is cut at the end of a word, if possible, otherwise between runes,
+// so it stays valid UTF-8. An ErrTokenLimit error is returned, and the content
+// is left as-is, if the message doesn't fit even without any content.
+func (m *Message) TruncateTokens(model string, maxTokens int, opts ...TruncateOption) error {
+	var o truncateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if m.TokenCount(model) <= maxTokens {
+		return nil
+	}
+
+	budget := maxTokens - tokensPerMessage(model) - estimateTokens(m.Role)
+	if budget < 0 {
+		return fmt.Errorf("%w: message %q needs at least %d tokens, but the limit is %d", ErrTokenLimit, m.ID, maxTokens-budget, maxTokens)
+	}
+
+	var suffix string
+	if o.ellipsis && estimateTokens("…") <= budget {
+		suffix = "…"
+	}
+
+	fits := func(end int) bool {
+		return estimateTokens(m.Content[:end]+suffix) <= budget
+	}
+
+	// The ends of words, and of every rune, as the possible places to cut.
+	var (
+		wordEnds, runeEnds []int
+		prev               rune = ' '
+	)
+
+	for i, r := range m.Content {
+		if unicode.IsSpace(r) && !unicode.IsSpace(prev) {
+			wordEnds = append(wordEnds, i)
+		}
+		runeEnds = append(runeEnds, i)
+		prev = r
+	}
+
+	// Find the longest content that fits, with a binary search, since the
+	// number of tokens only grows with the length of the content.
+	end := 0
+	for _, ends := range [][]int{wordEnds, runeEnds} {
+		if n := sort.Search(len(ends), func(i int) bool { return !fits(ends[i]) }); n > 0 {
+			end = ends[n-1]
+			break
+		}
+	}
+
+	m.Content = m.Content[:end] + suffix
+
+	return nil
+}
+
+// TruncateEach truncates the content of each message with TruncateTokens, so
+// none exceed maxTokens for the given model, returning the first error, if any.
+func (msgs Messages) TruncateEach(model string, maxTokens int, opts ...TruncateOption) error {
+	for _, msg := range msgs {
+		if err := msg.TruncateTokens(model, maxTokens, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package graph_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestMessagesContextWindow(t *testing.T) {
+	system := &graph.Message{
+		ID: "system",
+		ChatMessage: openai.ChatMessage{
+			Role:    openai.ChatRoleSystem,
+			Content: "You are a helpful assistant.",
+		},
+	}
+
+	msgs := graph.Messages{system}
+	for i, content := range []string{"one", "two", "three", "four"} {
+		msgs = append(msgs, &graph.Message{
+			ID: string(rune('a' + i)),
+			ChatMessage: openai.ChatMessage{
+				Role:    openai.ChatRoleUser,
+				Content: content,
+			},
+		})
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		window := msgs.ContextWindow(openai.ModelGPT4, msgs.TokenCount(openai.ModelGPT4))
+		if len(window) != len(msgs) {
+			t.Fatalf("expected %d messages, got %d", len(msgs), len(window))
+		}
+	})
+
+	t.Run("trimmed", func(t *testing.T) {
+		budget := graph.Messages{system, msgs[3], msgs[4]}.TokenCount(openai.ModelGPT4)
+
+		window := msgs.ContextWindow(openai.ModelGPT4, budget)
+
+		ids := strings.Join(window.IDs(), ",")
+		if ids != "system,c,d" {
+			t.Fatalf("expected window %q, got %q", "system,c,d", ids)
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		large := append(graph.Messages{}, msgs...)
+		large = append(large, &graph.Message{
+			ID: "large",
+			ChatMessage: openai.ChatMessage{
+				Role:    openai.ChatRoleUser,
+				Content: strings.Repeat("word ", 1000),
+			},
+		})
+
+		window := large.ContextWindow(openai.ModelGPT4, 100)
+
+		ids := strings.Join(window.IDs(), ",")
+		if ids != "system" {
+			t.Fatalf("expected window %q, got %q", "system", ids)
+		}
+	})
+}
+
+func TestMessagesTrimToModel(t *testing.T) {
+	msgs := graph.Messages{}
+	for i := 0; i < 100; i++ {
+		msgs = append(msgs, graph.NewMessage(openai.ChatRoleUser, strings.Repeat("word ", 50)))
+	}
+
+	trimmed, err := msgs.TrimToModel(openai.ModelGPT35Turbo, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trimmed) == 0 || len(trimmed) == len(msgs) {
+		t.Fatalf("expected messages to be trimmed, got %d of %d", len(trimmed), len(msgs))
+	}
+
+	if tokens := trimmed.TokenCount(openai.ModelGPT35Turbo); tokens+1000 > 4096 {
+		t.Fatalf("expected trimmed messages to fit, got %d tokens", tokens)
+	}
+
+	// The most recent messages are kept.
+	if trimmed[len(trimmed)-1] != msgs[len(msgs)-1] {
+		t.Fatalf("expected the most recent message to be kept")
+	}
+
+	if _, err := msgs.TrimToModel("unknown-model", 0); !errors.Is(err, graph.ErrUnknownModel) {
+		t.Fatalf("expected error %v, got %v", graph.ErrUnknownModel, err)
+	}
+}
+
+func TestMessagesEstimateCost(t *testing.T) {
+	msgs := newTestThread("a", "b", "c").Messages
+
+	tokens, cost, err := msgs.EstimateCost(openai.ModelGPT4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The summary prompt is included, so it's more than the messages alone.
+	if tokens <= msgs.TokenCount(openai.ModelGPT4) {
+		t.Fatalf("expected more than %d prompt tokens, got %d", msgs.TokenCount(openai.ModelGPT4), tokens)
+	}
+
+	if want := float64(tokens) / 1000 * graph.ModelPrices[openai.ModelGPT4].Prompt; cost != want {
+		t.Fatalf("expected cost of $%v, got $%v", want, cost)
+	}
+
+	if _, _, err := msgs.EstimateCost("unknown-model"); !errors.Is(err, graph.ErrUnknownModel) {
+		t.Fatalf("expected error %v, got %v", graph.ErrUnknownModel, err)
+	}
+}
+
+func TestMessageTruncateTokens(t *testing.T) {
+	content := strings.Repeat("héllo wörld ", 100)
+
+	msg := graph.NewMessage(openai.ChatRoleUser, content)
+
+	if err := msg.TruncateTokens(openai.ModelGPT4, 50, graph.WithEllipsis()); err != nil {
+		t.Fatal(err)
+	}
+
+	if tokens := msg.TokenCount(openai.ModelGPT4); tokens > 50 {
+		t.Fatalf("expected at most 50 tokens, got %d", tokens)
+	}
+
+	if !utf8.ValidString(msg.Content) || !strings.HasSuffix(msg.Content, "…") {
+		t.Fatalf("expected valid, ellipsized, content, got %q", msg.Content)
+	}
+
+	// The content is cut at the end of a word.
+	if trimmed := strings.TrimSuffix(msg.Content, "…"); !strings.HasPrefix(content, trimmed+" ") {
+		t.Fatalf("expected content to be cut at the end of a word, got %q", msg.Content)
+	}
+
+	// A single long word is cut between runes.
+	msg.Content = strings.Repeat("ü", 100)
+	if err := msg.TruncateTokens(openai.ModelGPT4, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if tokens := msg.TokenCount(openai.ModelGPT4); tokens > 20 || msg.Content == "" || !utf8.ValidString(msg.Content) {
+		t.Fatalf("expected valid content within 20 tokens, got %q (%d tokens)", msg.Content, tokens)
+	}
+
+	if err := msg.TruncateTokens(openai.ModelGPT4, 1); !errors.Is(err, graph.ErrTokenLimit) {
+		t.Fatalf("expected error %v, got %v", graph.ErrTokenLimit, err)
+	}
+}
+
+func TestMessagesTruncateEach(t *testing.T) {
+	msgs := graph.Messages{
+		graph.NewMessage(openai.ChatRoleUser, "short"),
+		graph.NewMessage(openai.ChatRoleAssistant, strings.Repeat("word ", 100)),
+	}
+
+	if err := msgs.TruncateEach(openai.ModelGPT4, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if msgs[0].Content != "short" {
+		t.Fatalf("expected short message to be untouched, got %q", msgs[0].Content)
+	}
+
+	if tokens := msgs[1].TokenCount(openai.ModelGPT4); tokens > 20 {
+		t.Fatalf("expected at most 20 tokens, got %d", tokens)
+	}
+}
@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/picatz/openai"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// DefaultTranslatePrompt is the default prompt used to translate messages for
+// the Translate method, formatted with the name of the target language.
+var DefaultTranslatePrompt = strings.Join(
+	[]string{
+		"You are an expert translator.",
+		"Translate each string in the given JSON array into %s, preserving its meaning, tone, and formatting (e.g. Markdown, or code).",
+		"Respond with the translations alone, as a JSON array of strings that lines up one-to-one with the input array, without any commentary.",
+	}, " ",
+)
+
+// translateChunkTokens is the maximum number of tokens (roughly) of messages
+// translated in a single request by Translate.
+const translateChunkTokens = 1000
+
+// Translate returns a deep copy of the messages, like Clone, including every
+// message reachable through their "in" and "out" messages, with their content
+// translated into the target language using the OpenAI API. IDs, roles, and
+// links are preserved, and the original messages aren't modified.
+//
+// To keep the number of requests down, consecutive messages are sent together,
+// as a JSON array of their contents, up to a rough token limit per request. A
+// batch the model doesn't translate into an array of the same length, even
+// after asking again, fails with an ErrInvalidModelResponse error. Transient
+// errors are retried like ExtractEntities.
+func (msgs Messages) Translate(ctx context.Context, client *openai.Client, model string, target language.Tag, retry *RetryOptions) (Messages, error) {
+	translated := cloneMessages(msgs, map[*Message]*Message{})
+
+	var nodes Messages
+
+	err := translated.Visit(ctx, func(msg *Message) error {
+		if msg.Content != "" {
+			nodes = append(nodes, msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := fmt.Sprintf(DefaultTranslatePrompt, fmt.Sprintf("%s (%s)", display.English.Tags().Name(target), target))
+
+	for _, chunk := range nodes.chunk(model, translateChunkTokens) {
+		chatHistory, err := chunk.contentsChatHistory(prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		contents, err := askJSON(ctx, client, model, chatHistory, retry, func(contents []string) error {
+			if len(contents) != len(chunk) {
+				return fmt.Errorf("expected %d translations, got %d", len(chunk), len(contents))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to translate %d chat messages: %w", len(chunk), err)
+		}
+
+		for i, msg := range chunk {
+			msg.Content = contents[i]
+		}
+	}
+
+	return translated, nil
+}
+
+// contentsChatHistory returns the chat history to send the given prompt, and
+// the content of each of the messages, as a JSON array of strings.
+func (msgs Messages) contentsChatHistory(prompt string) ([]openai.ChatMessage, error) {
+	contents := make([]string, len(msgs))
+	for i, msg := range msgs {
+		contents[i] = msg.Content
+	}
+
+	input, err := json.Marshal(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return []openai.ChatMessage{
+		{
+			Role:    openai.ChatRoleSystem,
+			Content: prompt,
+		},
+		{
+			Role:    openai.ChatRoleUser,
+			Content: string(input),
+		},
+	}, nil
+}
@@ -0,0 +1,75 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+	"golang.org/x/text/language"
+)
+
+func TestMessagesTranslate(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	var requests int
+
+	client := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		requests++
+
+		if !strings.Contains(req.Messages[0].Content, "French (fr)") {
+			t.Fatalf("expected prompt to name the target language, got %q", req.Messages[0].Content)
+		}
+
+		var contents []string
+		if err := json.Unmarshal([]byte(req.Messages[1].Content), &contents); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, content := range contents {
+			contents[i] = strings.Replace(content, "message", "le message", 1)
+		}
+
+		b, _ := json.Marshal(contents)
+		return "```json\n" + string(b) + "\n```"
+	})
+
+	translated, err := chat.Messages.Translate(context.Background(), client, openai.ModelGPT4, language.French, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 1 {
+		t.Fatalf("expected messages to be translated in a single request, got %d", requests)
+	}
+
+	if translated[1].Content != "le message b" || translated[1].ID != "b" || translated[1].Role != openai.ChatRoleAssistant {
+		t.Fatalf("unexpected translated message %+v", translated[1])
+	}
+
+	if translated[1].In[0] != translated[0] || translated[1].Out[0] != translated[2] {
+		t.Fatalf("expected links between the translated messages")
+	}
+
+	if chat.Messages[1].Content != "message b" {
+		t.Fatalf("expected original messages to be untouched, got %q", chat.Messages[1].Content)
+	}
+
+	invalid := newTestChatClient(t, func(req *openai.CreateChatRequest) string {
+		return `["only one"]`
+	})
+
+	if _, err := chat.Messages.Translate(context.Background(), invalid, openai.ModelGPT4, language.French, nil); !errors.Is(err, graph.ErrInvalidModelResponse) {
+		t.Fatalf("expected error %v, got %v", graph.ErrInvalidModelResponse, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := chat.Messages.Translate(ctx, invalid, openai.ModelGPT4, language.French, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,123 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMissingID is a validation problem for a message without an ID.
+	ErrMissingID = errors.New("missing message ID")
+
+	// ErrDuplicateID is a validation problem for messages sharing the same ID.
+	ErrDuplicateID = errors.New("duplicate message ID")
+
+	// ErrDanglingEdge is a validation problem for an "in" or "out" message
+	// that is not part of the graph.
+	ErrDanglingEdge = errors.New("dangling edge")
+
+	// ErrAsymmetricEdge is a validation problem for an "out" message that doesn't
+	// have the message in its "in" messages, or vice versa.
+	ErrAsymmetricEdge = errors.New("asymmetric edge")
+)
+
+// ValidationError is returned by Validate, listing every problem found in the graph.
+type ValidationError struct {
+	Problems []error
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.Error()
+	}
+	return fmt.Sprintf("invalid chat graph with %d problem(s): %s", len(e.Problems), strings.Join(problems, "; "))
+}
+
+// Unwrap returns the problems, to be used with errors.Is and errors.As.
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// ValidateOption configures the Validate method.
+type ValidateOption func(*validateOptions)
+
+type validateOptions struct {
+	strictSymmetry bool
+}
+
+// WithStrictSymmetry is a ValidateOption that also checks that every "out"
+// message has the message in its "in" messages, and vice versa, which is
+// the case when messages are linked with AddInOut or AddOutIn.
+func WithStrictSymmetry() ValidateOption {
+	return func(o *validateOptions) {
+		o.strictSymmetry = true
+	}
+}
+
+// Validate checks the integrity of the graph, returning a *ValidationError
+// listing every problem found, or nil if the graph is valid.
+//
+// A valid graph has a unique ID for every message, and every "in" and
+// "out" message is part of the graph.
+func (graph *Chat) Validate(opts ...ValidateOption) error {
+	var o validateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		nodes    = graph.nodes()
+		problems []error
+		inGraph  = NewMessageSet()
+		ids      = map[string]int{}
+	)
+
+	for _, msg := range nodes {
+		inGraph.Add(msg)
+	}
+
+	for i, msg := range nodes {
+		if msg.ID == "" {
+			problems = append(problems, fmt.Errorf("%w: message %d (%s)", ErrMissingID, i, msg.Role))
+		} else {
+			ids[msg.ID]++
+			if ids[msg.ID] == 2 {
+				problems = append(problems, fmt.Errorf("%w: %q", ErrDuplicateID, msg.ID))
+			}
+		}
+
+		for _, edges := range []struct {
+			name     string
+			msgs     Messages
+			backward func(*Message) Messages
+		}{
+			{name: "in", msgs: msg.In, backward: func(m *Message) Messages { return m.Out }},
+			{name: "out", msgs: msg.Out, backward: func(m *Message) Messages { return m.In }},
+		} {
+			for _, edge := range edges.msgs {
+				if edge == nil {
+					problems = append(problems, fmt.Errorf("%w: message %q has a nil %q message", ErrDanglingEdge, msg.ID, edges.name))
+					continue
+				}
+
+				if !inGraph.Has(edge) {
+					problems = append(problems, fmt.Errorf("%w: message %q has %q message %q that is not in the graph", ErrDanglingEdge, msg.ID, edges.name, edge.ID))
+					continue
+				}
+
+				if o.strictSymmetry && !edges.backward(edge).contains(msg) {
+					problems = append(problems, fmt.Errorf("%w: message %q has %q message %q, but not the other way around", ErrAsymmetricEdge, msg.ID, edges.name, edge.ID))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package graph_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+func TestChatValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+
+		if err := chat.Validate(graph.WithStrictSymmetry()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		chat := newTestThread("a", "b", "c")
+
+		// Duplicate ID.
+		chat.GetMessageByID("c").ID = "b"
+
+		// Dangling edge, to a message outside of the graph.
+		chat.GetMessageByID("a").AddIn(&graph.Message{ID: "z"})
+
+		err := chat.Validate()
+
+		var validationErr *graph.ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+
+		if len(validationErr.Problems) != 2 {
+			t.Fatalf("expected 2 problems, got %d: %v", len(validationErr.Problems), err)
+		}
+
+		if !errors.Is(err, graph.ErrDuplicateID) || !errors.Is(err, graph.ErrDanglingEdge) {
+			t.Fatalf("expected duplicate ID and dangling edge problems, got %v", err)
+		}
+	})
+
+	t.Run("asymmetric", func(t *testing.T) {
+		chat := newTestThread("a", "b")
+
+		// One-directional link.
+		c := &graph.Message{ID: "c"}
+		chat.GetMessageByID("b").AddOut(c)
+
+		if err := chat.Validate(); err != nil {
+			t.Fatalf("expected asymmetric edges to be valid by default, got %v", err)
+		}
+
+		err := chat.Validate(graph.WithStrictSymmetry())
+		if !errors.Is(err, graph.ErrAsymmetricEdge) {
+			t.Fatalf("expected error %v, got %v", graph.ErrAsymmetricEdge, err)
+		}
+	})
+}
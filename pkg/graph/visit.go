@@ -0,0 +1,432 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// VisitParallel visits every message in the chat graph, like Visit, but calls the
+// given function from a bounded pool of worker goroutines, which is useful when the
+// function is slow (e.g. performs network I/O) and the order of visits doesn't matter.
+//
+// The function is called at most once for each message. If it returns an error, the
+// remaining work is cancelled and the first error encountered is returned. It can
+// return ErrStopVisit, or ErrSkipChildren, like Visit, though messages already being
+// visited by other workers when it returns ErrStopVisit are still visited.
+func (c *Chat) VisitParallel(ctx context.Context, workers int, fn func(*Message) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		seenMsgs = NewSyncMessageSet()
+		done     sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+
+		// The messages waiting to be visited, and the number of messages being
+		// visited, which can add more, guarded by mu. Workers wait on cond for
+		// either to change.
+		mu     sync.Mutex
+		cond   = sync.NewCond(&mu)
+		queue  = append(Messages{}, c.Messages...)
+		active int
+	)
+
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	// Wake up the waiting workers once cancelled, so they can stop.
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		cond.Broadcast()
+	})
+	defer stop()
+
+	// dequeue returns the next message to visit, waiting for one while other
+	// messages are being visited, or false once there's nothing left to visit.
+	dequeue := func() (*Message, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for len(queue) == 0 && active > 0 && ctx.Err() == nil {
+			cond.Wait()
+		}
+
+		if len(queue) == 0 || ctx.Err() != nil {
+			// Wake up the other workers, so they stop too.
+			cond.Broadcast()
+			return nil, false
+		}
+
+		message := queue[0]
+		queue = queue[1:]
+		active++
+
+		return message, true
+	}
+
+	for i := 0; i < workers; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+
+			for {
+				message, ok := dequeue()
+				if !ok {
+					return
+				}
+
+				var outs Messages
+
+				if message != nil && seenMsgs.AddIfAbsent(message) {
+					if err := fn(message); errors.Is(err, ErrSkipChildren) {
+						// Don't enqueue the "out" messages.
+					} else if err != nil {
+						fail(err)
+					} else {
+						for _, next := range message.Out {
+							if !seenMsgs.Has(next) {
+								outs = append(outs, next)
+							}
+						}
+					}
+				}
+
+				mu.Lock()
+				queue = append(queue, outs...)
+				active--
+				cond.Broadcast()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	done.Wait()
+
+	if errors.Is(firstErr, ErrStopVisit) {
+		return nil
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+// VisitDepth visits the chat graph in a depth-first-search manner, like Visit,
+// and calls the given function for each message with its depth, where the
+// top-level messages are at depth 0, their "out" messages at depth 1, etc.
+//
+// Messages deeper than maxDepth are not visited. A negative maxDepth means
+// the depth is unlimited, which is the same as Visit. The function can return
+// ErrStopVisit, or ErrSkipChildren, like Visit.
+func (c *Chat) VisitDepth(ctx context.Context, maxDepth int, fn func(message *Message, depth int) error) error {
+	return c.walkAll(ctx, maxDepth, walkOptions{}, fn)
+}
+
+// walkAll walks the graph from each of the top-level messages, in order, with
+// walk, sharing the seen messages, and returns nil if fn returns ErrStopVisit.
+func (c *Chat) walkAll(ctx context.Context, maxDepth int, o walkOptions, fn func(message *Message, depth int) error) error {
+	seenMsgs := NewMessageSet()
+
+	for _, message := range c.Messages {
+		if message == nil || seenMsgs.Has(message) {
+			continue
+		}
+
+		err := walk(ctx, message, 0, maxDepth, seenMsgs, o, fn)
+		if errors.Is(err, ErrStopVisit) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkOptions are the optional hooks of walk, which let traversals change how
+// the graph is walked without another copy of its loop.
+type walkOptions struct {
+	// children returns the messages to visit after the given message, in
+	// order, instead of its "out" messages, such as to sort or filter them.
+	children func(*Message) Messages
+
+	// leave is called for each visited message after the messages visited
+	// from it, including when they're skipped, such as to close a subtree.
+	leave func(*Message) error
+}
+
+// walk visits messages in a depth-first-search manner, starting from the given
+// message at the given depth, and calls the given function for each message
+// with its depth, up to maxDepth (unlimited if negative).
+//
+// An explicit stack is used instead of recursion, so that a very deep graph
+// (e.g. a long linear conversation) can't overflow the goroutine stack. The
+// visit order is the same as a recursive depth-first-search would produce.
+func walk(ctx context.Context, message *Message, depth, maxDepth int, mset MessageSet, o walkOptions, fn func(*Message, int) error) error {
+	children := o.children
+	if children == nil {
+		children = func(message *Message) Messages { return message.Out }
+	}
+
+	type frame struct {
+		message *Message
+		depth   int
+
+		// Whether to leave the message, instead of visiting it.
+		leave bool
+	}
+
+	stack := []frame{{message: message, depth: depth}}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Leave the message once the messages visited from it are done,
+		// since they're above it on the stack.
+		if top.leave {
+			if err := o.leave(top.message); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// If we've already seen this message, or it's too deep, skip.
+		if mset.Has(top.message) || (maxDepth >= 0 && top.depth > maxDepth) {
+			continue
+		}
+
+		// Stop if the context has been cancelled.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// Mark the message as seen.
+		mset.Add(top.message)
+
+		// Call the function on the current message, skipping its
+		// "out" messages if asked to.
+		err := fn(top.message, top.depth)
+		if err != nil && !errors.Is(err, ErrSkipChildren) {
+			return err
+		}
+
+		if o.leave != nil {
+			stack = append(stack, frame{message: top.message, depth: top.depth, leave: true})
+		}
+
+		if err != nil {
+			continue
+		}
+
+		// Push the "out" messages in reverse, so they're visited in order.
+		out := children(top.message)
+		for i := len(out) - 1; i >= 0; i-- {
+			next := out[i]
+
+			// If we've already seen this message, skip.
+			if next == nil || mset.Has(next) {
+				continue
+			}
+
+			stack = append(stack, frame{message: next, depth: top.depth + 1})
+		}
+	}
+
+	// Done.
+	return nil
+}
+
+// VisitInOrder visits the chat graph in a depth-first-search manner, like
+// Visit, but calls enter for each message before visiting its "out" messages,
+// and leave after all of them (and their descendants) have been visited, which
+// is useful to build nested output (e.g. opening and closing HTML tags around a
+// subtree). Either function can be nil.
+//
+// Like Visit, each message is only visited once, so a message reached again
+// (e.g. because of a cycle) isn't entered again. If either function returns an
+// error, the traversal is stopped and the error is returned, except for
+// ErrStopVisit, which stops it without an error. If enter returns ErrSkipChildren,
+// the message's "out" messages are skipped, and it's left right away.
+func (c *Chat) VisitInOrder(ctx context.Context, enter func(*Message) error, leave func(*Message) error) error {
+	if enter == nil {
+		enter = func(*Message) error { return nil }
+	}
+
+	if leave == nil {
+		leave = func(*Message) error { return nil }
+	}
+
+	return c.walkAll(ctx, -1, walkOptions{
+		leave: func(message *Message) error {
+			// ErrSkipChildren is meaningless once the "out" messages were visited.
+			if err := leave(message); !errors.Is(err, ErrSkipChildren) {
+				return err
+			}
+			return nil
+		},
+	}, func(message *Message, _ int) error {
+		return enter(message)
+	})
+}
+
+// VisitOrdered visits the chat graph in a depth-first-search manner, like Visit,
+// but visits the "out" messages of each message in the order given by less,
+// instead of the order they were added, such as by ID, or CreatedAt, to produce
+// the same order however a graph was built (e.g. for snapshot tests). The "out"
+// messages themselves aren't reordered, and the top-level messages are visited
+// in order, like Visit.
+//
+// Messages that less considers equal keep the order they were added in. The
+// function can return ErrStopVisit, or ErrSkipChildren, like Visit.
+func (c *Chat) VisitOrdered(ctx context.Context, less func(a, b *Message) bool, fn func(*Message) error) error {
+	compare := func(a, b *Message) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	// Sort a copy of the "out" messages, so they aren't reordered themselves.
+	sorted := func(message *Message) Messages {
+		out := slices.Clone(message.Out)
+		slices.SortStableFunc(out, compare)
+		return out
+	}
+
+	return c.walkAll(ctx, -1, walkOptions{children: sorted}, func(message *Message, _ int) error {
+		return fn(message)
+	})
+}
+
+// LabelOption configures the VisitLabeled method.
+type LabelOption func(*labelOptions)
+
+type labelOptions struct {
+	unlabeled bool
+}
+
+// WithUnlabeled is a LabelOption that also follows unlabeled links (without
+// a label in OutLabels), which are skipped by default.
+func WithUnlabeled() LabelOption {
+	return func(o *labelOptions) {
+		o.unlabeled = true
+	}
+}
+
+// VisitLabeled visits the chat graph in a depth-first-search manner, like
+// Visit, starting from each top-level message, but only follows the links to
+// "out" messages with the given label in OutLabels, such as to only follow
+// "reply" links, while ignoring "citation" links.
+//
+// Use the WithUnlabeled option to follow unlabeled links as well. The function
+// can return ErrStopVisit, or ErrSkipChildren, like Visit.
+func (c *Chat) VisitLabeled(ctx context.Context, label string, fn func(*Message) error, opts ...LabelOption) error {
+	var o labelOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Only follow the links with the label, or without one, if asked to.
+	labeled := func(message *Message) Messages {
+		var out Messages
+		for _, next := range message.Out {
+			if next == nil {
+				continue
+			}
+			if l, ok := message.OutLabels[next.ID]; (ok && l == label) || (!ok && o.unlabeled) {
+				out = append(out, next)
+			}
+		}
+		return out
+	}
+
+	return c.walkAll(ctx, -1, walkOptions{children: labeled}, func(message *Message, _ int) error {
+		return fn(message)
+	})
+}
+
+// Stream visits the chat graph in a separate goroutine, in the same order as
+// Visit, and sends each message on the returned channel, which is closed once
+// every message has been sent, or the context is cancelled.
+//
+// The goroutine stops as soon as the context is cancelled, even if nothing is
+// receiving from the channel, so cancel the context to stop consuming early
+// without leaking it.
+func (c *Chat) Stream(ctx context.Context) <-chan *Message {
+	ch := make(chan *Message)
+
+	go func() {
+		defer close(ch)
+
+		_ = c.Visit(ctx, func(message *Message) error {
+			select {
+			case ch <- message:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return ch
+}
+
+// VisitFromRoots visits the chat graph from each root message (without any "in"
+// messages), in the same order as Visit finds them, and calls the given function
+// for each message reachable from the root through its "out" messages, in a
+// depth-first-search manner, along with the root, which tells structurally
+// separate threads apart during a single pass.
+//
+// Each root is visited independently, so a message reachable from more than one
+// root (e.g. where two threads merge) is visited once for each of them, while
+// messages that aren't reachable from any root (see Unreachable) aren't visited.
+// The function can return ErrStopVisit, or ErrSkipChildren, like Visit.
+func (c *Chat) VisitFromRoots(ctx context.Context, fn func(root *Message, msg *Message) error) error {
+	var roots Messages
+
+	err := c.Visit(ctx, func(message *Message) error {
+		if len(message.In) == 0 {
+			roots = append(roots, message)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, root := range roots {
+		err := walk(ctx, root, 0, -1, NewMessageSet(), walkOptions{}, func(message *Message, _ int) error {
+			return fn(root, message)
+		})
+		if errors.Is(err, ErrStopVisit) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,590 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/picatz/openai"
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+)
+
+// newTestTree returns a chat graph with a single root message, where every
+// message has the given number of "out" messages, up to the given depth.
+func newTestTree(branches, depth int) *graph.Chat {
+	root := &graph.Message{
+		ID: "0",
+		ChatMessage: openai.ChatMessage{
+			Role:    openai.ChatRoleUser,
+			Content: "root",
+		},
+	}
+
+	level := graph.Messages{root}
+	for d := 1; d <= depth; d++ {
+		var next graph.Messages
+		for _, parent := range level {
+			for b := 0; b < branches; b++ {
+				child := &graph.Message{
+					ID: fmt.Sprintf("%s.%d", parent.ID, b),
+					ChatMessage: openai.ChatMessage{
+						Role:    openai.ChatRoleAssistant,
+						Content: fmt.Sprintf("depth %d", d),
+					},
+				}
+				parent.AddOutIn(child)
+				next = append(next, child)
+			}
+		}
+		level = next
+	}
+
+	return &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{root},
+	}
+}
+
+func TestChatVisitParallel(t *testing.T) {
+	t.Run("all", func(t *testing.T) {
+		chat := newTestTree(3, 4)
+
+		// Add some shared messages and a cycle, which must only be visited once.
+		leaf := chat.Messages[0].Out[0].Out[0]
+		leaf.AddOutIn(chat.Messages[0])
+		chat.Messages = append(chat.Messages, leaf)
+
+		var (
+			mu     sync.Mutex
+			counts = map[string]int{}
+		)
+
+		err := chat.VisitParallel(context.Background(), 8, func(message *graph.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			counts[message.ID]++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 1 + 3 + 9 + 27 + 81 messages.
+		if len(counts) != 121 {
+			t.Fatalf("expected 121 messages to be visited, got %d", len(counts))
+		}
+
+		for id, count := range counts {
+			if count != 1 {
+				t.Fatalf("expected message %q to be visited once, got %d", id, count)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		chat := newTestTree(3, 4)
+
+		failure := errors.New("failure")
+
+		err := chat.VisitParallel(context.Background(), 4, func(message *graph.Message) error {
+			if message.ID == "0.1" {
+				return failure
+			}
+			return nil
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("expected error %v, got %v", failure, err)
+		}
+	})
+
+	t.Run("bounded goroutines", func(t *testing.T) {
+		// A wide graph, where each message has many "out" messages to enqueue.
+		chat := newTestTree(50, 2)
+
+		before := runtime.NumGoroutine()
+
+		var most atomic.Int64
+
+		err := chat.VisitParallel(context.Background(), 2, func(message *graph.Message) error {
+			n := int64(runtime.NumGoroutine() - before)
+			for {
+				m := most.Load()
+				if n <= m || most.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := most.Load(); n > 2 {
+			t.Fatalf("expected at most 2 extra goroutines, got %d", n)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := newTestTree(3, 4).VisitParallel(ctx, 4, func(*graph.Message) error {
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected error %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+func TestChatVisitDepth(t *testing.T) {
+	chat := newTestTree(2, 3)
+
+	for _, test := range []struct {
+		maxDepth int
+		expected int
+	}{
+		{maxDepth: 0, expected: 1},
+		{maxDepth: 1, expected: 3},
+		{maxDepth: 2, expected: 7},
+		{maxDepth: -1, expected: 15},
+	} {
+		t.Run(fmt.Sprint(test.maxDepth), func(t *testing.T) {
+			count := 0
+
+			err := chat.VisitDepth(context.Background(), test.maxDepth, func(message *graph.Message, depth int) error {
+				if test.maxDepth >= 0 && depth > test.maxDepth {
+					t.Fatalf("unexpected depth %d for message %q", depth, message.ID)
+				}
+
+				if message.Content != "root" && message.Content != fmt.Sprintf("depth %d", depth) {
+					t.Fatalf("unexpected depth %d for message %q", depth, message.ID)
+				}
+
+				count++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if count != test.expected {
+				t.Fatalf("expected %d messages to be visited, got %d", test.expected, count)
+			}
+		})
+	}
+}
+
+func TestChatVisitOrder(t *testing.T) {
+	// a → b → d
+	// a → c → d
+	// d → a (cycle)
+	msgs := map[string]*graph.Message{}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		msgs[id] = &graph.Message{ID: id}
+	}
+
+	msgs["a"].AddOutIn(msgs["b"])
+	msgs["a"].AddOutIn(msgs["c"])
+	msgs["b"].AddOutIn(msgs["d"])
+	msgs["c"].AddOutIn(msgs["d"])
+	msgs["d"].AddOutIn(msgs["a"])
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{msgs["a"], msgs["c"]},
+	}
+
+	var order []string
+
+	err := chat.Visit(context.Background(), func(message *graph.Message) error {
+		order = append(order, message.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(order); got != "[a b d c]" {
+		t.Fatalf("expected visit order %q, got %q", "[a b d c]", got)
+	}
+}
+
+func TestChatVisitSentinels(t *testing.T) {
+	chat := newTestTree(2, 2)
+
+	// A second top-level message, which isn't visited once stopped.
+	chat.Messages = append(chat.Messages, &graph.Message{ID: "1"})
+
+	var order []string
+
+	err := chat.Visit(context.Background(), func(message *graph.Message) error {
+		order = append(order, message.ID)
+
+		switch message.ID {
+		case "0.0":
+			return graph.ErrSkipChildren
+		case "0.1.0":
+			return graph.ErrStopVisit
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(order, " "); got != "0 0.0 0.1 0.1.0" {
+		t.Fatalf("expected visit order %q, got %q", "0 0.0 0.1 0.1.0", got)
+	}
+
+	var depths []int
+
+	err = chat.VisitDepth(context.Background(), -1, func(message *graph.Message, depth int) error {
+		depths = append(depths, depth)
+		if depth == 1 {
+			return graph.ErrSkipChildren
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fmt.Sprint(depths); got != "[0 1 1 0]" {
+		t.Fatalf("expected depths %q, got %q", "[0 1 1 0]", got)
+	}
+
+	err = graph.VisitMessages(context.Background(), chat.Messages[0], graph.NewMessageSet(), func(*graph.Message) error {
+		return graph.ErrStopVisit
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// VisitInOrder still leaves a message whose "out" messages are skipped.
+	var events []string
+
+	err = chat.VisitInOrder(context.Background(), func(message *graph.Message) error {
+		events = append(events, "+"+message.ID)
+
+		switch message.ID {
+		case "0.0":
+			return graph.ErrSkipChildren
+		case "0.1.0":
+			return graph.ErrStopVisit
+		}
+		return nil
+	}, func(message *graph.Message) error {
+		events = append(events, "-"+message.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(events, " "); got != "+0 +0.0 -0.0 +0.1 +0.1.0" {
+		t.Fatalf("expected events %q, got %q", "+0 +0.0 -0.0 +0.1 +0.1.0", got)
+	}
+
+	order = nil
+
+	err = chat.VisitLabeled(context.Background(), "reply", func(message *graph.Message) error {
+		order = append(order, message.ID)
+
+		switch message.ID {
+		case "0.0":
+			return graph.ErrSkipChildren
+		case "0.1.0":
+			return graph.ErrStopVisit
+		}
+		return nil
+	}, graph.WithUnlabeled())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(order, " "); got != "0 0.0 0.1 0.1.0" {
+		t.Fatalf("expected visit order %q, got %q", "0 0.0 0.1 0.1.0", got)
+	}
+
+	var visited atomic.Int32
+
+	err = chat.VisitParallel(context.Background(), 4, func(message *graph.Message) error {
+		visited.Add(1)
+		if message.ID == "0" {
+			return graph.ErrSkipChildren
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := visited.Load(); n != 2 {
+		t.Fatalf("expected only the top-level messages to be visited, got %d", n)
+	}
+
+	err = chat.VisitParallel(context.Background(), 4, func(*graph.Message) error {
+		return graph.ErrStopVisit
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestChatVisitDeep(t *testing.T) {
+	const n = 100000
+
+	root := &graph.Message{ID: "0"}
+
+	prev := root
+	for i := 1; i < n; i++ {
+		next := &graph.Message{ID: fmt.Sprint(i)}
+		prev.AddOutIn(next)
+		prev = next
+	}
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{root},
+	}
+
+	count := 0
+
+	err := chat.Visit(context.Background(), func(message *graph.Message) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != n {
+		t.Fatalf("expected %d messages to be visited, got %d", n, count)
+	}
+}
+
+func TestChatVisitInOrder(t *testing.T) {
+	// a → b → d
+	// a → c → d
+	// d → a (cycle)
+	msgs := map[string]*graph.Message{}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		msgs[id] = &graph.Message{ID: id}
+	}
+
+	msgs["a"].AddOutIn(msgs["b"])
+	msgs["a"].AddOutIn(msgs["c"])
+	msgs["b"].AddOutIn(msgs["d"])
+	msgs["c"].AddOutIn(msgs["d"])
+	msgs["d"].AddOutIn(msgs["a"])
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{msgs["a"], msgs["c"]},
+	}
+
+	var b strings.Builder
+
+	err := chat.VisitInOrder(context.Background(), func(message *graph.Message) error {
+		fmt.Fprintf(&b, "<%s>", message.ID)
+		return nil
+	}, func(message *graph.Message) error {
+		fmt.Fprintf(&b, "</%s>", message.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<a><b><d></d></b><c></c></a>"; b.String() != want {
+		t.Fatalf("expected %q, got %q", want, b.String())
+	}
+
+	stop := errors.New("stop")
+
+	err = chat.VisitInOrder(context.Background(), nil, func(message *graph.Message) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected error %v, got %v", stop, err)
+	}
+}
+
+func TestChatVisitLabeled(t *testing.T) {
+	// a → b (reply) → c (citation)
+	// a → d (unlabeled)
+	msgs := map[string]*graph.Message{}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		msgs[id] = &graph.Message{ID: id}
+	}
+
+	msgs["a"].AddOutLabeled(msgs["b"], "reply")
+	msgs["b"].AddOutLabeled(msgs["c"], "citation")
+	msgs["a"].AddOutIn(msgs["d"])
+
+	chat := &graph.Chat{
+		ID:       "chat-1",
+		Name:     "Test Chat",
+		Messages: graph.Messages{msgs["a"]},
+	}
+
+	visit := func(opts ...graph.LabelOption) string {
+		var order []string
+
+		err := chat.VisitLabeled(context.Background(), "reply", func(message *graph.Message) error {
+			order = append(order, message.ID)
+			return nil
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return strings.Join(order, ",")
+	}
+
+	if got := visit(); got != "a,b" {
+		t.Fatalf("expected visit order %q, got %q", "a,b", got)
+	}
+
+	if got := visit(graph.WithUnlabeled()); got != "a,b,d" {
+		t.Fatalf("expected visit order %q, got %q", "a,b,d", got)
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	chat := newTestTree(2, 3)
+
+	var count int
+	for range chat.Stream(context.Background()) {
+		count++
+	}
+
+	if count != 15 {
+		t.Fatalf("expected 15 messages, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ch := chat.Stream(ctx)
+	<-ch
+	cancel()
+
+	// The channel is closed once the goroutine stops, after at most one more message.
+	count = 0
+	for range ch {
+		count++
+	}
+
+	if count > 1 {
+		t.Fatalf("expected the stream to stop after being cancelled, got %d more messages", count)
+	}
+}
+
+func TestChatVisitFromRoots(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	// A second thread, merging into the first one at "c".
+	x, y := &graph.Message{ID: "x"}, &graph.Message{ID: "y"}
+	x.AddOutIn(y)
+	y.AddOutIn(chat.GetMessageByID("c"))
+
+	// An orphaned message, which isn't reachable from a root.
+	z := &graph.Message{ID: "z"}
+	z.AddIn(y)
+
+	chat.Messages = append(chat.Messages, x, z)
+
+	var visits []string
+
+	err := chat.VisitFromRoots(context.Background(), func(root, message *graph.Message) error {
+		visits = append(visits, root.ID+":"+message.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(visits, " "); got != "a:a a:b a:c x:x x:y x:c" {
+		t.Fatalf("expected visits %q, got %q", "a:a a:b a:c x:x x:y x:c", got)
+	}
+
+	visits = nil
+
+	err = chat.VisitFromRoots(context.Background(), func(root, message *graph.Message) error {
+		visits = append(visits, root.ID+":"+message.ID)
+		if message.ID == "b" {
+			return graph.ErrStopVisit
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(visits, " "); got != "a:a a:b" {
+		t.Fatalf("expected visits %q, got %q", "a:a a:b", got)
+	}
+}
+
+func TestChatVisitOrdered(t *testing.T) {
+	chat := newTestThread("a")
+
+	// Children added out of order, with one of them having children of its own.
+	a := chat.GetMessageByID("a")
+	for _, id := range []string{"c", "b", "d"} {
+		a.AddOutIn(&graph.Message{ID: id})
+	}
+	a.Out.GetByID("c").AddOutIn(&graph.Message{ID: "c2"})
+	a.Out.GetByID("c").AddOutIn(&graph.Message{ID: "c1"})
+
+	byID := func(x, y *graph.Message) bool { return x.ID < y.ID }
+
+	var order []string
+
+	err := chat.VisitOrdered(context.Background(), byID, func(message *graph.Message) error {
+		order = append(order, message.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(order, ","); got != "a,b,c,c1,c2,d" {
+		t.Fatalf("expected visit order %q, got %q", "a,b,c,c1,c2,d", got)
+	}
+
+	if ids := strings.Join(a.Out.IDs(), ","); ids != "c,b,d" {
+		t.Fatalf("expected out messages to keep their order, got %q", ids)
+	}
+
+	order = nil
+
+	err = chat.VisitOrdered(context.Background(), byID, func(message *graph.Message) error {
+		order = append(order, message.ID)
+		switch message.ID {
+		case "c":
+			return graph.ErrSkipChildren
+		case "d":
+			return graph.ErrStopVisit
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(order, ","); got != "a,b,c,d" {
+		t.Fatalf("expected visit order %q, got %q", "a,b,c,d", got)
+	}
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// messageYAML is the YAML representation of a Message, used by MarshalYAML
+// and UnmarshalYAML, which mirrors messageJSON, so both formats interoperate.
+type messageYAML struct {
+	ID      string   `yaml:"id"`
+	Role    string   `yaml:"role"`
+	Content string   `yaml:"content"`
+	In      []string `yaml:"in"`
+	Out     []string `yaml:"out"`
+
+	Embedding []float32      `yaml:"embedding,omitempty,flow"`
+	CreatedAt *time.Time     `yaml:"created_at,omitempty"`
+	Metadata  map[string]any `yaml:"metadata,omitempty"`
+	Tags      []string       `yaml:"tags,omitempty"`
+
+	OutWeights map[string]float64 `yaml:"out_weights,omitempty"`
+	OutLabels  map[string]string  `yaml:"out_labels,omitempty"`
+}
+
+// MarshalYAML implements the yaml.Marshaler interface for Message, which,
+// like MarshalJSON, only includes message IDs for the "in" and "out"
+// collections, so a graph can be written with yaml.Marshal.
+func (m *Message) MarshalYAML() (any, error) {
+	raw := messageYAML{
+		ID:      m.ID,
+		Role:    m.Role,
+		Content: m.Content,
+		In:      append([]string{}, m.In.IDs()...),
+		Out:     append([]string{}, m.Out.IDs()...),
+
+		Embedding: m.Embedding,
+		Metadata:  m.Metadata,
+		Tags:      m.Tags,
+
+		OutWeights: m.OutWeights,
+		OutLabels:  m.OutLabels,
+	}
+
+	// The creation time is optional, so it's omitted if unknown.
+	if !m.CreatedAt.IsZero() {
+		raw.CreatedAt = &m.CreatedAt
+	}
+
+	return raw, nil
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface for Message,
+// partially unmarshalling the "in" and "out" messages, like UnmarshalJSON,
+// so the graph must be hydrated (e.g. with HydrateMessages) after loading.
+func (m *Message) UnmarshalYAML(value *yaml.Node) error {
+	var raw messageYAML
+
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	m.ID = raw.ID
+	m.Role = raw.Role
+	m.Content = raw.Content
+	m.Embedding = raw.Embedding
+	m.Metadata = raw.Metadata
+	m.Tags = raw.Tags
+	m.OutWeights = raw.OutWeights
+	m.OutLabels = raw.OutLabels
+
+	if raw.CreatedAt != nil {
+		m.CreatedAt = *raw.CreatedAt
+	}
+
+	// Parially unmarshal the "in" messages.
+	for _, id := range raw.In {
+		m.In = append(m.In, &Message{ID: id})
+	}
+
+	// Parially unmarshal the "out" messages.
+	for _, id := range raw.Out {
+		m.Out = append(m.Out, &Message{ID: id})
+	}
+
+	return nil
+}
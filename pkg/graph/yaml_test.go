@@ -0,0 +1,78 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/picatz/openai-chat-graph/pkg/graph"
+	"gopkg.in/yaml.v3"
+)
+
+func TestChatYAML(t *testing.T) {
+	chat := newTestThread("a", "b", "c")
+
+	a := chat.GetMessageByID("a")
+	a.Embedding = []float32{0.5, 1}
+	a.CreatedAt = time.Date(2023, 3, 26, 12, 0, 0, 0, time.UTC)
+	a.Metadata = map[string]any{"author": "alice"}
+	a.AddTag("important")
+	a.OutLabels = map[string]string{"b": "reply"}
+
+	data, err := yaml.Marshal(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded graph.Chat
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded.HydrateMessages(context.Background())
+
+	if err := decoded.Validate(graph.WithStrictSymmetry()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both formats have the same representation.
+	want, err := json.Marshal(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != string(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	var fromJSON, fromYAML any
+	if err := json.Unmarshal(want, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := yaml.Unmarshal(data, &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare through JSON, to normalize the types of numbers and times.
+	if a, b := mustJSON(t, fromJSON), mustJSON(t, fromYAML); a != b {
+		t.Fatalf("expected YAML structure %s, got %s", a, b)
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,6 @@
+// Package graphpb contains the protocol buffer representation of a chat graph,
+// used by graph.Chat.MarshalProto and graph.UnmarshalChatProto, such as to send
+// conversations between services with gRPC.
+package graphpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative graph.proto